@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// defaultKeyRotation is used when JWT_KEY_ROTATION is not configured
+	defaultKeyRotation = 30 * 24 * time.Hour
+
+	// rsaKeyBits is the size of generated RSA keys
+	rsaKeyBits = 2048
+
+	// JWKSMaxAge is how long the clients may cache the published keys. The next signing key
+	// is published for this long before it signs, so the clients know it when they see its tokens
+	JWKSMaxAge = 5 * time.Minute
+)
+
+// Key is a private key that signs the tokens, identified by kid header
+type Key struct {
+	ID        string
+	Algorithm string
+	Signer    crypto.Signer
+	// ActiveAt is when the key starts to sign the tokens
+	ActiveAt time.Time
+}
+
+// KeySet holds the signing key, the published next key and the retired keys that still verify the tokens
+// signed before the rotation. The keys are ordered by the time they start to sign
+type KeySet struct {
+	mutex     sync.Mutex
+	algorithm string
+	dir       string
+	rotation  time.Duration
+	grace     time.Duration
+	keys      []*Key
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	ID        string `json:"kid"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS is a set of public keys in JSON Web Key format
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKeySet creates key set for RS256 or ES256. The keys are stored in the directory when it is not empty,
+// so they survive restarts. The signing key is replaced after the rotation period by the key published
+// JWKSMaxAge before that, and the replaced key verifies the tokens for the grace period after that
+func NewKeySet(algorithm string, dir string, rotation time.Duration, grace time.Duration) (*KeySet, error) {
+	if algorithm != jwt.SigningMethodRS256.Alg() && algorithm != jwt.SigningMethodES256.Alg() {
+		return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+	}
+	if rotation <= 0 {
+		return nil, fmt.Errorf("rotation period should be positive")
+	}
+	if grace < AccessTokenTTL {
+		return nil, fmt.Errorf("grace period should not be shorter than the access token lifetime %s", AccessTokenTTL)
+	}
+
+	keys := &KeySet{algorithm: algorithm, dir: dir, rotation: rotation, grace: grace}
+	if dir != "" {
+		err := keys.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// ConfigureKeys returns the key set configured in the environment. It is nil when JWT_ALGORITHM
+// is not set, the tokens are signed with API_SECRET using HS256 then
+func ConfigureKeys() (*KeySet, error) {
+	algorithm := strings.TrimSpace(os.Getenv("JWT_ALGORITHM"))
+	if algorithm == "" || algorithm == jwt.SigningMethodHS256.Alg() {
+		return nil, nil
+	}
+
+	rotation, err := duration("JWT_KEY_ROTATION", defaultKeyRotation)
+	if err != nil {
+		return nil, err
+	}
+	grace, err := duration("JWT_KEY_GRACE", AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(algorithm, strings.TrimSpace(os.Getenv("JWT_KEYS_DIR")), rotation, grace)
+}
+
+// duration reads the duration from the environment
+func duration(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return defaultValue, nil
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return result, nil
+}
+
+// Signing returns the key that signs new tokens. The next key is published JWKSMaxAge before
+// the rotation period passes and replaces the signing key after that
+func (s *KeySet) Signing() (*Key, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+	current := s.active(now)
+	if current == nil || current.Algorithm != s.algorithm {
+		// No client can have cached tokens of the missing key, so the new key signs immediately
+		return s.generate(now)
+	}
+	if s.keys[len(s.keys)-1] == current && now.Sub(current.ActiveAt) >= s.rotation-JWKSMaxAge {
+		_, err := s.generate(later(current.ActiveAt.Add(s.rotation), now.Add(JWKSMaxAge)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+// Rotate publishes new key that replaces the signing key after JWKSMaxAge, the previous key
+// still verifies the tokens for the grace period after that. The published next key is dropped
+func (s *KeySet) Rotate() (*Key, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+	if s.active(now) == nil {
+		return s.generate(now)
+	}
+	for len(s.keys) > 0 && s.keys[len(s.keys)-1].ActiveAt.After(now) {
+		s.remove(s.keys[len(s.keys)-1])
+		s.keys = s.keys[:len(s.keys)-1]
+	}
+	return s.generate(now.Add(JWKSMaxAge))
+}
+
+// active returns the key that signs the tokens at given time, nil when there is no such key
+func (s *KeySet) active(now time.Time) *Key {
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if !s.keys[i].ActiveAt.After(now) {
+			return s.keys[i]
+		}
+	}
+	return nil
+}
+
+// later returns the later of the two times
+func later(a time.Time, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Verifying returns the key with given ID, if it is still valid
+func (s *KeySet) Verifying(kid string) (*Key, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.prune(time.Now())
+	for _, current := range s.keys {
+		if current.ID == kid {
+			return current, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS returns the public keys of the signing key, the next key and the retired keys in their grace period
+func (s *KeySet) JWKS() (JWKS, error) {
+	_, err := s.Signing()
+	if err != nil {
+		return JWKS{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := JWKS{Keys: []JWK{}}
+	for _, current := range s.keys {
+		result.Keys = append(result.Keys, current.JWK())
+	}
+	return result, nil
+}
+
+// JWK returns the public part of the key
+func (k *Key) JWK() JWK {
+	result := JWK{Use: "sig", Algorithm: k.Algorithm, ID: k.ID}
+	switch public := k.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		result.KeyType = "RSA"
+		result.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		result.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		result.KeyType = "EC"
+		result.Curve = public.Curve.Params().Name
+		result.X = base64.RawURLEncoding.EncodeToString(padded(public.X, size))
+		result.Y = base64.RawURLEncoding.EncodeToString(padded(public.Y, size))
+	}
+	return result
+}
+
+// padded returns the big-endian bytes of the number with given length
+func padded(number *big.Int, size int) []byte {
+	data := number.Bytes()
+	if len(data) >= size {
+		return data
+	}
+	return append(make([]byte, size-len(data)), data...)
+}
+
+// prune drops the keys that were replaced before the grace period
+func (s *KeySet) prune(now time.Time) {
+	for len(s.keys) > 1 && now.Sub(s.keys[1].ActiveAt) > s.grace {
+		s.remove(s.keys[0])
+		s.keys = s.keys[1:]
+	}
+}
+
+// remove deletes the file of the key from the directory
+func (s *KeySet) remove(key *Key) {
+	if s.dir != "" {
+		os.Remove(filepath.Join(s.dir, key.ID+".pem"))
+	}
+}
+
+// generate creates new key that signs the tokens from given time
+func (s *KeySet) generate(activeAt time.Time) (*Key, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+	var signer crypto.Signer
+	if s.algorithm == jwt.SigningMethodRS256.Alg() {
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	} else {
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id.String(), Algorithm: s.algorithm, Signer: signer, ActiveAt: activeAt}
+	if s.dir != "" {
+		path := filepath.Join(s.dir, key.ID+".pem")
+		err = store(path, signer)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Chtimes(path, activeAt, activeAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.keys = append(s.keys, key)
+	return key, nil
+}
+
+// store writes the private key as PKCS #8 PEM file
+func store(path string, signer crypto.Signer) error {
+	data, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0600)
+}
+
+// load reads the keys from the PEM files of the directory. The file name is the key ID
+// and the modification time is the time the key starts to sign
+func (s *KeySet) load() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".pem" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			return err
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return fmt.Errorf("cannot read key %s: %v", file.Name(), err)
+		}
+		key.ID = strings.TrimSuffix(file.Name(), ".pem")
+		key.ActiveAt = file.ModTime()
+		s.keys = append(s.keys, key)
+	}
+	sort.Slice(s.keys, func(i, j int) bool {
+		return s.keys[i].ActiveAt.Before(s.keys[j].ActiveAt)
+	})
+	return nil
+}
+
+// parseKey reads RSA or P-256 private key in PKCS #8, PKCS #1 or SEC 1 PEM format
+func parseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+	var private interface{}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key")
+	}
+
+	switch current := private.(type) {
+	case *rsa.PrivateKey:
+		return &Key{Algorithm: jwt.SigningMethodRS256.Alg(), Signer: current}, nil
+	case *ecdsa.PrivateKey:
+		if current.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve %s", current.Curve.Params().Name)
+		}
+		return &Key{Algorithm: jwt.SigningMethodES256.Alg(), Signer: current}, nil
+	}
+	return nil, fmt.Errorf("unsupported private key %T", private)
+}
+
+// PublicKey returns the RSA or EC public key of the JWK
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	number := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+	switch k.KeyType {
+	case "RSA":
+		n, err := number(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := number(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Curve != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("unsupported curve %s", k.Curve)
+		}
+		x, err := number(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := number(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.KeyType)
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// oidcTimeout limits the requests to the identity provider
+	oidcTimeout = 10 * time.Second
+
+	// providerTTL is how long the discovery document and the keys of the identity provider are used before they are read again
+	providerTTL = time.Hour
+)
+
+// Provider is an OpenID Connect identity provider that authenticates the users with authorization code flow
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	ClientID              string `json:"-"`
+	ClientSecret          string `json:"-"`
+	RedirectURL           string `json:"-"`
+
+	mutex    sync.Mutex
+	keys     JWKS
+	keysRead time.Time
+}
+
+// Providers keeps the discovered identity provider, so it is not discovered again on every login
+type Providers struct {
+	mutex      sync.Mutex
+	provider   *Provider
+	discovered time.Time
+}
+
+// Identity is the user authenticated by the identity provider
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// oidcClient calls the identity provider
+var oidcClient = &http.Client{Timeout: oidcTimeout}
+
+// Configured returns the provider configured with OIDC_ISSUER. It returns nil when OIDC login is not configured.
+// The provider is discovered again when the configuration changes or the discovery is older than providerTTL
+func (p *Providers) Configured() (*Provider, error) {
+	issuer := strings.TrimSpace(os.Getenv("OIDC_ISSUER"))
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID, clientSecret, redirectURL := os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), os.Getenv("OIDC_REDIRECT_URL")
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	current := p.provider
+	if current != nil && current.Issuer == issuer && current.ClientID == clientID && current.ClientSecret == clientSecret &&
+		current.RedirectURL == redirectURL && time.Since(p.discovered) < providerTTL {
+		return current, nil
+	}
+	provider, err := DiscoverProvider(issuer, clientID, clientSecret, redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	p.provider = provider
+	p.discovered = time.Now()
+	return provider, nil
+}
+
+// DiscoverProvider reads the endpoints of the provider from its discovery document
+func DiscoverProvider(issuer, clientID, clientSecret, redirectURL string) (*Provider, error) {
+	if clientID == "" || redirectURL == "" {
+		return nil, fmt.Errorf("client ID and redirect URL of %s are required", issuer)
+	}
+	provider := &Provider{}
+	err := getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", provider)
+	if err != nil {
+		return nil, err
+	}
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("discovered issuer %s does not match %s", provider.Issuer, issuer)
+	}
+	provider.ClientID = clientID
+	provider.ClientSecret = clientSecret
+	provider.RedirectURL = redirectURL
+	return provider, nil
+}
+
+// NewPKCE returns random code verifier and its S256 code challenge (RFC 7636)
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, codeChallenge(verifier), nil
+}
+
+// codeChallenge returns the S256 code challenge of the verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomString returns URL safe string of given number of random bytes
+func RandomString(size int) (string, error) {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// AuthCodeURL returns the URL where the user is redirected to authenticate
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.ClientID)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("scope", "openid email profile")
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("code_challenge", codeChallenge(verifier))
+	values.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + values.Encode()
+}
+
+// Exchange exchanges the authorization code for ID token and verifies it
+func (p *Provider) Exchange(code, verifier, nonce string) (Identity, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("client_id", p.ClientID)
+	values.Set("code_verifier", verifier)
+	request, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	result := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	err = doJSON(request, &result)
+	if err != nil {
+		return Identity{}, fmt.Errorf("code exchange failed: %v", err)
+	}
+	if result.IDToken == "" {
+		return Identity{}, fmt.Errorf("code exchange returned no ID token")
+	}
+	return p.VerifyIDToken(result.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, the issuer, the audience, the expiration and the nonce of the ID token
+func (p *Provider) VerifyIDToken(idToken, nonce string) (Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			}
+		}
+		return p.verificationKey(token)
+	})
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if !claims.VerifyIssuer(p.Issuer, true) {
+		return Identity{}, fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if !audience(claims["aud"], p.ClientID) {
+		return Identity{}, fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	if _, ok := claims["exp"]; !ok {
+		return Identity{}, fmt.Errorf("ID token has no expiration")
+	}
+	if claims["nonce"] != nonce {
+		return Identity{}, fmt.Errorf("unexpected nonce")
+	}
+
+	identity := Identity{Issuer: p.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+	if identity.Subject == "" {
+		return Identity{}, fmt.Errorf("ID token has no subject")
+	}
+	return identity, nil
+}
+
+// verificationKey returns the public key that signed the ID token. The keys are read again when they
+// are older than providerTTL or do not have the key, as the provider may have rotated its keys since
+func (p *Provider) verificationKey(token *jwt.Token) (interface{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.keysRead) < providerTTL {
+		if key, ok := findKey(p.keys, token); ok {
+			return key.PublicKey()
+		}
+	}
+	keys := JWKS{}
+	err := getJSON(p.JWKSURI, &keys)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysRead = time.Now()
+	if key, ok := findKey(p.keys, token); ok {
+		return key.PublicKey()
+	}
+	return nil, fmt.Errorf("Unknown key: %v", token.Header["kid"])
+}
+
+// findKey returns the key of the set that signed the token
+func findKey(keys JWKS, token *jwt.Token) (JWK, bool) {
+	for _, key := range keys.Keys {
+		if key.ID == token.Header["kid"] && (key.Algorithm == "" || key.Algorithm == token.Method.Alg()) {
+			return key, true
+		}
+	}
+	return JWK{}, false
+}
+
+// audience checks if the aud claim, that is a string or an array, contains the client
+func audience(value interface{}, clientID string) bool {
+	switch current := value.(type) {
+	case string:
+		return current == clientID
+	case []interface{}:
+		for _, item := range current {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getJSON reads the JSON document from the URL
+func getJSON(address string, result interface{}) error {
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	return doJSON(request, result)
+}
+
+// doJSON sends the request and reads the JSON response
+func doJSON(request *http.Request, result interface{}) error {
+	response, err := oidcClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", request.URL, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, result)
+}
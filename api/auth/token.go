@@ -11,14 +11,33 @@ import (
 	"github.com/gofrs/uuid"
 )
 
-// CreateToken creates a token
-func CreateToken(userID uuid.UUID) (string, error) {
+// AccessTokenTTL is how long the access token is valid
+const AccessTokenTTL = time.Hour
+
+// CreateToken creates a token signed with the keys, or with API_SECRET when the keys are nil
+func CreateToken(keys *KeySet, userID uuid.UUID, roles []string) (string, error) {
+	jti, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
+	claims["jti"] = jti.String()
 	claims["user_id"] = userID.String()
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	claims["roles"] = roles
+	claims["exp"] = time.Now().Add(AccessTokenTTL).Unix()
+	if keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	}
+
+	key, err := keys.Signing()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Signer)
 }
 
 func extractToken(r *http.Request) string {
@@ -34,20 +53,35 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
-// ExtractJWTToken extracts and returns a jwt token from request
-func ExtractJWTToken(r *http.Request) (*jwt.Token, error) {
+// ExtractJWTToken extracts and returns a jwt token from request, verified with the keys or with API_SECRET when the keys are nil
+func ExtractJWTToken(keys *KeySet, r *http.Request) (*jwt.Token, error) {
 	tokenString := extractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	token, err := jwt.Parse(tokenString, keys.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+
+}
+
+// verificationKey returns the key that verifies the token, only the configured signing method is accepted
+func (s *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	if s == nil {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(os.Getenv("API_SECRET")), nil
-	})
-	if err != nil {
-		return nil, err
 	}
-	return token, nil
 
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.Verifying(kid)
+	if !ok {
+		return nil, fmt.Errorf("Unknown key: %v", token.Header["kid"])
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Signer.Public(), nil
 }
 
 // ValidateToken validates the token in request
@@ -72,3 +106,35 @@ func ExtractUserID(token *jwt.Token) (uuid.UUID, error) {
 	}
 	return uuid.Nil, fmt.Errorf("failed to extract UUID")
 }
+
+// ExtractRoles extract the roles of the user from token in request
+func ExtractRoles(token *jwt.Token) ([]string, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("failed to extract roles")
+	}
+	values, ok := claims["roles"].([]interface{})
+	if !ok {
+		return []string{}, nil
+	}
+	roles := []string{}
+	for _, value := range values {
+		role, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse role %v", value)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// ExtractTokenID extract the ID and the expiration time of the token in request
+func ExtractTokenID(token *jwt.Token) (string, time.Time, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("failed to extract token ID")
+	}
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	return jti, time.Unix(int64(exp), 0).UTC(), nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// totpPeriod is the time step of the codes
+	totpPeriod = 30
+
+	// totpDigits is the length of the codes
+	totpDigits = 6
+
+	// totpSkew is the number of time steps before and after the current one that are accepted
+	totpSkew = 1
+
+	// totpSecretSize is the size of the shared secret in bytes
+	totpSecretSize = 20
+)
+
+// totpEncoding encodes the shared secrets
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns random shared secret encoded with base32
+func NewTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth URI of the secret, that authenticator apps read from QR code
+func TOTPURI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, values.Encode())
+}
+
+// TOTPCode returns the code of the secret for the time step with given counter (RFC 4226 and RFC 6238)
+func TOTPCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret")
+	}
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo), nil
+}
+
+// TOTPCounter returns the counter of the time step
+func TOTPCounter(now time.Time) int64 {
+	return now.Unix() / totpPeriod
+}
+
+// ValidateTOTP checks the code against the time steps around given time, codes of time steps up to
+// the last used counter are rejected, so each code is used once. It returns the counter of the code
+func ValidateTOTP(secret, code string, now time.Time, lastCounter int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := TOTPCounter(now)
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := TOTPCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
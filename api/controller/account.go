@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/mail"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+)
+
+const (
+	// defaultPasswordResetTTL is used when PASSWORD_RESET_TTL is not configured
+	defaultPasswordResetTTL = time.Hour
+
+	// defaultEmailVerificationTTL is used when EMAIL_VERIFICATION_TTL is not configured
+	defaultEmailVerificationTTL = 48 * time.Hour
+)
+
+// errInvalidActionToken is returned for unknown, expired and used action tokens
+var errInvalidActionToken = errors.New("invalid or expired token")
+
+// readAccountRequest reads the payload from the request body
+func readAccountRequest(w http.ResponseWriter, r *http.Request) (dto.Account, bool) {
+	payload := dto.Account{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return payload, false
+	}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return payload, false
+	}
+	return payload, true
+}
+
+// sendActionToken creates single use token for the purpose and sends it to the email of the user
+func (server *Server) sendActionToken(user model.User, purpose string) error {
+	token, err := auth.RandomString(32)
+	if err != nil {
+		return err
+	}
+	message := mail.Message{To: user.Email}
+	ttl := envDuration("EMAIL_VERIFICATION_TTL", defaultEmailVerificationTTL)
+	if purpose == model.PurposePasswordReset {
+		ttl = envDuration("PASSWORD_RESET_TTL", defaultPasswordResetTTL)
+	}
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	err = server.Storage.Save(&model.ActionToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		Hash:      hashToken(token),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	if purpose == model.PurposePasswordReset {
+		message.Subject = "Reset your password"
+		message.Body = fmt.Sprintf("Hello %s,\n\nPOST the token with your new password to /password/reset to reset your password:\n\ntoken: %s\n\n"+
+			"The token expires at %s. If you did not ask to reset your password, ignore this email.\n",
+			user.Name, token, expiresAt.Format(time.RFC1123))
+	} else {
+		message.Subject = "Verify your email"
+		message.Body = fmt.Sprintf("Hello %s,\n\nPOST the token to /user/verify to verify your email:\n\ntoken: %s\n\n"+
+			"The token expires at %s.\n",
+			user.Name, token, expiresAt.Format(time.RFC1123))
+	}
+	return server.Mailer.Send(message)
+}
+
+// sendVerification sends email verification token to the user, the failures are only logged
+func (server *Server) sendVerification(user model.User) {
+	err := server.sendActionToken(user, model.PurposeEmailVerification)
+	if err != nil {
+		log.Printf("error when sending email verification to %s: %v", user.Email, err)
+	}
+}
+
+// findActionToken returns the active token together with its user.
+// It writes the error response and returns false when the token is not valid
+func (server *Server) findActionToken(w http.ResponseWriter, value string, purpose string) (model.ActionToken, model.User, bool) {
+	token := model.ActionToken{}
+	user := model.User{}
+	if value == "" {
+		response.ERROR(w, http.StatusUnprocessableEntity, errors.New("required Token"))
+		return token, user, false
+	}
+	err := server.Storage.Find(&token, model.Query{
+		Filters: map[string]interface{}{"hash": hashToken(value)},
+	})
+	if err != nil || !token.Active(purpose, time.Now().UTC()) {
+		response.ERROR(w, http.StatusUnauthorized, errInvalidActionToken)
+		return token, user, false
+	}
+	err = server.Storage.FindByID(&user, token.UserID)
+	if err != nil || user.Email != token.Email {
+		// The email was changed after the token was sent
+		response.ERROR(w, http.StatusUnauthorized, errInvalidActionToken)
+		return token, user, false
+	}
+	return token, user, true
+}
+
+// markUsed marks the token as used, so it can not be used again.
+// It writes the error response and returns false when the token was used meanwhile
+func (server *Server) markUsed(w http.ResponseWriter, token *model.ActionToken) bool {
+	now := time.Now().UTC()
+	token.UsedAt = &now
+	err := server.Storage.Update(token)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		// The same token is used by concurrent request
+		response.ERROR(w, http.StatusUnauthorized, errInvalidActionToken)
+		return false
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// useActionToken marks the token as used and returns it together with its user.
+// It writes the error response and returns false when the token is not valid
+func (server *Server) useActionToken(w http.ResponseWriter, value string, purpose string) (model.ActionToken, model.User, bool) {
+	token, user, ok := server.findActionToken(w, value, purpose)
+	if !ok || !server.markUsed(w, &token) {
+		return token, user, false
+	}
+	return token, user, true
+}
+
+// ForgotPassword sends password reset token to the user with given email. It is accepted
+// for unknown emails too, so it does not reveal which emails are registered
+func (server *Server) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readAccountRequest(w, r)
+	if !ok {
+		return
+	}
+	if payload.Email == "" {
+		response.ERROR(w, http.StatusUnprocessableEntity, errors.New("required Email"))
+		return
+	}
+
+	user := model.User{}
+	err := server.Storage.Find(&user, model.Query{
+		Filters: map[string]interface{}{"email": payload.Email},
+	})
+	if err == nil {
+		err = server.sendActionToken(user, model.PurposePasswordReset)
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("error when sending password reset to %s: %v", payload.Email, err)
+	}
+	response.JSON(w, http.StatusAccepted, "")
+}
+
+// ResetPassword sets new password with password reset token and revokes the refresh tokens of the user
+func (server *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readAccountRequest(w, r)
+	if !ok {
+		return
+	}
+	if payload.Password == "" {
+		response.ERROR(w, http.StatusUnprocessableEntity, errors.New("required Password"))
+		return
+	}
+
+	token, user, ok := server.findActionToken(w, payload.Token, model.PurposePasswordReset)
+	if !ok {
+		return
+	}
+	user.Password = payload.Password
+	// The token was received by email, so the email is verified too
+	user.VerifiedEmail = token.Email
+	err := user.Validate(model.ActionUpdate)
+	if err != nil {
+		// The token is not used, so the user can try again with other password
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !server.markUsed(w, &token) {
+		return
+	}
+	// Changed regardless of concurrent changes of the user
+	user.Version = 0
+	err = server.Storage.Update(&user)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = server.revokeUserTokens(user.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusNoContent, "")
+}
+
+// VerifyEmail marks the email of the user as verified with email verification token
+func (server *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readAccountRequest(w, r)
+	if !ok {
+		return
+	}
+
+	token, user, ok := server.useActionToken(w, payload.Token, model.PurposeEmailVerification)
+	if !ok {
+		return
+	}
+	// The stored password hash is kept
+	user.Password = ""
+	user.VerifiedEmail = token.Email
+	user.Version = 0
+	err := server.Storage.Update(&user)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusNoContent, "")
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/middleware"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultAPIKeyTTL is used when API_KEY_TTL is not configured and the key has no expiry
+	defaultAPIKeyTTL = 90 * 24 * time.Hour
+
+	// apiKeyPrefix starts all API keys, so they are easy to recognize
+	apiKeyPrefix = "e2e_"
+
+	// apiKeyPrefixSize is the length of the start of the key that is kept to identify it
+	apiKeyPrefixSize = 12
+
+	// lastUsedPrecision limits how often the last use of the key is recorded
+	lastUsedPrecision = time.Minute
+)
+
+// apiKeyOwner returns the user of the API key with its current roles and the scopes of the key
+func (server *Server) apiKeyOwner(value string) (uuid.UUID, []string, []string, error) {
+	key := model.APIKey{}
+	err := server.Storage.Find(&key, model.Query{
+		Filters: map[string]interface{}{"hash": hashToken(value)},
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return uuid.Nil, nil, nil, middleware.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return uuid.Nil, nil, nil, err
+	}
+	now := time.Now().UTC()
+	if !key.Active(now) {
+		return uuid.Nil, nil, nil, middleware.ErrInvalidAPIKey
+	}
+	user := model.User{}
+	err = server.Storage.FindByID(&user, key.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return uuid.Nil, nil, nil, middleware.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return uuid.Nil, nil, nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedPrecision {
+		// Recorded regardless of concurrent uses and changes of the key
+		err = server.Storage.UpdateColumn(&model.APIKey{}, key.ID, "last_used_at", &now)
+		if err != nil {
+			log.Printf("error when recording the use of API key %s: %v", key.ID, err)
+		}
+	}
+	return user.ID, user.Roles, key.Scopes, nil
+}
+
+// checkScopes verifies that the scopes are permissions the user has. When the request is authenticated
+// with API key they should be in its scopes too, so the keys can not create keys with more permissions
+func checkScopes(r *http.Request, user model.User, scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("required Scopes")
+	}
+	current, limited := r.Context().Value(middleware.KeyScopes).([]string)
+	for _, scope := range scopes {
+		permission := policy.Permission(scope)
+		if !policy.Known(permission) {
+			return fmt.Errorf("unknown scope %s", scope)
+		}
+		if !policy.Allowed(user.Roles, permission) || (limited && !policy.InScope(current, permission)) {
+			return fmt.Errorf("scope %s is not granted to the user", scope)
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey creates named API key of the user, the key is returned only once
+func (server *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	uid, ok := checkSelf(w, r)
+	if !ok {
+		return
+	}
+	user, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	payload := dto.APIKeyCreate{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = checkScopes(r, user, payload.Scopes)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(envDuration("API_KEY_TTL", defaultAPIKeyTTL))
+	if payload.ExpiresAt != nil {
+		expiresAt = payload.ExpiresAt.UTC()
+	}
+
+	secret, err := auth.RandomString(32)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	value := apiKeyPrefix + secret
+	key := model.APIKey{
+		UserID:    uid,
+		Name:      payload.Name,
+		Prefix:    value[:apiKeyPrefixSize],
+		Hash:      hashToken(value),
+		Scopes:    payload.Scopes,
+		ExpiresAt: expiresAt,
+	}
+	err = server.Storage.Save(&key)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	w.Header().Set("Location", location(r, key.ID))
+	response.JSON(w, http.StatusCreated, dto.CreatedAPIKey{APIKey: dto.NewAPIKey(key), Key: value})
+}
+
+// GetUserAPIKeys retrieves a page of the API keys of given user, without the keys
+func (server *Server) GetUserAPIKeys(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if !checkOwner(w, r, uid, policy.ManageUsers) {
+		return
+	}
+
+	key := model.APIKey{}
+	query, err := parseCursorQuery(r, &key)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	query.Filters["user_id"] = uid
+
+	count, err := server.cursorCount(&key, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := server.Storage.FindAll(&key, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
+}
+
+// DeleteAPIKey revokes the API key of the user
+func (server *Server) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	keyID, err := uuid.FromString(vars["key_id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if !checkOwner(w, r, uid, policy.ManageUsers) {
+		return
+	}
+
+	key := model.APIKey{}
+	err = server.Storage.FindByID(&key, keyID)
+	if err != nil || key.UserID != uid {
+		response.ERROR(w, http.StatusNotFound, storage.ErrNotFound)
+		return
+	}
+	err = server.Storage.Delete(&key)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Entity", fmt.Sprintf("%s", keyID))
+	response.JSON(w, http.StatusNoContent, "")
+}
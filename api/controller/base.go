@@ -5,42 +5,65 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/mail"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gorilla/mux"
-	"github.com/jinzhu/gorm"
-
-	_ "github.com/jinzhu/gorm/dialects/postgres" //postgres database driver
 )
 
 // Server represent current API server
 type Server struct {
-	DB     *gorm.DB
-	Router *mux.Router
+	Storage storage.Storage
+	Router  *mux.Router
+	Mailer  mail.Mailer
+	// Keys sign and verify the tokens, they are signed with API_SECRET when it is nil
+	Keys *auth.KeySet
+
+	providers *auth.Providers
 }
 
 // DBInitialize is used to init a DB cnnection
-func (server *Server) DBInitialize(dbUser, dbPassword, dbPort, dbHost, dbName string) {
-	dbDriver := "postgres"
-	DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", dbHost, dbPort, dbUser, dbName, dbPassword)
+func (server *Server) DBInitialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) {
 	var err error
-	server.DB, err = gorm.Open(dbDriver, DBURL)
+	server.Storage, err = storage.Open(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("Cannot connect to %s database with error: %v", dbDriver, err))
 	}
 	log.Printf("We are connected to the %s database", dbDriver)
+}
+
+// KeysInitialize is used to set the keys that sign the tokens
+func (server *Server) KeysInitialize() {
+	var err error
+	server.Keys, err = auth.ConfigureKeys()
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Cannot configure the signing keys with error: %v", err))
+	}
+}
 
-	server.DB.AutoMigrate(&model.User{}, &model.Event{}, &model.Session{}, &model.Subscription{}, &model.Comment{})
+// MailerInitialize is used to set the mailer that sends the emails to the users
+func (server *Server) MailerInitialize() {
+	var err error
+	server.Mailer, err = mail.Open()
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Cannot configure the mailer with error: %v", err))
+	}
 }
 
 // RoutesInitialize is used to register routes
 func (server *Server) RoutesInitialize() {
 	server.Router = mux.NewRouter()
+	if server.providers == nil {
+		server.providers = &auth.Providers{}
+	}
 	server.initializeRoutes()
 }
 
 // Initialize is used to init a DB cnnection and register routes
-func (server *Server) Initialize(dbUser, dbPassword, dbPort, dbHost, dbName string) {
-	server.DBInitialize(dbUser, dbPassword, dbPort, dbHost, dbName)
+func (server *Server) Initialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) {
+	server.DBInitialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+	server.KeysInitialize()
+	server.MailerInitialize()
 	server.RoutesInitialize()
 }
 
@@ -2,12 +2,16 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
 )
@@ -20,52 +24,75 @@ func (server *Server) CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment := model.Comment{}
-	err = json.Unmarshal(body, &comment)
+	payload := dto.CommentCreate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = comment.Validate("update")
+	comment := model.Comment{Message: payload.Message}
+	if !server.resolve(w, &comment.Session, payload.Session) {
+		return
+	}
+	comment.SessionID = comment.Session.ID
+
+	author, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+	comment.User = author
+	comment.UserID = author.ID
+
+	err = comment.Validate(model.ActionCreate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = comment.Save(server.DB)
-
+	err = server.Storage.Save(&comment)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, comment.ID))
-	response.JSON(w, http.StatusCreated, comment)
+	w.Header().Set("Location", location(r, comment.ID))
+	w.Header().Set("ETag", etag(comment.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&comment))
 }
 
-// GetComments retrieves all comments
+// GetComments retrieves a page of comments
 func (server *Server) GetComments(w http.ResponseWriter, r *http.Request) {
-	var err error
 	comment := model.Comment{}
-	count, err := comment.Count(server.DB)
+	query, err := parseCursorQuery(r, &comment)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := server.cursorCount(&comment, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	data, err := comment.FindAll(server.DB)
+	data, err := server.Storage.FindAll(&comment, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	list := model.List{
-		Count: count,
-		Data:  *data,
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	response.JSON(w, http.StatusOK, list)
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
 }
 
 // GetComment loads an comment by given ID
@@ -77,12 +104,15 @@ func (server *Server) GetComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	comment := model.Comment{}
-	err = comment.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&comment, uid)
 	if err != nil {
 		response.ERROR(w, http.StatusNotFound, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, comment)
+	if notModified(w, r, comment.Version) {
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&comment))
 }
 
 // UpdateComment updates existing comment
@@ -100,27 +130,139 @@ func (server *Server) UpdateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comment := model.Comment{}
-	err = json.Unmarshal(body, &comment)
+	payload := dto.CommentUpdate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = comment.Validate("update")
+	current := model.Comment{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, current.UserID, policy.WriteAnyComments) {
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	comment := model.Comment{Message: payload.Message}
+	if !server.resolve(w, &comment.Session, payload.Session) {
+		return
+	}
+	comment.SessionID = comment.Session.ID
+
+	// The author is not changed
+	err = server.Storage.FindByID(&comment.User, current.UserID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	comment.UserID = current.UserID
+
+	err = comment.Validate(model.ActionUpdate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
 	comment.ID = uid
+	comment.Version = current.Version
+
+	err = server.Storage.Update(&comment)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&comment, comment.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(comment.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&comment))
+}
+
+// PatchComment updates the fields of existing comment that are present in the patch
+func (server *Server) PatchComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current := model.Comment{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, current.UserID, policy.WriteAnyComments) {
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	patched := dto.CommentUpdate{}
+	if !applyPatch(w, r, dto.CommentUpdate{Message: current.Message, Session: dto.Reference{ID: current.SessionID}}, &patched) {
+		return
+	}
+
+	comment := model.Comment{Message: patched.Message}
+	if !server.resolve(w, &comment.Session, patched.Session) {
+		return
+	}
+	comment.SessionID = comment.Session.ID
 
-	err = comment.Update(server.DB)
+	// The author is not changed
+	err = server.Storage.FindByID(&comment.User, current.UserID)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, comment)
+	comment.UserID = current.UserID
+	comment.Base = current.Base
+
+	err = comment.Validate(model.ActionUpdate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Update(&comment)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&comment, comment.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(comment.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&comment))
 }
 
 // DeleteComment deletes an comment
@@ -134,13 +276,31 @@ func (server *Server) DeleteComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = comment.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&comment, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	if !checkOwner(w, r, comment.UserID, policy.WriteAnyComments) {
+		return
+	}
+	if !checkPrecondition(w, r, comment.Version) {
+		return
+	}
 
-	err = comment.Delete(server.DB)
+	err = server.Storage.Delete(&comment)
+	if errors.Is(err, storage.ErrReferenced) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -149,3 +309,134 @@ func (server *Server) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Entity", fmt.Sprintf("%s", uid))
 	response.JSON(w, http.StatusNoContent, "")
 }
+
+// RestoreComment restores the deleted comment
+func (server *Server) RestoreComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	comment := model.Comment{}
+	err = server.Storage.Restore(&comment, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, storage.ErrDeletedParent) || errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&comment))
+}
+
+// GetSessionComments retrieves a page of comments of given session
+func (server *Server) GetSessionComments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	session := model.Session{}
+	err = server.Storage.FindByID(&session, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	comment := model.Comment{}
+	query, err := parseCursorQuery(r, &comment)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	query.Filters["session_id"] = session.ID
+
+	count, err := server.cursorCount(&comment, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := server.Storage.FindAll(&comment, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
+}
+
+// CreateSessionComment is caled to create an comment for given session
+func (server *Server) CreateSessionComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	session := model.Session{}
+	err = server.Storage.FindByID(&session, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	payload := dto.CommentCreate{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// The session is the one from the path
+	comment := model.Comment{Message: payload.Message}
+	comment.Session = session
+	comment.SessionID = session.ID
+
+	author, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+	comment.User = author
+	comment.UserID = author.ID
+
+	err = comment.Validate(model.ActionCreate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Save(&comment)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", location(r, comment.ID))
+	w.Header().Set("ETag", etag(comment.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&comment))
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+)
+
+// sign calculates the signature of the payload with API_SECRET
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("API_SECRET")))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeCursor returns an opaque and signed cursor pointing after given object
+func encodeCursor(object model.Object) (string, error) {
+	data, err := json.Marshal(model.Cursor{
+		CreatedAt: object.GetCreatedAt(),
+		ID:        object.GetID(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return fmt.Sprintf("%s.%s", payload, sign(payload)), nil
+}
+
+// decodeCursor verifies the signature and returns the cursor
+func decodeCursor(value string) (*model.Cursor, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(sign(parts[0]))) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	cursor := model.Cursor{}
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// keysetOrder checks if the list is ordered by creation time, which is required for cursors
+func keysetOrder(sort []model.Order) bool {
+	return len(sort) == 2 &&
+		sort[0] == model.Order{Field: "created_at"} &&
+		sort[1] == model.Order{Field: "id"}
+}
+
+// parseCursorQuery reads the query parameters allowing the page to start after a cursor
+func parseCursorQuery(r *http.Request, object model.Object) (model.Query, error) {
+	values := r.URL.Query()
+	cursor := values.Get("cursor")
+	values.Del("cursor")
+
+	query, err := parseQuery(values, object)
+	if err != nil || cursor == "" {
+		return query, err
+	}
+
+	if query.Offset > 0 {
+		return query, fmt.Errorf("cursor cannot be combined with offset")
+	}
+	if !keysetOrder(query.Sort) {
+		return query, fmt.Errorf("cursor cannot be combined with sort")
+	}
+
+	query.After, err = decodeCursor(cursor)
+	return query, err
+}
+
+// cursorCount counts the objects of the list. The pages after a cursor skip the count,
+// as it scans the whole table which the keyset paging avoids
+func (server *Server) cursorCount(object model.Object, query model.Query) (*int, error) {
+	if query.After != nil {
+		return nil, nil
+	}
+	count, err := server.Storage.Count(object, query)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
+
+// newCursorList wraps a page of objects with the paging metadata and the cursor of the next page
+func newCursorList(r *http.Request, query model.Query, count *int, data []model.Object) (model.List, error) {
+	total := 0
+	if count != nil {
+		total = *count
+	}
+	list := newList(r, query, total, data)
+	list.Count = count
+	if query.After != nil {
+		list.Next = ""
+		list.Previous = ""
+	}
+
+	if !keysetOrder(query.Sort) || len(data) == 0 || len(data) < query.Limit {
+		return list, nil
+	}
+
+	cursor, err := encodeCursor(data[len(data)-1])
+	if err != nil {
+		return list, err
+	}
+	list.NextCursor = cursor
+
+	if query.After != nil {
+		values := r.URL.Query()
+		values.Set("limit", strconv.Itoa(query.Limit))
+		values.Set("cursor", cursor)
+		list.Next = fmt.Sprintf("%s?%s", r.URL.Path, values.Encode())
+	}
+
+	return list, nil
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dzahariev/e2e-rest/api/response"
+)
+
+// etag returns the entity tag of given object version
+func etag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// matches checks if the entity tag is listed in If-Match or If-None-Match header value
+func matches(header string, tag string) bool {
+	for _, current := range strings.Split(header, ",") {
+		current = strings.TrimPrefix(strings.TrimSpace(current), "W/")
+		if current == "*" || current == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch checks if changes without If-Match header are rejected
+func requireIfMatch() bool {
+	required, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("REQUIRE_IF_MATCH")))
+	return err == nil && required
+}
+
+// checkPrecondition verifies the If-Match header against the current version of the object
+// and writes the error response when the request should not be processed
+func checkPrecondition(w http.ResponseWriter, r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if requireIfMatch() {
+			response.ERROR(w, http.StatusPreconditionRequired, errors.New("If-Match header is required"))
+			return false
+		}
+		return true
+	}
+	if !matches(header, etag(version)) {
+		response.ERROR(w, http.StatusPreconditionFailed, errors.New("object was modified by another request"))
+		return false
+	}
+	return true
+}
+
+// notModified sets the ETag header and writes Not Modified response
+// when the object version matches the If-None-Match header
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	w.Header().Set("ETag", etag(version))
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !matches(header, etag(version)) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
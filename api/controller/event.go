@@ -2,12 +2,15 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/model"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
 )
@@ -20,52 +23,57 @@ func (server *Server) CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event := model.Event{}
-	err = json.Unmarshal(body, &event)
+	payload := dto.EventCreate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	event := model.Event{Name: payload.Name, Year: payload.Year}
 
-	err = event.Validate("update")
+	err = event.Validate(model.ActionCreate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = event.Save(server.DB)
-
+	err = server.Storage.Save(&event)
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, event.ID))
-	response.JSON(w, http.StatusCreated, event)
+	w.Header().Set("Location", location(r, event.ID))
+	w.Header().Set("ETag", etag(event.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&event))
 }
 
-// GetEvents retrieves all events
+// GetEvents retrieves a page of events
 func (server *Server) GetEvents(w http.ResponseWriter, r *http.Request) {
-	var err error
 	event := model.Event{}
-	count, err := event.Count(server.DB)
+	query, err := parseQuery(r.URL.Query(), &event)
 	if err != nil {
-		response.ERROR(w, http.StatusInternalServerError, err)
+		response.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	data, err := event.FindAll(server.DB)
+	count, err := server.Storage.Count(&event, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	list := model.List{
-		Count: count,
-		Data:  *data,
+	data, err := server.Storage.FindAll(&event, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	response.JSON(w, http.StatusOK, list)
+	response.JSON(w, http.StatusOK, server.viewer(r).list(newList(r, query, count, data)))
 }
 
 // GetEvent loads an event by given ID
@@ -77,12 +85,15 @@ func (server *Server) GetEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	event := model.Event{}
-	err = event.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&event, uid)
 	if err != nil {
 		response.ERROR(w, http.StatusNotFound, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, event)
+	if notModified(w, r, event.Version) {
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&event))
 }
 
 // UpdateEvent updates existing event
@@ -100,27 +111,107 @@ func (server *Server) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event := model.Event{}
-	err = json.Unmarshal(body, &event)
+	payload := dto.EventUpdate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	event := model.Event{Name: payload.Name, Year: payload.Year}
 
-	err = event.Validate("update")
+	err = event.Validate(model.ActionUpdate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
+	current := model.Event{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
 	event.ID = uid
+	event.Version = current.Version
 
-	err = event.Update(server.DB)
+	err = server.Storage.Update(&event)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, event)
+	err = server.Storage.FindByID(&event, event.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(event.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&event))
+}
+
+// PatchEvent updates the fields of existing event that are present in the patch
+func (server *Server) PatchEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current := model.Event{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	patched := dto.EventUpdate{}
+	if !applyPatch(w, r, dto.EventUpdate{Name: current.Name, Year: current.Year}, &patched) {
+		return
+	}
+	event := model.Event{Name: patched.Name, Year: patched.Year}
+	event.Base = current.Base
+
+	err = event.Validate(model.ActionUpdate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Update(&event)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&event, event.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(event.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&event))
 }
 
 // DeleteEvent deletes an event
@@ -134,13 +225,28 @@ func (server *Server) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = event.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&event, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	if !checkPrecondition(w, r, event.Version) {
+		return
+	}
 
-	err = event.Delete(server.DB)
+	err = server.Storage.Delete(&event)
+	if errors.Is(err, storage.ErrReferenced) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -149,3 +255,29 @@ func (server *Server) DeleteEvent(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Entity", fmt.Sprintf("%s", uid))
 	response.JSON(w, http.StatusNoContent, "")
 }
+
+// RestoreEvent restores the deleted event
+func (server *Server) RestoreEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	event := model.Event{}
+	err = server.Storage.Restore(&event, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, storage.ErrDeletedParent) || errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&event))
+}
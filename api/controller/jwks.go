@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/response"
+)
+
+// GetJWKS returns the public keys that verify the tokens, the set is empty when the tokens are signed with API_SECRET
+func (server *Server) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := auth.JWKS{Keys: []auth.JWK{}}
+	if server.Keys != nil {
+		var err error
+		keys, err = server.Keys.JWKS()
+		if err != nil {
+			response.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JWKSMaxAge.Seconds())))
+	response.JSON(w, http.StatusOK, keys)
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+)
+
+// defaultListLimit is used when LOAD_LIST_LIMIT is not configured
+const defaultListLimit = 100
+
+// reservedParams are query parameters that are not treated as filters
+var reservedParams = map[string]bool{
+	"limit":  true,
+	"offset": true,
+	"sort":   true,
+	"token":  true,
+}
+
+// listLimit returns the default and maximum page size
+func listLimit() int {
+	limit, err := strconv.Atoi(strings.TrimSpace(os.Getenv("LOAD_LIST_LIMIT")))
+	if err != nil || limit <= 0 {
+		return defaultListLimit
+	}
+	return limit
+}
+
+// contains checks if the field is one of the given fields
+func contains(fields []string, field string) bool {
+	for _, current := range fields {
+		if current == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedBy checks if the field is already part of the sorting
+func sortedBy(sort []model.Order, field string) bool {
+	for _, order := range sort {
+		if order.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQuery reads the paging, sorting and filtering parameters from the request query values
+func parseQuery(values url.Values, object model.Object) (model.Query, error) {
+	fields := object.Fields()
+	query := model.Query{
+		Limit:   listLimit(),
+		Filters: map[string]interface{}{},
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return query, fmt.Errorf("invalid limit %s", limit)
+		}
+		if value < query.Limit {
+			query.Limit = value
+		}
+	}
+
+	if offset := values.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return query, fmt.Errorf("invalid offset %s", offset)
+		}
+		query.Offset = value
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			order := model.Order{Field: strings.TrimSpace(field)}
+			if strings.HasPrefix(order.Field, "-") {
+				order.Field = strings.TrimPrefix(order.Field, "-")
+				order.Desc = true
+			}
+			if !contains(fields, order.Field) {
+				return query, fmt.Errorf("invalid sort field %s", order.Field)
+			}
+			query.Sort = append(query.Sort, order)
+		}
+	}
+
+	// keep the order stable between the pages
+	if len(query.Sort) == 0 {
+		query.Sort = append(query.Sort, model.Order{Field: "created_at"})
+	}
+	if !sortedBy(query.Sort, "id") {
+		query.Sort = append(query.Sort, model.Order{Field: "id"})
+	}
+
+	for field := range values {
+		if reservedParams[field] {
+			continue
+		}
+		if !contains(fields, field) {
+			return query, fmt.Errorf("invalid filter field %s", field)
+		}
+		query.Filters[field] = values.Get(field)
+	}
+
+	return query, nil
+}
+
+// pageLink returns a link to the page starting at given offset
+func pageLink(r *http.Request, query model.Query, offset int) string {
+	values := r.URL.Query()
+	values.Set("limit", strconv.Itoa(query.Limit))
+	values.Set("offset", strconv.Itoa(offset))
+	return fmt.Sprintf("%s?%s", r.URL.Path, values.Encode())
+}
+
+// newList wraps a page of objects with the paging metadata
+func newList(r *http.Request, query model.Query, count int, data []model.Object) model.List {
+	list := model.List{
+		Count:  &count,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+		Data:   data,
+	}
+
+	if query.Offset+query.Limit < count {
+		list.Next = pageLink(r, query, query.Offset+query.Limit)
+	}
+
+	if query.Offset > 0 {
+		previous := query.Offset - query.Limit
+		if previous < 0 {
+			previous = 0
+		}
+		list.Previous = pageLink(r, query, previous)
+	}
+
+	return list
+}
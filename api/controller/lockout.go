@@ -0,0 +1,249 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultMaxFailures is used when LOGIN_MAX_FAILURES is not configured
+	defaultMaxFailures = 5
+
+	// defaultLockout is used when LOGIN_LOCKOUT is not configured
+	defaultLockout = time.Minute
+
+	// maxLockout limits the exponential backoff, older failures are not counted
+	maxLockout = 24 * time.Hour
+
+	// defaultIPMaxFailures is used when LOGIN_IP_MAX_FAILURES is not configured
+	defaultIPMaxFailures = 20
+
+	// defaultIPWindow is used when LOGIN_IP_WINDOW is not configured
+	defaultIPWindow = 15 * time.Minute
+)
+
+// lockedError is returned by authenticate when the account or the client is locked out after failed logins
+type lockedError struct {
+	status int
+	until  time.Time
+}
+
+// Error returns the message of the error
+func (e *lockedError) Error() string {
+	if e.status == http.StatusTooManyRequests {
+		return "too many failed logins, try again later"
+	}
+	return "account is locked after failed logins, try again later"
+}
+
+// write writes the error response with the time the client should wait
+func (e *lockedError) write(w http.ResponseWriter) {
+	seconds := int(math.Ceil(time.Until(e.until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	response.ERROR(w, e.status, e)
+}
+
+// envInt returns the positive number configured in the environment variable or the default one
+func envInt(name string, defaultValue int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name)))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// clientIP returns the address of the client, from X-Forwarded-For header when TRUST_PROXY is set
+func clientIP(r *http.Request) string {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("TRUST_PROXY")), "true") {
+		forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0])
+		if forwarded != "" {
+			return forwarded
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// audit records the login attempt, the failures are only logged
+func (server *Server) audit(email, ip, outcome string) {
+	err := server.Storage.Save(&model.LoginAttempt{Email: email, IP: ip, Outcome: outcome})
+	if err != nil {
+		log.Printf("error when recording %s login of %s: %v", outcome, email, err)
+	}
+}
+
+// accountLockedUntil returns the end of the account lockout. The account is locked after LOGIN_MAX_FAILURES
+// failures since the last success or unlock, for LOGIN_LOCKOUT that doubles with each next failure.
+// The failures are counted by time, so the rejected logins of the locked account do not push them out
+func (server *Server) accountLockedUntil(email string) (time.Time, error) {
+	maxFailures := envInt("LOGIN_MAX_FAILURES", defaultMaxFailures)
+	lockout := envDuration("LOGIN_LOCKOUT", defaultLockout)
+	since := time.Now().Add(-maxLockout)
+	for _, outcome := range []string{model.OutcomeSuccess, model.OutcomeUnlocked} {
+		attempt := model.LoginAttempt{}
+		err := server.Storage.Find(&attempt, model.Query{
+			Sort:    []model.Order{{Field: "created_at", Desc: true}},
+			Filters: map[string]interface{}{"email": email, "outcome": outcome},
+		})
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return time.Time{}, err
+		}
+		if err == nil && attempt.CreatedAt.After(since) {
+			since = attempt.CreatedAt
+		}
+	}
+
+	// More failures than maxFailures+32 lock the account for maxLockout anyway
+	data, err := server.Storage.FindAll(&model.LoginAttempt{}, model.Query{
+		Limit:   maxFailures + 32,
+		Sort:    []model.Order{{Field: "created_at", Desc: true}},
+		Filters: map[string]interface{}{"email": email, "outcome": model.OutcomeFailure},
+		After:   &model.Cursor{CreatedAt: since},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	failures := len(data)
+	if failures < maxFailures {
+		return time.Time{}, nil
+	}
+
+	delay := maxLockout
+	if exponent := failures - maxFailures; exponent < 32 {
+		delay = lockout * time.Duration(1<<uint(exponent))
+	}
+	if delay <= 0 || delay > maxLockout {
+		delay = maxLockout
+	}
+	return data[0].GetCreatedAt().Add(delay), nil
+}
+
+// clientLockedUntil returns the end of the client lockout. The client is locked when it has
+// LOGIN_IP_MAX_FAILURES failures within LOGIN_IP_WINDOW, until the oldest of them is out of the window
+func (server *Server) clientLockedUntil(ip string) (time.Time, error) {
+	if ip == "" {
+		return time.Time{}, nil
+	}
+	maxFailures := envInt("LOGIN_IP_MAX_FAILURES", defaultIPMaxFailures)
+	window := envDuration("LOGIN_IP_WINDOW", defaultIPWindow)
+	data, err := server.Storage.FindAll(&model.LoginAttempt{}, model.Query{
+		Limit:   maxFailures,
+		Sort:    []model.Order{{Field: "created_at", Desc: true}},
+		Filters: map[string]interface{}{"ip": ip, "outcome": model.OutcomeFailure},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(data) < maxFailures {
+		return time.Time{}, nil
+	}
+	return data[len(data)-1].GetCreatedAt().Add(window), nil
+}
+
+// checkLockout returns lockedError when the client or the account is locked and records the rejected login
+func (server *Server) checkLockout(email, ip string) error {
+	until, err := server.clientLockedUntil(ip)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		server.audit(email, ip, model.OutcomeRateLimited)
+		return &lockedError{status: http.StatusTooManyRequests, until: until}
+	}
+
+	until, err = server.accountLockedUntil(email)
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		server.audit(email, ip, model.OutcomeLocked)
+		return &lockedError{status: http.StatusLocked, until: until}
+	}
+	return nil
+}
+
+// UnlockUser unlocks the account of the user, the failed logins before are not counted anymore
+func (server *Server) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := model.User{}
+	err = server.Storage.FindByID(&user, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	err = server.Storage.Save(&model.LoginAttempt{Email: user.Email, IP: clientIP(r), Outcome: model.OutcomeUnlocked})
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusNoContent, "")
+}
+
+// GetUserLoginAttempts retrieves a page of the login audit records of given user
+func (server *Server) GetUserLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := model.User{}
+	err = server.Storage.FindByID(&user, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	attempt := model.LoginAttempt{}
+	query, err := parseCursorQuery(r, &attempt)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	query.Filters["email"] = user.Email
+
+	count, err := server.cursorCount(&attempt, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := server.Storage.FindAll(&attempt, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
+}
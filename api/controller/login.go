@@ -2,56 +2,105 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/model"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// LogIn returns a token for user
+// LogIn returns access token and refresh token for user
 func (server *Server) LogIn(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	user := model.User{}
-	err = json.Unmarshal(body, &user)
+	payload := dto.Login{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = user.Validate("login")
+	user := model.User{Email: payload.Email, Password: payload.Password}
+	err = user.Validate(model.ActionLogin)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	token, err := server.GetTokenForUser(user.Email, user.Password)
+	user, err = server.authenticate(user.Email, user.Password, clientIP(r))
 	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
+		locked := &lockedError{}
+		if errors.As(err, &locked) {
+			locked.write(w)
+		} else if err == errSecondFactorRequired {
+			server.writeChallenge(w, user)
+		} else if err == bcrypt.ErrMismatchedHashAndPassword {
 			response.ERROR(w, http.StatusUnauthorized, err)
 		} else {
 			response.ERROR(w, http.StatusUnprocessableEntity, err)
 		}
 		return
 	}
-	response.JSON(w, http.StatusOK, token)
+
+	family, err := uuid.NewV4()
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	result, err := server.issueTokens(user, family)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, result)
 }
 
-// GetTokenForUser returns a token for the user
+// GetTokenForUser returns an access token for the user
 func (server *Server) GetTokenForUser(email, password string) (token string, err error) {
-	user := model.User{}
-	err = server.DB.Model(model.User{}).Where("email = ?", email).Take(&user).Error
+	user, err := server.authenticate(email, password, "")
 	if err != nil {
 		return "", err
 	}
-	err = model.VerifyPassword(user.Password, password)
+	return auth.CreateToken(server.Keys, user.ID, user.Roles)
+}
+
+// authenticate loads the user with given email and verifies the password, unless the account or the client
+// at given address is locked after failed logins. All attempts are recorded. It returns errSecondFactorRequired
+// when the user has enabled two-factor authentication
+func (server *Server) authenticate(email, password, ip string) (model.User, error) {
+	user := model.User{}
+	err := server.checkLockout(email, ip)
 	if err != nil {
-		return "", err
+		return user, err
+	}
+
+	err = server.Storage.Find(&user, model.Query{
+		Filters: map[string]interface{}{"email": email},
+	})
+	if err == nil {
+		err = model.VerifyPassword(user.Password, password)
+	}
+	if err != nil {
+		server.audit(email, ip, model.OutcomeFailure)
+		return user, err
+	}
+
+	enabled, err := server.twoFactorEnabled(user.ID)
+	if err != nil {
+		return user, err
+	}
+	if enabled {
+		// The login succeeds when the challenge is exchanged with valid code
+		server.audit(email, ip, model.OutcomeChallenged)
+		return user, errSecondFactorRequired
 	}
-	return auth.CreateToken(user.ID)
+	server.audit(email, ip, model.OutcomeSuccess)
+	return user, nil
 }
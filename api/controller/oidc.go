@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// oidcCookie keeps the state of the login between the redirect and the callback
+	oidcCookie = "oidc_login"
+
+	// oidcLoginTTL is how long the user has to authenticate at the identity provider
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// errOIDCNotConfigured is returned when OIDC_ISSUER is not set
+var errOIDCNotConfigured = errors.New("OIDC login is not configured")
+
+// oidcLogin is the signed content of the login cookie
+type oidcLogin struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// provider returns the configured identity provider, it writes the error response and returns nil when it is not available
+func (server *Server) provider(w http.ResponseWriter) *auth.Provider {
+	result, err := server.providers.Configured()
+	if err != nil {
+		log.Println("error when discovering the identity provider:", err)
+		response.ERROR(w, http.StatusBadGateway, errors.New(http.StatusText(http.StatusBadGateway)))
+		return nil
+	}
+	if result == nil {
+		response.ERROR(w, http.StatusNotFound, errOIDCNotConfigured)
+		return nil
+	}
+	return result
+}
+
+// LogInOIDC redirects the user to the identity provider
+func (server *Server) LogInOIDC(w http.ResponseWriter, r *http.Request) {
+	identityProvider := server.provider(w)
+	if identityProvider == nil {
+		return
+	}
+
+	login := oidcLogin{ExpiresAt: time.Now().UTC().Add(oidcLoginTTL)}
+	var err error
+	for _, value := range []*string{&login.State, &login.Nonce} {
+		*value, err = auth.RandomString(16)
+		if err != nil {
+			response.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	login.Verifier, _, err = auth.NewPKCE()
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	data, err := json.Marshal(login)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    fmt.Sprintf("%s.%s", payload, sign(payload)),
+		Path:     "/login/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(identityProvider.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, identityProvider.AuthCodeURL(login.State, login.Nonce, login.Verifier), http.StatusFound)
+}
+
+// readLogin verifies the login cookie and returns its content
+func readLogin(r *http.Request) (oidcLogin, error) {
+	login := oidcLogin{}
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return login, fmt.Errorf("missing login state")
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(sign(parts[0]))) {
+		return login, fmt.Errorf("invalid login state")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return login, fmt.Errorf("invalid login state")
+	}
+	err = json.Unmarshal(data, &login)
+	if err != nil {
+		return login, fmt.Errorf("invalid login state")
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return login, fmt.Errorf("expired login state")
+	}
+	return login, nil
+}
+
+// OIDCCallback exchanges the authorization code for ID token and returns the tokens of the user it identifies
+func (server *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// The state is used only once
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/login/oidc", MaxAge: -1, HttpOnly: true})
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		response.ERROR(w, http.StatusUnauthorized, fmt.Errorf("%s %s", query.Get("error"), query.Get("error_description")))
+		return
+	}
+	login, err := readLogin(r)
+	if err != nil {
+		response.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if query.Get("state") == "" || !hmac.Equal([]byte(query.Get("state")), []byte(login.State)) {
+		response.ERROR(w, http.StatusUnauthorized, errors.New("invalid login state"))
+		return
+	}
+
+	identityProvider := server.provider(w)
+	if identityProvider == nil {
+		return
+	}
+	identity, err := identityProvider.Exchange(query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		log.Println("error when verifying the identity:", err)
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	user, status, err := server.identityUser(identity)
+	if err != nil {
+		response.ERROR(w, status, err)
+		return
+	}
+	server.audit(user.Email, clientIP(r), model.OutcomeSuccess)
+
+	family, err := uuid.NewV4()
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	result, err := server.issueTokens(user, family)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// identityUser returns the user linked to the identity. The identity is linked to the user with
+// the same email, when both the identity provider and the user verified it, and a new user is
+// created when there is no user with the email. On error it returns the status of the response
+func (server *Server) identityUser(identity auth.Identity) (model.User, int, error) {
+	user := model.User{}
+	link := model.Identity{}
+	err := server.Storage.Find(&link, model.Query{
+		Filters: map[string]interface{}{"issuer": identity.Issuer, "subject": identity.Subject},
+	})
+	if err == nil {
+		err = server.Storage.FindByID(&user, link.UserID)
+		if err != nil {
+			return user, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+		}
+		return user, http.StatusOK, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return user, http.StatusInternalServerError, err
+	}
+
+	if identity.Email == "" {
+		return user, http.StatusUnprocessableEntity, errors.New("identity provider returned no email")
+	}
+	err = server.Storage.Find(&user, model.Query{
+		Filters: map[string]interface{}{"email": identity.Email},
+	})
+	switch {
+	case err == nil && !identity.EmailVerified:
+		return user, http.StatusConflict, errors.New("email is used by other user and is not verified by the identity provider")
+	case err == nil && user.VerifiedEmail != user.Email:
+		// Anybody could have registered the email before its owner, the password of such user is not trusted
+		return user, http.StatusConflict, errors.New("email is used by other user that has not verified it, verify it and log in with password first")
+	case errors.Is(err, storage.ErrNotFound):
+		user, err = server.createIdentityUser(identity)
+		if err != nil {
+			return user, http.StatusUnprocessableEntity, err
+		}
+	case err != nil:
+		return user, http.StatusInternalServerError, err
+	}
+
+	err = server.Storage.Save(&model.Identity{UserID: user.ID, Issuer: identity.Issuer, Subject: identity.Subject})
+	if err != nil {
+		return user, http.StatusInternalServerError, err
+	}
+	return user, http.StatusOK, nil
+}
+
+// createIdentityUser creates user for the identity, with random password that is not known to anybody
+func (server *Server) createIdentityUser(identity auth.Identity) (model.User, error) {
+	password, err := auth.RandomString(32)
+	if err != nil {
+		return model.User{}, err
+	}
+	user := model.User{Name: identity.Name, Email: identity.Email, Password: password}
+	if identity.EmailVerified {
+		user.VerifiedEmail = identity.Email
+	}
+	if user.Name == "" || server.Storage.Find(&model.User{}, model.Query{Filters: map[string]interface{}{"name": user.Name}}) == nil {
+		// The name is unique, so the email is used when it is not provided or is already taken
+		user.Name = identity.Email
+	}
+	err = server.Storage.Save(&user)
+	return user, err
+}
@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/openapi"
+	"github.com/dzahariev/e2e-rest/api/policy"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/gorilla/mux"
+)
+
+// apiVersion is the version of the API in the OpenAPI document
+const apiVersion = "1.0.0"
+
+// Kinds of the lists returned by the routes
+const (
+	// noList is used for the routes that do not return lists
+	noList = iota
+	// pageList is used for the lists paged with limit and offset
+	pageList
+	// cursorList is used for the lists that can be streamed with cursor too
+	cursorList
+)
+
+// route documents single route registered in initializeRoutes
+type route struct {
+	// method and path are taken from the router
+	method  string
+	path    string
+	id      string
+	summary string
+	// request is the payload of the request, nil when there is no payload
+	request interface{}
+	// response is the payload of the response, []interface{} lists the alternatives, nil when there is no payload
+	response interface{}
+	status   int
+	list     int
+	public   bool
+	// versioned routes support the entity tags of the objects
+	versioned bool
+	// errors lists the statuses returned besides the ones that follow from the route
+	errors []int
+}
+
+// users is the user payload, the users and their managers see the contact details too
+var users = []interface{}{dto.UserSelf{}, dto.User{}}
+
+// routes documents the routes registered in initializeRoutes by their method and path template
+var routes = map[string]route{
+	"GET /":             {id: "home", summary: "Welcome message", response: "", status: http.StatusOK, public: true},
+	"GET /openapi.json": {id: "getOpenAPI", summary: "OpenAPI document of the API", response: map[string]interface{}{}, status: http.StatusOK, public: true},
+	"GET /docs":         {id: "getDocs", summary: "Documentation of the API", response: "", status: http.StatusOK, public: true},
+
+	"POST /login":                {id: "logIn", summary: "Log in with email and password, returns challenge when TOTP code is required", request: dto.Login{}, response: []interface{}{dto.Tokens{}, dto.Challenge{}}, status: http.StatusOK, public: true, errors: []int{http.StatusUnauthorized, http.StatusLocked, http.StatusTooManyRequests}},
+	"POST /login/totp":           {id: "logInTOTP", summary: "Complete the login with TOTP or recovery code", request: dto.TwoFactor{}, response: dto.Tokens{}, status: http.StatusOK, public: true, errors: []int{http.StatusUnauthorized, http.StatusLocked, http.StatusTooManyRequests}},
+	"GET /login/oidc":            {id: "logInOIDC", summary: "Redirect to the identity provider", status: http.StatusFound, public: true, errors: []int{http.StatusNotFound, http.StatusBadGateway}},
+	"GET /login/oidc/callback":   {id: "oidcCallback", summary: "Complete the login with the identity provider", response: dto.Tokens{}, status: http.StatusOK, public: true, errors: []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusBadGateway}},
+	"POST /token/refresh":        {id: "refreshToken", summary: "Exchange refresh token for new tokens", request: dto.Refresh{}, response: dto.Tokens{}, status: http.StatusOK, public: true, errors: []int{http.StatusUnauthorized}},
+	"POST /logout":               {id: "logOut", summary: "Revoke the access token and the refresh tokens of the login", request: dto.Refresh{}, status: http.StatusNoContent, errors: []int{http.StatusBadRequest}},
+	"GET /.well-known/jwks.json": {id: "getJWKS", summary: "Public keys that verify the tokens", response: auth.JWKS{}, status: http.StatusOK, public: true},
+	"POST /password/forgot":      {id: "forgotPassword", summary: "Send password reset email", request: dto.Account{}, status: http.StatusAccepted, public: true},
+	"POST /password/reset":       {id: "resetPassword", summary: "Reset the password with the token from the email", request: dto.Account{}, status: http.StatusNoContent, public: true, errors: []int{http.StatusUnauthorized}},
+
+	"POST /user":                         {id: "createUser", summary: "Register user", request: dto.UserCreate{}, response: dto.UserSelf{}, status: http.StatusCreated, public: true, errors: []int{http.StatusConflict}},
+	"POST /user/verify":                  {id: "verifyEmail", summary: "Verify the email with the token from the email", request: dto.Account{}, status: http.StatusNoContent, public: true, errors: []int{http.StatusUnauthorized}},
+	"GET /user":                          {id: "listUsers", summary: "List the users", response: users, status: http.StatusOK, list: pageList},
+	"GET /user/{id}":                     {id: "getUser", summary: "Get user", response: users, status: http.StatusOK, versioned: true},
+	"PUT /user/{id}":                     {id: "updateUser", summary: "Update user", request: dto.UserUpdate{}, response: users, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"PATCH /user/{id}":                   {id: "patchUser", summary: "Patch user", request: dto.UserUpdate{}, response: users, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"DELETE /user/{id}":                  {id: "deleteUser", summary: "Delete user", status: http.StatusNoContent, versioned: true, errors: []int{http.StatusConflict}},
+	"PUT /user/{id}/roles":               {id: "setUserRoles", summary: "Replace the roles of the user", request: dto.UserRoles{}, response: users, status: http.StatusOK, versioned: true},
+	"POST /user/{id}/restore":            {id: "restoreUser", summary: "Restore deleted user", response: users, status: http.StatusOK, errors: []int{http.StatusConflict}},
+	"POST /user/{id}/unlock":             {id: "unlockUser", summary: "Unlock user locked after failed logins", status: http.StatusNoContent},
+	"GET /user/{id}/login-attempt":       {id: "listUserLoginAttempts", summary: "List the login attempts of the user", response: dto.LoginAttempt{}, status: http.StatusOK, list: cursorList},
+	"POST /user/{id}/api-key":            {id: "createAPIKey", summary: "Create API key, the key is returned only once", request: dto.APIKeyCreate{}, response: dto.CreatedAPIKey{}, status: http.StatusCreated},
+	"GET /user/{id}/api-key":             {id: "listAPIKeys", summary: "List the API keys of the user", response: dto.APIKey{}, status: http.StatusOK, list: cursorList},
+	"DELETE /user/{id}/api-key/{key_id}": {id: "deleteAPIKey", summary: "Revoke API key", status: http.StatusNoContent},
+	"POST /user/{id}/totp":               {id: "enrollTOTP", summary: "Start TOTP enrollment", response: dto.Enrollment{}, status: http.StatusCreated, errors: []int{http.StatusConflict}},
+	"POST /user/{id}/totp/confirm":       {id: "confirmTOTP", summary: "Enable TOTP with the first code, returns the recovery codes", request: dto.TwoFactor{}, response: dto.RecoveryCodes{}, status: http.StatusOK, errors: []int{http.StatusConflict}},
+	"POST /user/{id}/totp/disable":       {id: "disableTOTP", summary: "Disable TOTP", request: dto.TwoFactor{}, status: http.StatusNoContent, errors: []int{http.StatusConflict}},
+	"POST /user/{id}/subscription":       {id: "createUserSubscription", summary: "Subscribe the user to session", request: dto.SubscriptionCreate{}, response: dto.Subscription{}, status: http.StatusCreated},
+	"GET /user/{id}/subscription":        {id: "listUserSubscriptions", summary: "List the subscriptions of the user", response: dto.Subscription{}, status: http.StatusOK, list: cursorList},
+
+	"POST /event":              {id: "createEvent", summary: "Create event", request: dto.EventCreate{}, response: dto.Event{}, status: http.StatusCreated, errors: []int{http.StatusConflict}},
+	"GET /event":               {id: "listEvents", summary: "List the events", response: dto.Event{}, status: http.StatusOK, list: pageList},
+	"GET /event/{id}":          {id: "getEvent", summary: "Get event", response: dto.Event{}, status: http.StatusOK, versioned: true},
+	"PUT /event/{id}":          {id: "updateEvent", summary: "Update event", request: dto.EventUpdate{}, response: dto.Event{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"PATCH /event/{id}":        {id: "patchEvent", summary: "Patch event", request: dto.EventUpdate{}, response: dto.Event{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"DELETE /event/{id}":       {id: "deleteEvent", summary: "Delete event with its sessions", status: http.StatusNoContent, versioned: true, errors: []int{http.StatusConflict}},
+	"POST /event/{id}/restore": {id: "restoreEvent", summary: "Restore deleted event", response: dto.Event{}, status: http.StatusOK, errors: []int{http.StatusConflict}},
+	"POST /event/{id}/session": {id: "createEventSession", summary: "Create session of the event", request: dto.SessionCreate{}, response: dto.Session{}, status: http.StatusCreated, errors: []int{http.StatusConflict}},
+	"GET /event/{id}/session":  {id: "listEventSessions", summary: "List the sessions of the event", response: dto.Session{}, status: http.StatusOK, list: pageList},
+
+	"POST /session":                   {id: "createSession", summary: "Create session", request: dto.SessionCreate{}, response: dto.Session{}, status: http.StatusCreated, errors: []int{http.StatusConflict}},
+	"GET /session":                    {id: "listSessions", summary: "List the sessions", response: dto.Session{}, status: http.StatusOK, list: pageList},
+	"GET /session/{id}":               {id: "getSession", summary: "Get session", response: dto.Session{}, status: http.StatusOK, versioned: true},
+	"PUT /session/{id}":               {id: "updateSession", summary: "Update session", request: dto.SessionUpdate{}, response: dto.Session{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"PATCH /session/{id}":             {id: "patchSession", summary: "Patch session", request: dto.SessionUpdate{}, response: dto.Session{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"DELETE /session/{id}":            {id: "deleteSession", summary: "Delete session", status: http.StatusNoContent, versioned: true, errors: []int{http.StatusConflict}},
+	"POST /session/{id}/restore":      {id: "restoreSession", summary: "Restore deleted session", response: dto.Session{}, status: http.StatusOK, errors: []int{http.StatusConflict}},
+	"POST /session/{id}/subscription": {id: "createSessionSubscription", summary: "Subscribe to the session", request: dto.SubscriptionCreate{}, response: dto.Subscription{}, status: http.StatusCreated},
+	"GET /session/{id}/subscription":  {id: "listSessionSubscriptions", summary: "List the subscriptions of the session", response: dto.Subscription{}, status: http.StatusOK, list: cursorList},
+	"POST /session/{id}/comment":      {id: "createSessionComment", summary: "Comment the session", request: dto.CommentCreate{}, response: dto.Comment{}, status: http.StatusCreated},
+	"GET /session/{id}/comment":       {id: "listSessionComments", summary: "List the comments of the session", response: dto.Comment{}, status: http.StatusOK, list: cursorList},
+
+	"POST /subscription":              {id: "createSubscription", summary: "Subscribe to session", request: dto.SubscriptionCreate{}, response: dto.Subscription{}, status: http.StatusCreated},
+	"GET /subscription":               {id: "listSubscriptions", summary: "List the subscriptions", response: dto.Subscription{}, status: http.StatusOK, list: cursorList},
+	"GET /subscription/{id}":          {id: "getSubscription", summary: "Get subscription", response: dto.Subscription{}, status: http.StatusOK, versioned: true},
+	"PUT /subscription/{id}":          {id: "updateSubscription", summary: "Update subscription", request: dto.SubscriptionUpdate{}, response: dto.Subscription{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"PATCH /subscription/{id}":        {id: "patchSubscription", summary: "Patch subscription", request: dto.SubscriptionUpdate{}, response: dto.Subscription{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"DELETE /subscription/{id}":       {id: "deleteSubscription", summary: "Delete subscription", status: http.StatusNoContent, versioned: true, errors: []int{http.StatusConflict}},
+	"POST /subscription/{id}/restore": {id: "restoreSubscription", summary: "Restore deleted subscription", response: dto.Subscription{}, status: http.StatusOK, errors: []int{http.StatusConflict}},
+
+	"POST /comment":              {id: "createComment", summary: "Comment session", request: dto.CommentCreate{}, response: dto.Comment{}, status: http.StatusCreated},
+	"GET /comment":               {id: "listComments", summary: "List the comments", response: dto.Comment{}, status: http.StatusOK, list: cursorList},
+	"GET /comment/{id}":          {id: "getComment", summary: "Get comment", response: dto.Comment{}, status: http.StatusOK, versioned: true},
+	"PUT /comment/{id}":          {id: "updateComment", summary: "Update comment", request: dto.CommentUpdate{}, response: dto.Comment{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"PATCH /comment/{id}":        {id: "patchComment", summary: "Patch comment", request: dto.CommentUpdate{}, response: dto.Comment{}, status: http.StatusOK, versioned: true, errors: []int{http.StatusConflict}},
+	"DELETE /comment/{id}":       {id: "deleteComment", summary: "Delete comment", status: http.StatusNoContent, versioned: true, errors: []int{http.StatusConflict}},
+	"POST /comment/{id}/restore": {id: "restoreComment", summary: "Restore deleted comment", response: dto.Comment{}, status: http.StatusOK, errors: []int{http.StatusConflict}},
+
+	"POST /purge": {id: "purgeDeleted", summary: "Remove permanently the objects deleted before the retention window", response: dto.Purge{}, status: http.StatusOK},
+}
+
+// pathParameter matches the parameters in the route templates
+var pathParameter = regexp.MustCompile(`{([^}]+)}`)
+
+// tags describe the groups of the routes, the routes are grouped by the first segment of their path
+var tags = []openapi.Tag{
+	{Name: "home", Description: "API root and documentation"},
+	{Name: "login", Description: "Login, tokens and account recovery"},
+	{Name: "user", Description: "Users, their roles, API keys and two-factor authentication"},
+	{Name: "event", Description: "Events"},
+	{Name: "session", Description: "Sessions of the events"},
+	{Name: "subscription", Description: "Subscriptions of the users to the sessions"},
+	{Name: "comment", Description: "Comments of the sessions"},
+	{Name: "maintenance", Description: "Maintenance of the stored objects"},
+}
+
+// tagOf returns the tag of the route
+func tagOf(path string) string {
+	segment := strings.Split(strings.TrimPrefix(path, "/"), "/")[0]
+	switch {
+	case path == "/user/verify":
+		return "login"
+	case segment == "user", segment == "event", segment == "session", segment == "subscription", segment == "comment":
+		return segment
+	case segment == "", segment == "openapi.json", segment == "docs":
+		return "home"
+	case segment == "purge":
+		return "maintenance"
+	}
+	return "login"
+}
+
+// OpenAPI returns the OpenAPI document that describes the routes of the router
+func (server *Server) OpenAPI() openapi.Document {
+	schemas := openapi.Schemas{}
+	document := openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "e2e-rest",
+			Description: "REST API of events, their sessions, the subscriptions and the comments of the users",
+			Version:     apiVersion,
+		},
+		Tags:  tags,
+		Paths: map[string]openapi.PathItem{},
+		Components: openapi.Components{
+			Schemas:   schemas,
+			Responses: map[string]*openapi.Response{},
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Access token from the login"},
+				"apiKey": {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "Personal API key limited to its scopes"},
+			},
+		},
+	}
+	schemas.Of(response.Problem{})
+
+	// The routes without documentation are listed too, with no summary, so the tests find them
+	server.Router.Walk(func(muxRoute *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := muxRoute.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := muxRoute.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			current, ok := routes[method+" "+path]
+			if !ok {
+				current = route{status: http.StatusOK}
+			}
+			current.method, current.path = method, path
+			if document.Paths[path] == nil {
+				document.Paths[path] = openapi.PathItem{}
+			}
+			document.Paths[path][strings.ToLower(method)] = current.operation(schemas, document.Components.Responses)
+		}
+		return nil
+	})
+	return document
+}
+
+// DocumentedRoutes returns the method and the path template of the documented routes, the tests check them against the router
+func DocumentedRoutes() []string {
+	keys := make([]string, 0, len(routes))
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// operation returns the OpenAPI operation of the route, the schemas and the error responses it uses are added to the components
+func (current route) operation(schemas openapi.Schemas, responses map[string]*openapi.Response) *openapi.Operation {
+	op := &openapi.Operation{
+		Tags:        []string{tagOf(current.path)},
+		Summary:     current.summary,
+		OperationID: current.id,
+		Responses:   map[string]*openapi.Response{},
+	}
+	statuses := append([]int{}, current.errors...)
+
+	for _, match := range pathParameter.FindAllStringSubmatch(current.path, -1) {
+		op.Parameters = append(op.Parameters, &openapi.Parameter{
+			Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"},
+		})
+		statuses = append(statuses, http.StatusBadRequest, http.StatusNotFound)
+	}
+	if current.list != noList {
+		op.Description = "The other query parameters filter the list by the fields of the objects"
+		op.Parameters = append(op.Parameters,
+			&openapi.Parameter{Name: "limit", In: "query", Description: "Size of the page", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+			&openapi.Parameter{Name: "offset", In: "query", Description: "Start of the page", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+			&openapi.Parameter{Name: "sort", In: "query", Description: "Comma separated fields, prefixed with - for descending order", Schema: &openapi.Schema{Type: "string"}},
+		)
+		if current.list == cursorList {
+			op.Parameters = append(op.Parameters,
+				&openapi.Parameter{Name: "cursor", In: "query", Description: "Cursor of the next page from next_cursor", Schema: &openapi.Schema{Type: "string"}})
+		}
+		statuses = append(statuses, http.StatusBadRequest)
+	}
+	if current.versioned {
+		if current.method == http.MethodGet {
+			op.Parameters = append(op.Parameters,
+				&openapi.Parameter{Name: "If-None-Match", In: "header", Description: "Entity tag of the cached object", Schema: &openapi.Schema{Type: "string"}})
+			op.Responses[strconv.Itoa(http.StatusNotModified)] = &openapi.Response{Description: http.StatusText(http.StatusNotModified)}
+		} else {
+			op.Parameters = append(op.Parameters,
+				&openapi.Parameter{Name: "If-Match", In: "header", Description: "Entity tag of the changed object", Schema: &openapi.Schema{Type: "string"}})
+			statuses = append(statuses, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+		}
+	}
+
+	if current.request != nil {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{}}
+		request := schemas.Of(current.request)
+		if current.method == http.MethodPatch {
+			op.RequestBody.Content[mergePatchType] = openapi.MediaType{Schema: request}
+			op.RequestBody.Content[jsonPatchType] = openapi.MediaType{Schema: &openapi.Schema{Type: "array", Items: schemas.Named("PatchOperation", operation{})}}
+			statuses = append(statuses, http.StatusUnsupportedMediaType)
+		} else {
+			op.RequestBody.Content["application/json"] = openapi.MediaType{Schema: request}
+		}
+		statuses = append(statuses, http.StatusUnprocessableEntity)
+	}
+
+	result := &openapi.Response{Description: http.StatusText(current.status)}
+	if current.response != nil {
+		schema := current.schema(schemas)
+		media := "application/json"
+		if current.path == "/docs" {
+			media = "text/html"
+		}
+		result.Content = map[string]openapi.MediaType{media: {Schema: schema}}
+	}
+	if current.status == http.StatusFound {
+		result.Headers = map[string]*openapi.Header{"Location": {Schema: &openapi.Schema{Type: "string"}}}
+	}
+	if current.status == http.StatusCreated {
+		result.Headers = map[string]*openapi.Header{"Location": {Description: "Location of the created object", Schema: &openapi.Schema{Type: "string"}}}
+	}
+	op.Responses[strconv.Itoa(current.status)] = result
+
+	if !current.public {
+		op.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+		op.Description = strings.TrimSpace(fmt.Sprintf("%s. %s", requirement(current.method, current.path), op.Description))
+		statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+	}
+
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		name := strings.ReplaceAll(http.StatusText(status), " ", "")
+		if _, ok := responses[name]; !ok {
+			responses[name] = problemResponse(status)
+		}
+		op.Responses[strconv.Itoa(status)] = &openapi.Response{Ref: "#/components/responses/" + name}
+	}
+	if _, ok := responses["InternalServerError"]; !ok {
+		responses["InternalServerError"] = problemResponse(http.StatusInternalServerError)
+	}
+	op.Responses["default"] = &openapi.Response{Ref: "#/components/responses/InternalServerError"}
+
+	return op
+}
+
+// schema returns the schema of the response payload
+func (current route) schema(schemas openapi.Schemas) *openapi.Schema {
+	item := current.response
+	var schema *openapi.Schema
+	if alternatives, ok := current.response.([]interface{}); ok {
+		schema = &openapi.Schema{}
+		for _, alternative := range alternatives {
+			schema.OneOf = append(schema.OneOf, schemas.Of(alternative))
+			item = alternative
+		}
+	} else {
+		schema = schemas.Of(current.response)
+	}
+	if current.list == noList {
+		return schema
+	}
+
+	return schemas.Define(reflect.TypeOf(item).Name()+"List", &openapi.Schema{AllOf: []*openapi.Schema{
+		schemas.Of(dto.List{}),
+		{Type: "object", Properties: map[string]*openapi.Schema{"data": {Type: "array", Items: schema}}},
+	}})
+}
+
+// requirement describes who can call the route
+func requirement(method string, path string) string {
+	permission, ok := policy.Required(method, path)
+	if !ok {
+		return "Allowed to every authenticated user"
+	}
+	return fmt.Sprintf("Requires the permission %s", permission)
+}
+
+// problemResponse returns the error response with given status
+func problemResponse(status int) *openapi.Response {
+	problem := &openapi.Response{
+		Description: http.StatusText(status),
+		Content:     map[string]openapi.MediaType{response.ProblemType: {Schema: openapi.Ref("Problem")}},
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusLocked {
+		problem.Headers = map[string]*openapi.Header{"Retry-After": {Description: "Seconds to wait before the next login", Schema: &openapi.Schema{Type: "integer"}}}
+	}
+	return problem
+}
+
+// GetOpenAPI returns the OpenAPI document of the API
+func (server *Server) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	response.JSON(w, http.StatusOK, server.OpenAPI())
+}
+
+const (
+	// redocScript is the pinned Redoc bundle that shows the document
+	redocScript = "https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"
+
+	// redocIntegrity is the subresource integrity hash of redocScript, make redoc-integrity writes it
+	redocIntegrity = ""
+)
+
+// docsPage shows the OpenAPI document with Redoc
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <title>e2e-rest API</title>
+    <meta charset="utf-8"/>
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+  </head>
+  <body>
+    <redoc spec-url="/openapi.json"></redoc>
+    <script src="{{.Script}}"{{if .Integrity}} integrity="{{.Integrity}}"{{end}} crossorigin="anonymous"></script>
+  </body>
+</html>
+`))
+
+// GetDocs returns the page that shows the OpenAPI document
+func (server *Server) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	err := docsPage.Execute(w, struct{ Script, Integrity string }{redocScript, redocIntegrity})
+	if err != nil {
+		log.Println("error when writing the documentation page:", err)
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/middleware"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/gofrs/uuid"
+)
+
+// author loads the user of the token, that becomes the author of the created objects
+func (server *Server) author(w http.ResponseWriter, r *http.Request) (model.User, bool) {
+	user := model.User{}
+	userID, _ := r.Context().Value(middleware.KeyUserID).(uuid.UUID)
+	err := server.Storage.FindByID(&user, userID)
+	if err != nil {
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return user, false
+	}
+	return user, true
+}
+
+// checkOwner verifies that the user of the token is the owner of the object
+// or has the permission to change the objects of all users
+func checkOwner(w http.ResponseWriter, r *http.Request, ownerID uuid.UUID, permission policy.Permission) bool {
+	if r.Context().Value(middleware.KeyUserID) == ownerID || middleware.Allowed(r, permission) {
+		return true
+	}
+	response.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+	return false
+}
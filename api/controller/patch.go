@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dzahariev/e2e-rest/api/response"
+)
+
+const (
+	// mergePatchType is the media type of JSON Merge Patch (RFC 7396)
+	mergePatchType = "application/merge-patch+json"
+
+	// jsonPatchType is the media type of JSON Patch (RFC 6902)
+	jsonPatchType = "application/json-patch+json"
+)
+
+// errTestFailed is returned when the test operation of JSON Patch does not match the document
+var errTestFailed = errors.New("patch test operation failed")
+
+// operation is a single operation of JSON Patch
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// applyPatch applies the patch from the request body to the update payload of the current object and stores
+// the result in patched payload. It writes the error response and returns false when the patch can not be applied
+func applyPatch(w http.ResponseWriter, r *http.Request, current interface{}, patched interface{}) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != mergePatchType && mediaType != jsonPatchType) {
+		response.ERROR(w, http.StatusUnsupportedMediaType, fmt.Errorf("patch should be %s or %s", mergePatchType, jsonPatchType))
+		return false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+
+	document, err := toDocument(current)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if mediaType == mergePatchType {
+		var patch interface{}
+		err = json.Unmarshal(body, &patch)
+		if err == nil {
+			document = mergePatch(document, patch)
+		}
+	} else {
+		operations := []operation{}
+		err = json.Unmarshal(body, &operations)
+		if err == nil {
+			document, err = jsonPatch(document, operations)
+		}
+	}
+	if errors.Is(err, errTestFailed) {
+		response.ERROR(w, http.StatusConflict, err)
+		return false
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+
+	merged, err := json.Marshal(document)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	err = json.Unmarshal(merged, patched)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	return true
+}
+
+// toDocument returns the generic JSON representation of the payload
+func toDocument(payload interface{}) (interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	err = json.Unmarshal(data, &document)
+	return document, err
+}
+
+// mergePatch applies JSON Merge Patch to the document
+func mergePatch(document interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	target, ok := document.(map[string]interface{})
+	if !ok {
+		target = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		target[key] = mergePatch(target[key], value)
+	}
+	return target
+}
+
+// jsonPatch applies the operations of JSON Patch to the document
+func jsonPatch(document interface{}, operations []operation) (interface{}, error) {
+	for _, current := range operations {
+		path, err := parsePointer(current.Path)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if current.Op == "add" || current.Op == "replace" || current.Op == "test" {
+			if current.Value == nil {
+				return nil, fmt.Errorf("missing value for %s operation", current.Op)
+			}
+			err = json.Unmarshal(current.Value, &value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		switch current.Op {
+		case "add":
+			document, err = change(document, path, value, addValue)
+		case "remove":
+			document, err = change(document, path, nil, removeValue)
+		case "replace":
+			document, err = change(document, path, value, replaceValue)
+		case "move", "copy":
+			var from []string
+			from, err = parsePointer(current.From)
+			if err != nil {
+				return nil, err
+			}
+			value, err = find(document, from)
+			if err != nil {
+				return nil, err
+			}
+			if current.Op == "move" {
+				document, err = change(document, from, nil, removeValue)
+			} else {
+				value, err = copyValue(value)
+			}
+			if err == nil {
+				document, err = change(document, path, value, addValue)
+			}
+		case "test":
+			var found interface{}
+			found, err = find(document, path)
+			if err == nil && !reflect.DeepEqual(found, value) {
+				err = fmt.Errorf("%w: value at %s differs", errTestFailed, current.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown patch operation %q", current.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+// parsePointer returns the reference tokens of JSON Pointer (RFC 6901)
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex returns the array index of the token, that is valid up to given maximum
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+// find returns the value at the path in the document
+func find(document interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch current := document.(type) {
+		case map[string]interface{}:
+			value, ok := current[token]
+			if !ok {
+				return nil, fmt.Errorf("missing member %q", token)
+			}
+			document = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(current)-1)
+			if err != nil {
+				return nil, err
+			}
+			document = current[index]
+		default:
+			return nil, fmt.Errorf("missing member %q", token)
+		}
+	}
+	return document, nil
+}
+
+// copyValue returns a deep copy of the JSON value
+func copyValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// change applies the edit to the container of the last path token and returns the changed document
+func change(document interface{}, path []string, value interface{}, edit func(container interface{}, token string, value interface{}) (interface{}, error)) (interface{}, error) {
+	if len(path) == 0 {
+		if value == nil {
+			return nil, errors.New("the whole document can not be removed")
+		}
+		return value, nil
+	}
+	if len(path) == 1 {
+		return edit(document, path[0], value)
+	}
+
+	child, err := find(document, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = change(child, path[1:], value, edit)
+	if err != nil {
+		return nil, err
+	}
+	switch current := document.(type) {
+	case map[string]interface{}:
+		current[path[0]] = child
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(current)-1)
+		current[index] = child
+	}
+	return document, nil
+}
+
+// addValue adds the member to the object or inserts the element to the array
+func addValue(container interface{}, token string, value interface{}) (interface{}, error) {
+	switch current := container.(type) {
+	case map[string]interface{}:
+		current[token] = value
+		return current, nil
+	case []interface{}:
+		if token == "-" {
+			return append(current, value), nil
+		}
+		index, err := arrayIndex(token, len(current))
+		if err != nil {
+			return nil, err
+		}
+		current = append(current, nil)
+		copy(current[index+1:], current[index:])
+		current[index] = value
+		return current, nil
+	}
+	return nil, fmt.Errorf("can not add member %q to a value", token)
+}
+
+// removeValue removes the existing member of the object or element of the array
+func removeValue(container interface{}, token string, value interface{}) (interface{}, error) {
+	switch current := container.(type) {
+	case map[string]interface{}:
+		if _, ok := current[token]; !ok {
+			return nil, fmt.Errorf("missing member %q", token)
+		}
+		delete(current, token)
+		return current, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(current)-1)
+		if err != nil {
+			return nil, err
+		}
+		return append(current[:index], current[index+1:]...), nil
+	}
+	return nil, fmt.Errorf("missing member %q", token)
+}
+
+// replaceValue replaces the existing member of the object or element of the array
+func replaceValue(container interface{}, token string, value interface{}) (interface{}, error) {
+	container, err := removeValue(container, token, nil)
+	if err != nil {
+		return nil, err
+	}
+	return addValue(container, token, value)
+}
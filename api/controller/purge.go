@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+)
+
+// PurgeDeleted removes permanently the objects deleted before the retention window
+func (server *Server) PurgeDeleted(w http.ResponseWriter, r *http.Request) {
+	window, err := storage.Retention()
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	before := time.Now().Add(-window)
+	count, err := server.Storage.Purge(before)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, dto.Purge{Count: count, Before: before})
+}
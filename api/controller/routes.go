@@ -3,46 +3,91 @@ package controller
 import "github.com/dzahariev/e2e-rest/api/middleware"
 
 func (s *Server) initializeRoutes() {
+	s.Router.Use(middleware.ProblemInstance)
+	authenticated := middleware.Authentication{Keys: s.Keys, Denylist: s.revoked, APIKeys: s.apiKeyOwner}.Check
 
 	// Home Route
 	s.Router.HandleFunc("/", middleware.ContentTypeJSON(s.Home)).Methods("GET")
 
-	// Login Route
+	// Documentation routes
+	s.Router.HandleFunc("/openapi.json", middleware.ContentTypeJSON(s.GetOpenAPI)).Methods("GET")
+	s.Router.HandleFunc("/docs", s.GetDocs).Methods("GET")
+
+	// Login Routes
 	s.Router.HandleFunc("/login", middleware.ContentTypeJSON(s.LogIn)).Methods("POST")
+	s.Router.HandleFunc("/login/totp", middleware.ContentTypeJSON(s.LogInTOTP)).Methods("POST")
+	s.Router.HandleFunc("/login/oidc", s.LogInOIDC).Methods("GET")
+	s.Router.HandleFunc("/login/oidc/callback", middleware.ContentTypeJSON(s.OIDCCallback)).Methods("GET")
+	s.Router.HandleFunc("/token/refresh", middleware.ContentTypeJSON(s.RefreshToken)).Methods("POST")
+	s.Router.HandleFunc("/logout", middleware.ContentTypeJSON(authenticated(s.LogOut))).Methods("POST")
+	s.Router.HandleFunc("/.well-known/jwks.json", middleware.ContentTypeJSON(s.GetJWKS)).Methods("GET")
+
+	s.Router.HandleFunc("/password/forgot", middleware.ContentTypeJSON(s.ForgotPassword)).Methods("POST")
+	s.Router.HandleFunc("/password/reset", middleware.ContentTypeJSON(s.ResetPassword)).Methods("POST")
 
 	// User routes
 	s.Router.HandleFunc("/user", middleware.ContentTypeJSON(s.CreateUser)).Methods("POST")
-	s.Router.HandleFunc("/user", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetUsers))).Methods("GET")
-	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetUser))).Methods("GET")
-	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.UpdateUser))).Methods("PUT")
-	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.DeleteUser))).Methods("DELETE")
+	s.Router.HandleFunc("/user/verify", middleware.ContentTypeJSON(s.VerifyEmail)).Methods("POST")
+	s.Router.HandleFunc("/user", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetUsers)))).Methods("GET")
+	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetUser)))).Methods("GET")
+	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.UpdateUser)))).Methods("PUT")
+	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.PatchUser)))).Methods("PATCH")
+	s.Router.HandleFunc("/user/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DeleteUser)))).Methods("DELETE")
+	s.Router.HandleFunc("/user/{id}/roles", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.SetUserRoles)))).Methods("PUT")
+	s.Router.HandleFunc("/user/{id}/restore", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.RestoreUser)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/unlock", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.UnlockUser)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/login-attempt", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetUserLoginAttempts)))).Methods("GET")
+	s.Router.HandleFunc("/user/{id}/api-key", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateAPIKey)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/api-key", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetUserAPIKeys)))).Methods("GET")
+	s.Router.HandleFunc("/user/{id}/api-key/{key_id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DeleteAPIKey)))).Methods("DELETE")
+	s.Router.HandleFunc("/user/{id}/totp", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.EnrollTOTP)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/totp/confirm", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.ConfirmTOTP)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/totp/disable", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DisableTOTP)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/subscription", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateUserSubscription)))).Methods("POST")
+	s.Router.HandleFunc("/user/{id}/subscription", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetUserSubscriptions)))).Methods("GET")
 
 	// Event routes
-	s.Router.HandleFunc("/event", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.CreateEvent))).Methods("POST")
-	s.Router.HandleFunc("/event", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetEvents))).Methods("GET")
-	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetEvent))).Methods("GET")
-	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.UpdateEvent))).Methods("PUT")
-	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.DeleteEvent))).Methods("DELETE")
+	s.Router.HandleFunc("/event", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateEvent)))).Methods("POST")
+	s.Router.HandleFunc("/event", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetEvents)))).Methods("GET")
+	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetEvent)))).Methods("GET")
+	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.UpdateEvent)))).Methods("PUT")
+	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.PatchEvent)))).Methods("PATCH")
+	s.Router.HandleFunc("/event/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DeleteEvent)))).Methods("DELETE")
+	s.Router.HandleFunc("/event/{id}/restore", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.RestoreEvent)))).Methods("POST")
+	s.Router.HandleFunc("/event/{id}/session", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateEventSession)))).Methods("POST")
+	s.Router.HandleFunc("/event/{id}/session", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetEventSessions)))).Methods("GET")
 
 	// Session routes
-	s.Router.HandleFunc("/session", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.CreateSession))).Methods("POST")
-	s.Router.HandleFunc("/session", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetSessions))).Methods("GET")
-	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetSession))).Methods("GET")
-	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.UpdateSession))).Methods("PUT")
-	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.DeleteSession))).Methods("DELETE")
+	s.Router.HandleFunc("/session", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateSession)))).Methods("POST")
+	s.Router.HandleFunc("/session", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetSessions)))).Methods("GET")
+	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetSession)))).Methods("GET")
+	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.UpdateSession)))).Methods("PUT")
+	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.PatchSession)))).Methods("PATCH")
+	s.Router.HandleFunc("/session/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DeleteSession)))).Methods("DELETE")
+	s.Router.HandleFunc("/session/{id}/restore", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.RestoreSession)))).Methods("POST")
+	s.Router.HandleFunc("/session/{id}/subscription", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateSessionSubscription)))).Methods("POST")
+	s.Router.HandleFunc("/session/{id}/subscription", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetSessionSubscriptions)))).Methods("GET")
+	s.Router.HandleFunc("/session/{id}/comment", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateSessionComment)))).Methods("POST")
+	s.Router.HandleFunc("/session/{id}/comment", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetSessionComments)))).Methods("GET")
 
 	// Subscription routes
-	s.Router.HandleFunc("/subscription", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.CreateSubscription))).Methods("POST")
-	s.Router.HandleFunc("/subscription", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetSubscriptions))).Methods("GET")
-	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetSubscription))).Methods("GET")
-	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.UpdateSubscription))).Methods("PUT")
-	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.DeleteSubscription))).Methods("DELETE")
+	s.Router.HandleFunc("/subscription", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateSubscription)))).Methods("POST")
+	s.Router.HandleFunc("/subscription", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetSubscriptions)))).Methods("GET")
+	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetSubscription)))).Methods("GET")
+	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.UpdateSubscription)))).Methods("PUT")
+	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.PatchSubscription)))).Methods("PATCH")
+	s.Router.HandleFunc("/subscription/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DeleteSubscription)))).Methods("DELETE")
+	s.Router.HandleFunc("/subscription/{id}/restore", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.RestoreSubscription)))).Methods("POST")
 
 	// Comment routes
-	s.Router.HandleFunc("/comment", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.CreateComment))).Methods("POST")
-	s.Router.HandleFunc("/comment", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetComments))).Methods("GET")
-	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.GetComment))).Methods("GET")
-	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.UpdateComment))).Methods("PUT")
-	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(middleware.CheckAuthentication(s.DeleteComment))).Methods("DELETE")
+	s.Router.HandleFunc("/comment", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.CreateComment)))).Methods("POST")
+	s.Router.HandleFunc("/comment", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetComments)))).Methods("GET")
+	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.GetComment)))).Methods("GET")
+	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.UpdateComment)))).Methods("PUT")
+	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.PatchComment)))).Methods("PATCH")
+	s.Router.HandleFunc("/comment/{id}", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.DeleteComment)))).Methods("DELETE")
+	s.Router.HandleFunc("/comment/{id}/restore", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.RestoreComment)))).Methods("POST")
 
+	// Maintenance routes
+	s.Router.HandleFunc("/purge", middleware.ContentTypeJSON(authenticated(middleware.CheckPermission(s.PurgeDeleted)))).Methods("POST")
 }
@@ -2,12 +2,16 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
 )
@@ -20,52 +24,73 @@ func (server *Server) CreateSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session := model.Session{}
-	err = json.Unmarshal(body, &session)
+	payload := dto.SessionCreate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = session.Validate("update")
+	session := model.Session{Name: payload.Name}
+	if !server.resolve(w, &session.Event, payload.Event) {
+		return
+	}
+	session.EventID = session.Event.ID
+
+	author, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+	session.User = author
+	session.UserID = author.ID
+
+	err = session.Validate(model.ActionCreate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = session.Save(server.DB)
-
+	err = server.Storage.Save(&session)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, session.ID))
-	response.JSON(w, http.StatusCreated, session)
+	w.Header().Set("Location", location(r, session.ID))
+	w.Header().Set("ETag", etag(session.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&session))
 }
 
-// GetSessions retrieves all sessions
+// GetSessions retrieves a page of sessions
 func (server *Server) GetSessions(w http.ResponseWriter, r *http.Request) {
-	var err error
 	session := model.Session{}
-	count, err := session.Count(server.DB)
+	query, err := parseQuery(r.URL.Query(), &session)
 	if err != nil {
-		response.ERROR(w, http.StatusInternalServerError, err)
+		response.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	data, err := session.FindAll(server.DB)
+	count, err := server.Storage.Count(&session, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	list := model.List{
-		Count: count,
-		Data:  *data,
+	data, err := server.Storage.FindAll(&session, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	response.JSON(w, http.StatusOK, list)
+	response.JSON(w, http.StatusOK, server.viewer(r).list(newList(r, query, count, data)))
 }
 
 // GetSession loads an session by given ID
@@ -77,12 +102,15 @@ func (server *Server) GetSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	session := model.Session{}
-	err = session.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&session, uid)
 	if err != nil {
 		response.ERROR(w, http.StatusNotFound, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, session)
+	if notModified(w, r, session.Version) {
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&session))
 }
 
 // UpdateSession updates existing session
@@ -100,27 +128,147 @@ func (server *Server) UpdateSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session := model.Session{}
-	err = json.Unmarshal(body, &session)
+	payload := dto.SessionUpdate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = session.Validate("update")
+	current := model.Session{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, current.UserID, policy.WriteAnySessions) {
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	session := model.Session{Name: payload.Name}
+	if !server.resolve(w, &session.Event, payload.Event) {
+		return
+	}
+	session.EventID = session.Event.ID
+
+	// The author is not changed
+	err = server.Storage.FindByID(&session.User, current.UserID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	session.UserID = current.UserID
+
+	err = session.Validate(model.ActionUpdate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
 	session.ID = uid
+	session.Version = current.Version
+
+	err = server.Storage.Update(&session)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&session, session.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(session.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&session))
+}
+
+// PatchSession updates the fields of existing session that are present in the patch
+func (server *Server) PatchSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current := model.Session{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, current.UserID, policy.WriteAnySessions) {
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	patched := dto.SessionUpdate{}
+	if !applyPatch(w, r, dto.SessionUpdate{Name: current.Name, Event: dto.Reference{ID: current.EventID}}, &patched) {
+		return
+	}
+
+	session := model.Session{Name: patched.Name}
+	if !server.resolve(w, &session.Event, patched.Event) {
+		return
+	}
+	session.EventID = session.Event.ID
 
-	err = session.Update(server.DB)
+	// The author is not changed
+	err = server.Storage.FindByID(&session.User, current.UserID)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, session)
+	session.UserID = current.UserID
+	session.Base = current.Base
+
+	err = session.Validate(model.ActionUpdate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Update(&session)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&session, session.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(session.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&session))
 }
 
 // DeleteSession deletes an session
@@ -134,13 +282,31 @@ func (server *Server) DeleteSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = session.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&session, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	if !checkOwner(w, r, session.UserID, policy.WriteAnySessions) {
+		return
+	}
+	if !checkPrecondition(w, r, session.Version) {
+		return
+	}
 
-	err = session.Delete(server.DB)
+	err = server.Storage.Delete(&session)
+	if errors.Is(err, storage.ErrReferenced) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -149,3 +315,132 @@ func (server *Server) DeleteSession(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Entity", fmt.Sprintf("%s", uid))
 	response.JSON(w, http.StatusNoContent, "")
 }
+
+// RestoreSession restores the deleted session
+func (server *Server) RestoreSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	session := model.Session{}
+	err = server.Storage.Restore(&session, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, storage.ErrDeletedParent) || errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&session))
+}
+
+// GetEventSessions retrieves a page of sessions of given event
+func (server *Server) GetEventSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	event := model.Event{}
+	err = server.Storage.FindByID(&event, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	session := model.Session{}
+	query, err := parseQuery(r.URL.Query(), &session)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	query.Filters["event_id"] = event.ID
+
+	count, err := server.Storage.Count(&session, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := server.Storage.FindAll(&session, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, server.viewer(r).list(newList(r, query, count, data)))
+}
+
+// CreateEventSession is caled to create an session for given event
+func (server *Server) CreateEventSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	event := model.Event{}
+	err = server.Storage.FindByID(&event, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	payload := dto.SessionCreate{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// The event is the one from the path
+	session := model.Session{Name: payload.Name}
+	session.Event = event
+	session.EventID = event.ID
+
+	author, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+	session.User = author
+	session.UserID = author.ID
+
+	err = session.Validate(model.ActionCreate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Save(&session)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", location(r, session.ID))
+	w.Header().Set("ETag", etag(session.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&session))
+}
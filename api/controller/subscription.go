@@ -2,12 +2,16 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
 )
@@ -20,52 +24,75 @@ func (server *Server) CreateSubscription(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	subscription := model.Subscription{}
-	err = json.Unmarshal(body, &subscription)
+	payload := dto.SubscriptionCreate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = subscription.Validate("update")
+	subscription := model.Subscription{}
+	if !server.resolve(w, &subscription.Session, payload.Session) {
+		return
+	}
+	subscription.SessionID = subscription.Session.ID
+
+	author, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+	subscription.User = author
+	subscription.UserID = author.ID
+
+	err = subscription.Validate(model.ActionCreate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = subscription.Save(server.DB)
-
+	err = server.Storage.Save(&subscription)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, subscription.ID))
-	response.JSON(w, http.StatusCreated, subscription)
+	w.Header().Set("Location", location(r, subscription.ID))
+	w.Header().Set("ETag", etag(subscription.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&subscription))
 }
 
-// GetSubscriptions retrieves all subscriptions
+// GetSubscriptions retrieves a page of subscriptions
 func (server *Server) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
-	var err error
 	subscription := model.Subscription{}
-	count, err := subscription.Count(server.DB)
+	query, err := parseCursorQuery(r, &subscription)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := server.cursorCount(&subscription, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	data, err := subscription.FindAll(server.DB)
+	data, err := server.Storage.FindAll(&subscription, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	list := model.List{
-		Count: count,
-		Data:  *data,
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	response.JSON(w, http.StatusOK, list)
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
 }
 
 // GetSubscription loads an subscription by given ID
@@ -77,12 +104,15 @@ func (server *Server) GetSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	subscription := model.Subscription{}
-	err = subscription.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&subscription, uid)
 	if err != nil {
 		response.ERROR(w, http.StatusNotFound, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, subscription)
+	if notModified(w, r, subscription.Version) {
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&subscription))
 }
 
 // UpdateSubscription updates existing subscription
@@ -100,27 +130,139 @@ func (server *Server) UpdateSubscription(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	subscription := model.Subscription{}
-	err = json.Unmarshal(body, &subscription)
+	payload := dto.SubscriptionUpdate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = subscription.Validate("update")
+	current := model.Subscription{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, current.UserID, policy.WriteAnySubscriptions) {
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	subscription := model.Subscription{}
+	if !server.resolve(w, &subscription.Session, payload.Session) {
+		return
+	}
+	subscription.SessionID = subscription.Session.ID
+
+	// The author is not changed
+	err = server.Storage.FindByID(&subscription.User, current.UserID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	subscription.UserID = current.UserID
+
+	err = subscription.Validate(model.ActionUpdate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
 	subscription.ID = uid
+	subscription.Version = current.Version
 
-	err = subscription.Update(server.DB)
+	err = server.Storage.Update(&subscription)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&subscription, subscription.ID)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, subscription)
+	w.Header().Set("ETag", etag(subscription.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&subscription))
+}
+
+// PatchSubscription updates the fields of existing subscription that are present in the patch
+func (server *Server) PatchSubscription(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	current := model.Subscription{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, current.UserID, policy.WriteAnySubscriptions) {
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
+	patched := dto.SubscriptionUpdate{}
+	if !applyPatch(w, r, dto.SubscriptionUpdate{Session: dto.Reference{ID: current.SessionID}}, &patched) {
+		return
+	}
+
+	subscription := model.Subscription{}
+	if !server.resolve(w, &subscription.Session, patched.Session) {
+		return
+	}
+	subscription.SessionID = subscription.Session.ID
+
+	// The author is not changed
+	err = server.Storage.FindByID(&subscription.User, current.UserID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	subscription.UserID = current.UserID
+	subscription.Base = current.Base
+
+	err = subscription.Validate(model.ActionUpdate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Update(&subscription)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&subscription, subscription.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(subscription.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&subscription))
 }
 
 // DeleteSubscription deletes an subscription
@@ -134,13 +276,31 @@ func (server *Server) DeleteSubscription(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = subscription.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&subscription, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	if !checkOwner(w, r, subscription.UserID, policy.WriteAnySubscriptions) {
+		return
+	}
+	if !checkPrecondition(w, r, subscription.Version) {
+		return
+	}
 
-	err = subscription.Delete(server.DB)
+	err = server.Storage.Delete(&subscription)
+	if errors.Is(err, storage.ErrReferenced) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -149,3 +309,238 @@ func (server *Server) DeleteSubscription(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Entity", fmt.Sprintf("%s", uid))
 	response.JSON(w, http.StatusNoContent, "")
 }
+
+// RestoreSubscription restores the deleted subscription
+func (server *Server) RestoreSubscription(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	subscription := model.Subscription{}
+	err = server.Storage.Restore(&subscription, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, storage.ErrDeletedParent) || errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&subscription))
+}
+
+// GetSessionSubscriptions retrieves a page of subscriptions of given session
+func (server *Server) GetSessionSubscriptions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	session := model.Session{}
+	err = server.Storage.FindByID(&session, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	subscription := model.Subscription{}
+	query, err := parseCursorQuery(r, &subscription)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	query.Filters["session_id"] = session.ID
+
+	count, err := server.cursorCount(&subscription, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := server.Storage.FindAll(&subscription, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
+}
+
+// CreateSessionSubscription is caled to create an subscription for given session
+func (server *Server) CreateSessionSubscription(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	session := model.Session{}
+	err = server.Storage.FindByID(&session, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	payload := dto.SubscriptionCreate{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// The session is the one from the path
+	subscription := model.Subscription{}
+	subscription.Session = session
+	subscription.SessionID = session.ID
+
+	author, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+	subscription.User = author
+	subscription.UserID = author.ID
+
+	err = subscription.Validate(model.ActionCreate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Save(&subscription)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", location(r, subscription.ID))
+	w.Header().Set("ETag", etag(subscription.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&subscription))
+}
+
+// GetUserSubscriptions retrieves a page of subscriptions of given user
+func (server *Server) GetUserSubscriptions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := model.User{}
+	err = server.Storage.FindByID(&user, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	subscription := model.Subscription{}
+	query, err := parseCursorQuery(r, &subscription)
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	query.Filters["user_id"] = user.ID
+
+	count, err := server.cursorCount(&subscription, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := server.Storage.FindAll(&subscription, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	list, err := newCursorList(r, query, count, data)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, server.viewer(r).list(list))
+}
+
+// CreateUserSubscription is caled to create an subscription for given user
+func (server *Server) CreateUserSubscription(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := model.User{}
+	err = server.Storage.FindByID(&user, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkOwner(w, r, user.ID, policy.WriteAnySubscriptions) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	payload := dto.SubscriptionCreate{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	subscription := model.Subscription{}
+	if !server.resolve(w, &subscription.Session, payload.Session) {
+		return
+	}
+	subscription.SessionID = subscription.Session.ID
+	subscription.User = user
+	subscription.UserID = user.ID
+
+	err = subscription.Validate(model.ActionCreate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Save(&subscription)
+	if errors.Is(err, storage.ErrMissingParent) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", location(r, subscription.ID))
+	w.Header().Set("ETag", etag(subscription.Version))
+	response.JSON(w, http.StatusCreated, server.viewer(r).view(&subscription))
+}
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/middleware"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	"github.com/gofrs/uuid"
+)
+
+// defaultRefreshTokenTTL is used when REFRESH_TOKEN_TTL is not configured
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// envDuration returns the positive duration configured in the environment variable or the default one
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	ttl, err := time.ParseDuration(strings.TrimSpace(os.Getenv(name)))
+	if err != nil || ttl <= 0 {
+		return defaultValue
+	}
+	return ttl
+}
+
+// hashToken returns the hash of the refresh token that is stored instead of the token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens creates access token and refresh token of given family for the user
+func (server *Server) issueTokens(user model.User, family uuid.UUID) (dto.Tokens, error) {
+	accessToken, err := auth.CreateToken(server.Keys, user.ID, user.Roles)
+	if err != nil {
+		return dto.Tokens{}, err
+	}
+
+	refreshToken, err := auth.RandomString(32)
+	if err != nil {
+		return dto.Tokens{}, err
+	}
+	err = server.Storage.Save(&model.RefreshToken{
+		UserID:    user.ID,
+		Family:    family,
+		Hash:      hashToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(envDuration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)),
+	})
+	if err != nil {
+		return dto.Tokens{}, err
+	}
+
+	return dto.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeFamily revokes all refresh tokens of the family
+func (server *Server) revokeFamily(family uuid.UUID) error {
+	data, err := server.Storage.FindAll(&model.RefreshToken{}, model.Query{
+		Filters: map[string]interface{}{"family": family},
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, object := range data {
+		token := object.(*model.RefreshToken)
+		if token.RevokedAt != nil {
+			continue
+		}
+		token.RevokedAt = &now
+		// Revoked regardless of concurrent changes
+		token.Version = 0
+		err = server.Storage.Update(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeUserTokens revokes all refresh tokens of the user
+func (server *Server) revokeUserTokens(userID uuid.UUID) error {
+	data, err := server.Storage.FindAll(&model.RefreshToken{}, model.Query{
+		Filters: map[string]interface{}{"user_id": userID},
+	})
+	if err != nil {
+		return err
+	}
+	families := map[uuid.UUID]bool{}
+	for _, object := range data {
+		token := object.(*model.RefreshToken)
+		if token.RevokedAt == nil && !families[token.Family] {
+			families[token.Family] = true
+			err = server.revokeFamily(token.Family)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// revoked checks if the access token with given ID is denied
+func (server *Server) revoked(jti string) (bool, error) {
+	err := server.Storage.Find(&model.RevokedToken{}, model.Query{
+		Filters: map[string]interface{}{"jti": jti},
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readRefreshRequest reads the refresh token from the request body
+func readRefreshRequest(r *http.Request) (dto.Refresh, error) {
+	payload := dto.Refresh{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return payload, err
+	}
+	if len(body) == 0 {
+		return payload, nil
+	}
+	err = json.Unmarshal(body, &payload)
+	return payload, err
+}
+
+// RefreshToken exchanges the refresh token for new access token and refresh token
+func (server *Server) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	payload, err := readRefreshRequest(r)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if payload.RefreshToken == "" {
+		response.ERROR(w, http.StatusUnprocessableEntity, errors.New("required refresh_token"))
+		return
+	}
+
+	token := model.RefreshToken{}
+	err = server.Storage.Find(&token, model.Query{
+		Filters: map[string]interface{}{"hash": hashToken(payload.RefreshToken)},
+	})
+	if err != nil {
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	now := time.Now().UTC()
+	if token.UsedAt != nil && token.RevokedAt == nil {
+		// Used token is presented again, so a copy of it was stolen
+		log.Printf("refresh token of family %s reused, revoking the family", token.Family)
+		err = server.revokeFamily(token.Family)
+		if err != nil {
+			response.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if !token.Active(now) {
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	token.UsedAt = &now
+	err = server.Storage.Update(&token)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		// The same token is used by concurrent request
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user := model.User{}
+	err = server.Storage.FindByID(&user, token.UserID)
+	if err != nil {
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	result, err := server.issueTokens(user, token.Family)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// LogOut denies the access token and revokes the family of the refresh token when it is provided
+func (server *Server) LogOut(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := r.Context().Value(middleware.KeyToken).(*jwt.Token)
+	if !ok {
+		response.ERROR(w, http.StatusBadRequest, errors.New("API keys are revoked by deleting them"))
+		return
+	}
+	payload, err := readRefreshRequest(r)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		token := model.RefreshToken{}
+		err = server.Storage.Find(&token, model.Query{
+			Filters: map[string]interface{}{"hash": hashToken(payload.RefreshToken)},
+		})
+		if err == nil && r.Context().Value(middleware.KeyUserID) == token.UserID {
+			err = server.revokeFamily(token.Family)
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			response.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	jti, expiresAt, err := auth.ExtractTokenID(accessToken)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if jti != "" {
+		err = server.Storage.Save(&model.RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+		if err != nil {
+			response.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	response.JSON(w, http.StatusNoContent, "")
+}
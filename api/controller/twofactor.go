@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/middleware"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultChallengeTTL is used when TWO_FACTOR_CHALLENGE_TTL is not configured
+	defaultChallengeTTL = 5 * time.Minute
+
+	// defaultTOTPIssuer is used when TOTP_ISSUER is not configured
+	defaultTOTPIssuer = "e2e-rest"
+
+	// recoveryCodeCount is the number of recovery codes created when TOTP is confirmed
+	recoveryCodeCount = 10
+)
+
+var (
+	// errSecondFactorRequired is returned by authenticate when the user has to provide TOTP code too
+	errSecondFactorRequired = errors.New("second factor required")
+
+	// errInvalidCode is returned for wrong TOTP codes and recovery codes
+	errInvalidCode = errors.New("invalid code")
+)
+
+// readTwoFactorRequest reads the payload from the request body
+func readTwoFactorRequest(w http.ResponseWriter, r *http.Request) (dto.TwoFactor, bool) {
+	payload := dto.TwoFactor{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return payload, false
+	}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			response.ERROR(w, http.StatusUnprocessableEntity, err)
+			return payload, false
+		}
+	}
+	return payload, true
+}
+
+// findTwoFactor loads the TOTP secret of the user
+func (server *Server) findTwoFactor(userID uuid.UUID) (model.TwoFactor, error) {
+	twoFactor := model.TwoFactor{}
+	err := server.Storage.Find(&twoFactor, model.Query{
+		Filters: map[string]interface{}{"user_id": userID},
+	})
+	return twoFactor, err
+}
+
+// twoFactorEnabled checks if the user has confirmed TOTP secret
+func (server *Server) twoFactorEnabled(userID uuid.UUID) (bool, error) {
+	twoFactor, err := server.findTwoFactor(userID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil && twoFactor.Status == model.TwoFactorEnabled, err
+}
+
+// issueChallenge creates the token that is exchanged with TOTP code for the tokens of the user
+func (server *Server) issueChallenge(user model.User) (dto.Challenge, error) {
+	token, err := auth.RandomString(32)
+	if err != nil {
+		return dto.Challenge{}, err
+	}
+	ttl := envDuration("TWO_FACTOR_CHALLENGE_TTL", defaultChallengeTTL)
+	err = server.Storage.Save(&model.ActionToken{
+		UserID:    user.ID,
+		Purpose:   model.PurposeTwoFactor,
+		Email:     user.Email,
+		Hash:      hashToken(token),
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return dto.Challenge{}, err
+	}
+	return dto.Challenge{ChallengeToken: token, TokenType: "challenge", ExpiresIn: int(ttl.Seconds())}, nil
+}
+
+// writeChallenge writes the response with new challenge token of the user
+func (server *Server) writeChallenge(w http.ResponseWriter, user model.User) {
+	result, err := server.issueChallenge(user)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// normalizeRecoveryCode drops the separators, so the codes can be typed without them
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// newRecoveryCodes replaces the recovery codes of the user
+func (server *Server) newRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	err := server.deleteRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	codes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := auth.NewTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(secret[:5] + "-" + secret[5:10])
+		err = server.Storage.Save(&model.RecoveryCode{UserID: userID, Hash: hashToken(normalizeRecoveryCode(code))})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// deleteRecoveryCodes deletes all recovery codes of the user
+func (server *Server) deleteRecoveryCodes(userID uuid.UUID) error {
+	data, err := server.Storage.FindAll(&model.RecoveryCode{}, model.Query{
+		Filters: map[string]interface{}{"user_id": userID},
+	})
+	if err != nil {
+		return err
+	}
+	for _, object := range data {
+		err = server.Storage.Delete(object)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSecondFactor verifies the TOTP code or uses the recovery code of the user. Each code is accepted once
+func (server *Server) checkSecondFactor(twoFactor *model.TwoFactor, payload dto.TwoFactor) error {
+	if payload.RecoveryCode != "" {
+		code := model.RecoveryCode{}
+		err := server.Storage.Find(&code, model.Query{
+			Filters: map[string]interface{}{"hash": hashToken(normalizeRecoveryCode(payload.RecoveryCode))},
+		})
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && (code.UserID != twoFactor.UserID || code.UsedAt != nil)) {
+			return errInvalidCode
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		code.UsedAt = &now
+		err = server.Storage.Update(&code)
+		if errors.Is(err, storage.ErrVersionMismatch) {
+			return errInvalidCode
+		}
+		return err
+	}
+
+	counter, ok := auth.ValidateTOTP(twoFactor.Secret, payload.Code, time.Now(), twoFactor.LastCounter)
+	if !ok {
+		return errInvalidCode
+	}
+	twoFactor.LastCounter = counter
+	err := server.Storage.Update(twoFactor)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		// The same code is used by concurrent request
+		return errInvalidCode
+	}
+	return err
+}
+
+// checkSelf verifies that the user of the token changes own two-factor authentication
+func checkSelf(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return uid, false
+	}
+	if r.Context().Value(middleware.KeyUserID) != uid {
+		response.ERROR(w, http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
+		return uid, false
+	}
+	return uid, true
+}
+
+// EnrollTOTP creates new TOTP secret for the user, that is used after it is confirmed
+func (server *Server) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, ok := checkSelf(w, r)
+	if !ok {
+		return
+	}
+	user, ok := server.author(w, r)
+	if !ok {
+		return
+	}
+
+	twoFactor, err := server.findTwoFactor(uid)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if twoFactor.Status == model.TwoFactorEnabled {
+		response.ERROR(w, http.StatusConflict, errors.New("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	twoFactor.UserID = uid
+	twoFactor.Secret = secret
+	twoFactor.Status = model.TwoFactorPending
+	if twoFactor.ID == uuid.Nil {
+		err = server.Storage.Save(&twoFactor)
+	} else {
+		err = server.Storage.Update(&twoFactor)
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	response.JSON(w, http.StatusCreated, dto.Enrollment{Secret: secret, URI: auth.TOTPURI(issuer, user.Email, secret)})
+}
+
+// ConfirmTOTP enables the enrolled TOTP secret with valid code and returns new recovery codes
+func (server *Server) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, ok := checkSelf(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := readTwoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	twoFactor, err := server.findTwoFactor(uid)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if twoFactor.Status != model.TwoFactorPending {
+		response.ERROR(w, http.StatusConflict, errors.New("two-factor authentication is not enrolled"))
+		return
+	}
+
+	err = server.checkSecondFactor(&twoFactor, dto.TwoFactor{Code: payload.Code})
+	if errors.Is(err, errInvalidCode) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	twoFactor.Status = model.TwoFactorEnabled
+	err = server.Storage.Update(&twoFactor)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	codes, err := server.newRecoveryCodes(uid)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, dto.RecoveryCodes{RecoveryCodes: codes})
+}
+
+// DisableTOTP disables the TOTP secret with valid code or recovery code
+func (server *Server) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, ok := checkSelf(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := readTwoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	twoFactor, err := server.findTwoFactor(uid)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if twoFactor.Status != model.TwoFactorEnabled {
+		response.ERROR(w, http.StatusConflict, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+
+	err = server.checkSecondFactor(&twoFactor, payload)
+	if errors.Is(err, errInvalidCode) {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	twoFactor.Status = model.TwoFactorDisabled
+	err = server.Storage.Update(&twoFactor)
+	if err == nil {
+		err = server.deleteRecoveryCodes(uid)
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusNoContent, "")
+}
+
+// LogInTOTP exchanges the challenge token returned by login and valid TOTP code or recovery code
+// for access token and refresh token
+func (server *Server) LogInTOTP(w http.ResponseWriter, r *http.Request) {
+	payload, ok := readTwoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+	if payload.Code == "" && payload.RecoveryCode == "" {
+		response.ERROR(w, http.StatusUnprocessableEntity, errors.New("required Code"))
+		return
+	}
+	token, user, ok := server.findActionToken(w, payload.ChallengeToken, model.PurposeTwoFactor)
+	if !ok {
+		return
+	}
+
+	ip := clientIP(r)
+	err := server.checkLockout(user.Email, ip)
+	locked := &lockedError{}
+	if errors.As(err, &locked) {
+		locked.write(w)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	twoFactor, err := server.findTwoFactor(user.ID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && twoFactor.Status != model.TwoFactorEnabled) {
+		// The two-factor authentication was disabled after the challenge was issued
+		response.ERROR(w, http.StatusUnauthorized, errors.New("two-factor authentication is not enabled, log in again"))
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.checkSecondFactor(&twoFactor, payload)
+	if errors.Is(err, errInvalidCode) {
+		server.audit(user.Email, ip, model.OutcomeFailure)
+		response.ERROR(w, http.StatusUnauthorized, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !server.markUsed(w, &token) {
+		return
+	}
+	server.audit(user.Email, ip, model.OutcomeSuccess)
+
+	family, err := uuid.NewV4()
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	result, err := server.issueTokens(user, family)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, result)
+}
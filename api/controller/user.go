@@ -7,9 +7,12 @@ import (
 	"io/ioutil"
 	"net/http"
 
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/middleware"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
 )
@@ -22,52 +25,61 @@ func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := model.User{}
-	err = json.Unmarshal(body, &user)
+	payload := dto.UserCreate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = user.Validate("update")
+	// Roles are granted only by admin
+	user := model.User{Name: payload.Name, Email: payload.Email, Password: payload.Password}
+
+	err = user.Validate(model.ActionCreate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	err = user.Save(server.DB)
-
+	err = server.Storage.Save(&user)
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	server.sendVerification(user)
 
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, user.ID))
-	response.JSON(w, http.StatusCreated, user)
+	w.Header().Set("Location", location(r, user.ID))
+	w.Header().Set("ETag", etag(user.Version))
+	// The registered user is the only one that sees it
+	response.JSON(w, http.StatusCreated, dto.NewUserSelf(user))
 }
 
-// GetUsers retrieves all users
+// GetUsers retrieves a page of users
 func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
-	var err error
 	user := model.User{}
-	count, err := user.Count(server.DB)
+	query, err := parseQuery(r.URL.Query(), &user)
 	if err != nil {
-		response.ERROR(w, http.StatusInternalServerError, err)
+		response.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	data, err := user.FindAll(server.DB)
+	count, err := server.Storage.Count(&user, query)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	list := model.List{
-		Count: count,
-		Data:  *data,
+	data, err := server.Storage.FindAll(&user, query)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	response.JSON(w, http.StatusOK, list)
+	response.JSON(w, http.StatusOK, server.viewer(r).list(newList(r, query, count, data)))
 }
 
 // GetUser loads an user by given ID
@@ -79,12 +91,15 @@ func (server *Server) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	user := model.User{}
-	err = user.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&user, uid)
 	if err != nil {
 		response.ERROR(w, http.StatusNotFound, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, user)
+	if notModified(w, r, user.Version) {
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&user))
 }
 
 // UpdateUser updates existing user
@@ -102,32 +117,189 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := model.User{}
-	err = json.Unmarshal(body, &user)
+	payload := dto.UserUpdate{}
+	err = json.Unmarshal(body, &payload)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	user := model.User{Name: payload.Name, Email: payload.Email, Password: payload.Password}
 
 	userIDFromContext := r.Context().Value(middleware.KeyUserID)
 	if userIDFromContext != uid {
 		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
-	err = user.Validate("update")
+	err = user.Validate(model.ActionUpdate)
 	if err != nil {
 		response.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
+	current := model.User{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+
 	user.ID = uid
+	user.Version = current.Version
+	user.Roles = nil
+
+	err = server.Storage.Update(&user)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&user, user.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if user.Email != current.Email {
+		server.sendVerification(user)
+	}
+	w.Header().Set("ETag", etag(user.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&user))
+}
+
+// PatchUser updates the fields of existing user that are present in the patch
+func (server *Server) PatchUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
 
-	err = user.Update(server.DB)
+	userIDFromContext := r.Context().Value(middleware.KeyUserID)
+	if userIDFromContext != uid {
+		response.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		return
+	}
+
+	current := model.User{}
+	err = server.Storage.FindByID(&current, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkPrecondition(w, r, current.Version) {
+		return
+	}
+	// The stored password hash is kept unless the patch sets new password
+	patched := dto.UserUpdate{}
+	if !applyPatch(w, r, dto.UserUpdate{Name: current.Name, Email: current.Email}, &patched) {
+		return
+	}
+	user := model.User{Name: patched.Name, Email: patched.Email, Password: patched.Password}
+	user.Base = current.Base
+	user.Roles = nil
+
+	err = user.Validate(model.ActionUpdate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Update(&user)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&user, user.ID)
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	response.JSON(w, http.StatusOK, user)
+	if user.Email != current.Email {
+		server.sendVerification(user)
+	}
+	w.Header().Set("ETag", etag(user.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&user))
+}
+
+// SetUserRoles replaces the roles of existing user
+func (server *Server) SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	payload := dto.UserRoles{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if len(payload.Roles) == 0 {
+		response.ERROR(w, http.StatusUnprocessableEntity, errors.New("required Roles"))
+		return
+	}
+
+	user := model.User{}
+	err = server.Storage.FindByID(&user, uid)
+	if err != nil {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if !checkPrecondition(w, r, user.Version) {
+		return
+	}
+
+	// The stored password hash is kept
+	user.Password = ""
+	user.Roles = payload.Roles
+	err = user.Validate(model.ActionUpdate)
+	if err != nil {
+		response.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = server.Storage.Update(&user)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = server.Storage.FindByID(&user, user.ID)
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", etag(user.Version))
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&user))
 }
 
 // DeleteUser deletes an user
@@ -146,13 +318,28 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = user.FindByID(server.DB, uid)
+	err = server.Storage.FindByID(&user, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	if !checkPrecondition(w, r, user.Version) {
+		return
+	}
 
-	err = user.Delete(server.DB)
+	err = server.Storage.Delete(&user)
+	if errors.Is(err, storage.ErrReferenced) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		response.ERROR(w, http.StatusPreconditionFailed, err)
+		return
+	}
 	if err != nil {
 		response.ERROR(w, http.StatusInternalServerError, err)
 		return
@@ -161,3 +348,33 @@ func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Entity", fmt.Sprintf("%s", uid))
 	response.JSON(w, http.StatusNoContent, "")
 }
+
+// RestoreUser restores the deleted user
+func (server *Server) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := uuid.FromString(vars["id"])
+	if err != nil {
+		response.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !checkOwner(w, r, uid, policy.ManageUsers) {
+		return
+	}
+
+	user := model.User{}
+	err = server.Storage.Restore(&user, uid)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, storage.ErrDeletedParent) || errors.Is(err, storage.ErrUnique) {
+		response.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, server.viewer(r).view(&user))
+}
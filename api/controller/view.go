@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/middleware"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/policy"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	"github.com/gofrs/uuid"
+)
+
+// location returns the location of the object created by the request
+func location(r *http.Request, id uuid.UUID) string {
+	return fmt.Sprintf("%s%s/%s", r.Host, r.URL.Path, id)
+}
+
+// viewer converts the stored objects to the views returned for the request.
+// The names of the referenced objects are loaded once per response
+type viewer struct {
+	server  *Server
+	request *http.Request
+	names   map[uuid.UUID]string
+}
+
+// viewer returns new viewer for the request
+func (server *Server) viewer(r *http.Request) *viewer {
+	return &viewer{server: server, request: r, names: map[uuid.UUID]string{}}
+}
+
+// self checks if the current user can see the contact details of the user
+func (v *viewer) self(userID uuid.UUID) bool {
+	return v.request.Context().Value(middleware.KeyUserID) == userID || middleware.Allowed(v.request, policy.ManageUsers)
+}
+
+// reference returns the reference to the related object with its name.
+// The object is loaded when it is not loaded already, the name is omitted when it can not be loaded
+func (v *viewer) reference(related model.Object, id uuid.UUID) dto.Reference {
+	if name, ok := v.names[id]; ok {
+		return dto.Reference{ID: id, Name: name}
+	}
+	if related.GetID() != id || displayName(related) == "" {
+		err := v.server.Storage.FindByID(related, id)
+		if err != nil {
+			v.names[id] = ""
+			return dto.Reference{ID: id}
+		}
+	}
+	v.names[id] = displayName(related)
+	return dto.Reference{ID: id, Name: v.names[id]}
+}
+
+// view returns the view of the object
+func (v *viewer) view(object model.Object) interface{} {
+	switch current := object.(type) {
+	case *model.User:
+		if v.self(current.ID) {
+			return dto.NewUserSelf(*current)
+		}
+		return dto.NewUser(*current)
+	case *model.Event:
+		return dto.NewEvent(*current)
+	case *model.Session:
+		session := *current
+		return dto.NewSession(session, v.reference(&session.User, session.UserID), v.reference(&session.Event, session.EventID))
+	case *model.Subscription:
+		subscription := *current
+		return dto.NewSubscription(subscription, v.reference(&subscription.User, subscription.UserID), v.reference(&subscription.Session, subscription.SessionID))
+	case *model.Comment:
+		comment := *current
+		return dto.NewComment(comment, v.reference(&comment.User, comment.UserID), v.reference(&comment.Session, comment.SessionID))
+	case *model.APIKey:
+		return dto.NewAPIKey(*current)
+	case *model.LoginAttempt:
+		return dto.NewLoginAttempt(*current)
+	}
+	return object
+}
+
+// list returns the page with the views of the objects
+func (v *viewer) list(list model.List) dto.List {
+	data := make([]interface{}, 0, len(list.Data))
+	for _, object := range list.Data {
+		data = append(data, v.view(object))
+	}
+	return dto.List{
+		Count:      list.Count,
+		Limit:      list.Limit,
+		Offset:     list.Offset,
+		Next:       list.Next,
+		Previous:   list.Previous,
+		NextCursor: list.NextCursor,
+		Data:       data,
+	}
+}
+
+// displayName returns the name the object is shown with in the references
+func displayName(object model.Object) string {
+	switch current := object.(type) {
+	case *model.User:
+		return current.Name
+	case *model.Event:
+		return current.Name
+	case *model.Session:
+		return current.Name
+	}
+	return ""
+}
+
+// resolve loads the object referenced in the payload. It writes the error response and returns false
+// when the object does not exist. Missing reference is left to the validation of the model
+func (server *Server) resolve(w http.ResponseWriter, object model.Object, reference dto.Reference) bool {
+	if reference.ID == uuid.Nil {
+		return true
+	}
+	err := server.Storage.FindByID(object, reference.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		response.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("unknown %s %s", reflect.TypeOf(object).Elem().Name(), reference.ID))
+		return false
+	}
+	if err != nil {
+		response.ERROR(w, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+)
+
+// APIKeyCreate is the payload of the API key creation, the key expires after the default period when expiry is not given
+type APIKeyCreate struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// APIKey is the view of the API key, without the key
+type APIKey struct {
+	Meta
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CreatedAPIKey is the view of created API key, the only one with the key
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// NewAPIKey returns the view of the API key
+func NewAPIKey(key model.APIKey) APIKey {
+	return APIKey{
+		Meta:       NewMeta(key.Base),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
@@ -0,0 +1,21 @@
+package dto
+
+import "github.com/dzahariev/e2e-rest/api/model"
+
+// LoginAttempt is the view of the audit record of login attempt
+type LoginAttempt struct {
+	Meta
+	Email   string `json:"email"`
+	IP      string `json:"ip"`
+	Outcome string `json:"outcome"`
+}
+
+// NewLoginAttempt returns the view of the login attempt
+func NewLoginAttempt(attempt model.LoginAttempt) LoginAttempt {
+	return LoginAttempt{
+		Meta:    NewMeta(attempt.Base),
+		Email:   attempt.Email,
+		IP:      attempt.IP,
+		Outcome: attempt.Outcome,
+	}
+}
@@ -0,0 +1,52 @@
+package dto
+
+// Login is the payload of the login with email and password
+type Login struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Tokens is the response of the login and the token refresh
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Refresh is the payload of the token refresh and the logout
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Challenge is the response of the login when TOTP code is required
+type Challenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	TokenType      string `json:"token_type"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+// TwoFactor is the payload of the TOTP routes
+type TwoFactor struct {
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// Enrollment is the response of the TOTP enrollment
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes is the response of the TOTP confirmation, the codes are shown only once
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Account is the payload of the password and the email verification routes
+type Account struct {
+	Email    string `json:"email,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Password string `json:"password,omitempty"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+import "github.com/dzahariev/e2e-rest/api/model"
+
+// CommentCreate is the payload of the comment creation, the author is the current user
+type CommentCreate struct {
+	Message string    `json:"message"`
+	Session Reference `json:"session"`
+}
+
+// CommentUpdate is the payload of the comment update
+type CommentUpdate CommentCreate
+
+// Comment is the view of the comment
+type Comment struct {
+	Meta
+	Message string    `json:"message"`
+	Author  Reference `json:"author"`
+	Session Reference `json:"session"`
+}
+
+// NewComment returns the view of the comment with the references to its author and session
+func NewComment(comment model.Comment, author Reference, session Reference) Comment {
+	return Comment{
+		Meta:    NewMeta(comment.Base),
+		Message: comment.Message,
+		Author:  author,
+		Session: session,
+	}
+}
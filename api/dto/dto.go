@@ -0,0 +1,48 @@
+// Package dto holds the request and response payloads of the API. They are decoupled from the
+// stored models, so the secrets and the internal foreign keys of the models are never serialized
+package dto
+
+import (
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/gofrs/uuid"
+)
+
+// Meta holds the technical fields of the returned objects
+type Meta struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int        `json:"version"`
+}
+
+// NewMeta returns the technical fields of the stored object
+func NewMeta(base model.Base) Meta {
+	return Meta{
+		ID:        base.ID,
+		CreatedAt: base.CreatedAt,
+		UpdatedAt: base.UpdatedAt,
+		DeletedAt: base.DeletedAt,
+		Version:   base.Version,
+	}
+}
+
+// Reference points to related object. Only the ID is read from the requests,
+// the name is returned in the responses so the clients can show it
+type Reference struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name,omitempty"`
+}
+
+// List is a page of returned objects with the paging metadata, the count is omitted on the pages after a cursor
+type List struct {
+	Count      *int          `json:"count,omitempty"`
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+	Next       string        `json:"next,omitempty"`
+	Previous   string        `json:"previous,omitempty"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Data       []interface{} `json:"data"`
+}
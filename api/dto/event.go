@@ -0,0 +1,28 @@
+package dto
+
+import "github.com/dzahariev/e2e-rest/api/model"
+
+// EventCreate is the payload of the event creation
+type EventCreate struct {
+	Name string `json:"name"`
+	Year string `json:"year"`
+}
+
+// EventUpdate is the payload of the event update
+type EventUpdate EventCreate
+
+// Event is the view of the event
+type Event struct {
+	Meta
+	Name string `json:"name"`
+	Year string `json:"year"`
+}
+
+// NewEvent returns the view of the event
+func NewEvent(event model.Event) Event {
+	return Event{
+		Meta: NewMeta(event.Base),
+		Name: event.Name,
+		Year: event.Year,
+	}
+}
@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+// Purge is the result of purging the deleted objects
+type Purge struct {
+	Count  int       `json:"count"`
+	Before time.Time `json:"before"`
+}
@@ -0,0 +1,30 @@
+package dto
+
+import "github.com/dzahariev/e2e-rest/api/model"
+
+// SessionCreate is the payload of the session creation, the author is the current user
+type SessionCreate struct {
+	Name  string    `json:"name"`
+	Event Reference `json:"event"`
+}
+
+// SessionUpdate is the payload of the session update
+type SessionUpdate SessionCreate
+
+// Session is the view of the session
+type Session struct {
+	Meta
+	Name   string    `json:"name"`
+	Author Reference `json:"author"`
+	Event  Reference `json:"event"`
+}
+
+// NewSession returns the view of the session with the references to its author and event
+func NewSession(session model.Session, author Reference, event Reference) Session {
+	return Session{
+		Meta:   NewMeta(session.Base),
+		Name:   session.Name,
+		Author: author,
+		Event:  event,
+	}
+}
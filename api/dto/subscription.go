@@ -0,0 +1,27 @@
+package dto
+
+import "github.com/dzahariev/e2e-rest/api/model"
+
+// SubscriptionCreate is the payload of the subscription creation, the user is the current one
+type SubscriptionCreate struct {
+	Session Reference `json:"session"`
+}
+
+// SubscriptionUpdate is the payload of the subscription update
+type SubscriptionUpdate SubscriptionCreate
+
+// Subscription is the view of the subscription
+type Subscription struct {
+	Meta
+	User    Reference `json:"user"`
+	Session Reference `json:"session"`
+}
+
+// NewSubscription returns the view of the subscription with the references to its user and session
+func NewSubscription(subscription model.Subscription, user Reference, session Reference) Subscription {
+	return Subscription{
+		Meta:    NewMeta(subscription.Base),
+		User:    user,
+		Session: session,
+	}
+}
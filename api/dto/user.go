@@ -0,0 +1,54 @@
+package dto
+
+import "github.com/dzahariev/e2e-rest/api/model"
+
+// UserCreate is the payload of the registration
+type UserCreate struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// UserUpdate is the payload of the user update, the password is changed only when it is provided
+type UserUpdate struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password,omitempty"`
+}
+
+// UserRoles is the payload of the roles change, the roles replace the current ones
+type UserRoles struct {
+	Roles model.Roles `json:"roles"`
+}
+
+// User is the public view of the user, returned to everyone
+type User struct {
+	Meta
+	Name  string      `json:"name"`
+	Roles model.Roles `json:"roles"`
+}
+
+// UserSelf is the view of the user returned to the user and to the user managers
+type UserSelf struct {
+	User
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// NewUser returns the public view of the user
+func NewUser(user model.User) User {
+	return User{
+		Meta:  NewMeta(user.Base),
+		Name:  user.Name,
+		Roles: user.Roles,
+	}
+}
+
+// NewUserSelf returns the view of the user with the contact details
+func NewUserSelf(user model.User) UserSelf {
+	return UserSelf{
+		User:          NewUser(user),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified(),
+	}
+}
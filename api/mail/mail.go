@@ -0,0 +1,139 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the emails
+type Mailer interface {
+	Send(message Message) error
+}
+
+// SMTP sends the emails through SMTP server
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// File writes the emails to files in the directory, one file per email
+type File struct {
+	Dir  string
+	From string
+}
+
+// Log writes the emails to the log, together with the links and the tokens they hold, so it is meant
+// only for development and tests
+type Log struct{}
+
+// counter makes the names of the files unique
+var counter uint64
+
+// Open creates the mailer configured with MAILER, that is smtp, file or log. There is no default,
+// as the log mailer would write the tokens of the emails to the log of the server
+func Open() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	switch kind := strings.TrimSpace(os.Getenv("MAILER")); kind {
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" || from == "" {
+			return nil, fmt.Errorf("SMTP_HOST and MAIL_FROM are required for smtp mailer")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "25"
+		}
+		return &SMTP{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("MAIL_DIR is required for file mailer")
+		}
+		return &File{Dir: dir, From: from}, nil
+	case "log":
+		log.Println("Emails are written to the log with their tokens, use log mailer only for development")
+		return Log{}, nil
+	case "":
+		return nil, fmt.Errorf("MAILER is required, set it to smtp, file or log for development")
+	default:
+		return nil, fmt.Errorf("unknown mailer %s", kind)
+	}
+}
+
+// format returns the message in Internet Message Format (RFC 5322)
+func format(from string, message Message) []byte {
+	return []byte(strings.Join([]string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", message.To),
+		fmt.Sprintf("Subject: %s", message.Subject),
+		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(message.Body, "\n", "\r\n"),
+	}, "\r\n"))
+}
+
+// check rejects the header values that would inject other headers
+func check(message Message) error {
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+	return nil
+}
+
+// Send sends the message through the SMTP server, with PLAIN authentication when the username is set
+func (s *SMTP) Send(message Message) error {
+	err := check(message)
+	if err != nil {
+		return err
+	}
+	var authentication smtp.Auth
+	if s.Username != "" {
+		authentication = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(s.Host, s.Port), authentication, s.From, []string{message.To}, format(s.From, message))
+}
+
+// Send writes the message to new .eml file
+func (f *File) Send(message Message) error {
+	err := check(message)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), atomic.AddUint64(&counter, 1))
+	return ioutil.WriteFile(filepath.Join(f.Dir, name), format(f.From, message), 0600)
+}
+
+// Send writes the message to the log
+func (Log) Send(message Message) error {
+	err := check(message)
+	if err != nil {
+		return err
+	}
+	log.Printf("mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
@@ -6,7 +6,10 @@ import (
 	"net/http"
 
 	"github.com/dzahariev/e2e-rest/api/auth"
+	"github.com/dzahariev/e2e-rest/api/policy"
 	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
 	"golang.org/x/net/context"
 )
 
@@ -19,8 +22,20 @@ const (
 
 	// KeyUserID is used to store user ID in context
 	KeyUserID Key = iota
+
+	// KeyRoles is used to store the roles of the user in context
+	KeyRoles Key = iota
+
+	// KeyScopes is used to store the scopes of the API key in context
+	KeyScopes Key = iota
 )
 
+// APIKeyHeader is the header with the API key of machine clients
+const APIKeyHeader = "X-API-Key"
+
+// ErrInvalidAPIKey is returned by Authentication.APIKeys for unknown and expired keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
 // ContentTypeJSON set the content type to JSON
 func ContentTypeJSON(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -29,10 +44,32 @@ func ContentTypeJSON(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// CheckAuthentication check the auhtorisation
-func CheckAuthentication(next http.HandlerFunc) http.HandlerFunc {
+// ProblemInstance makes the error responses refer to the path of the request
+func ProblemInstance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(response.WithInstance(w, r), r)
+	})
+}
+
+// Authentication checks the credentials of the requests against the state kept by the server
+type Authentication struct {
+	// Keys verify the access tokens, they are signed with API_SECRET when it is nil
+	Keys *auth.KeySet
+	// Denylist reports if the access token with given ID was revoked
+	Denylist func(jti string) (bool, error)
+	// APIKeys returns the user, the roles and the scopes of the API key
+	APIKeys func(key string) (userID uuid.UUID, roles []string, scopes []string, err error)
+}
+
+// Check checks the authorisation with bearer token or API key
+func (a Authentication) Check(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.ExtractJWTToken(r)
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			a.checkAPIKey(w, r, key, next)
+			return
+		}
+
+		token, err := auth.ExtractJWTToken(a.Keys, r)
 		if err != nil {
 			log.Println("error when extracting token:", err)
 			response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
@@ -44,6 +81,26 @@ func CheckAuthentication(next http.HandlerFunc) http.HandlerFunc {
 			response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 			return
 		}
+		jti, _, err := auth.ExtractTokenID(token)
+		if err != nil {
+			log.Println("error when extracting token ID:", err)
+			response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		if jti != "" && a.Denylist != nil {
+			revoked, err := a.Denylist(jti)
+			if err != nil {
+				log.Println("error when checking revoked token:", err)
+				response.ERROR(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+				return
+			}
+			if revoked {
+				log.Println("revoked token used:", jti)
+				response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+				return
+			}
+		}
+
 		// Adding Token to current request context
 		newContext := context.WithValue(r.Context(), KeyToken, token)
 
@@ -56,7 +113,72 @@ func CheckAuthentication(next http.HandlerFunc) http.HandlerFunc {
 
 		// Adding UserID to current request context
 		newContext = context.WithValue(newContext, KeyUserID, userID)
+
+		roles, err := auth.ExtractRoles(token)
+		if err != nil {
+			log.Println("error when extracting roles from token:", err)
+			response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+
+		// Adding Roles to current request context
+		newContext = context.WithValue(newContext, KeyRoles, roles)
 		r = r.WithContext(newContext)
 		next(w, r)
 	}
 }
+
+// checkAPIKey authenticates the request with API key, the user is limited to the scopes of the key
+func (a Authentication) checkAPIKey(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) {
+	if a.APIKeys == nil {
+		response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	userID, roles, scopes, err := a.APIKeys(key)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		log.Println("error when validating API key:", err)
+		response.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if err != nil {
+		log.Println("error when checking API key:", err)
+		response.ERROR(w, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+		return
+	}
+
+	newContext := context.WithValue(r.Context(), KeyUserID, userID)
+	newContext = context.WithValue(newContext, KeyRoles, roles)
+	newContext = context.WithValue(newContext, KeyScopes, scopes)
+	next(w, r.WithContext(newContext))
+}
+
+// CheckPermission check that the roles of the authenticated user have the permission required by the route
+func CheckPermission(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route, err := mux.CurrentRoute(r).GetPathTemplate()
+		if err != nil {
+			log.Println("error when getting the route:", err)
+			response.ERROR(w, http.StatusForbidden, errors.New("Forbidden"))
+			return
+		}
+		permission, ok := policy.Required(r.Method, route)
+		if !ok {
+			log.Printf("no policy for %s %s", r.Method, route)
+			response.ERROR(w, http.StatusForbidden, errors.New("Forbidden"))
+			return
+		}
+		if !Allowed(r, permission) {
+			response.ERROR(w, http.StatusForbidden, errors.New("Forbidden"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Allowed checks that the roles of the authenticated user have the permission,
+// and that it is in the scopes of the API key when the user is authenticated with one
+func Allowed(r *http.Request, permission policy.Permission) bool {
+	roles, _ := r.Context().Value(KeyRoles).([]string)
+	scopes, limited := r.Context().Value(KeyScopes).([]string)
+	return policy.Allowed(roles, permission) && (!limited || policy.InScope(scopes, permission))
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "create_tables",
+		Up:      createTables,
+		Down:    dropTables,
+	})
+}
+
+// createTables creates the users, events, sessions, subscriptions and comments tables,
+// existing tables created by the former automatic migration are kept as they are
+func createTables(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			name varchar(255) NOT NULL UNIQUE,
+			email varchar(100) NOT NULL UNIQUE,
+			password varchar(100) NOT NULL,
+			PRIMARY KEY (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS events (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			name varchar(255) NOT NULL UNIQUE,
+			year varchar(4) NOT NULL,
+			PRIMARY KEY (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			name varchar(255) NOT NULL UNIQUE,
+			user_id %[1]s,
+			event_id %[1]s,
+			PRIMARY KEY (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			user_id %[1]s,
+			session_id %[1]s,
+			PRIMARY KEY (id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS comments (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			message varchar(255) NOT NULL,
+			user_id %[1]s,
+			session_id %[1]s,
+			PRIMARY KEY (id)
+		)`,
+	}
+	for _, statement := range statements {
+		err := db.Exec(fmt.Sprintf(statement, t.uuid, t.timestamp, t.now)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropTables drops the tables created by createTables
+func dropTables(db *gorm.DB) error {
+	for _, table := range []string{"comments", "subscriptions", "sessions", "events", "users"} {
+		err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package migration
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "foreign_keys",
+		Up:      addForeignKeys,
+		Down:    dropForeignKeys,
+	})
+}
+
+// reference is a foreign key with the policy applied when the referenced row is deleted
+type reference struct {
+	table    string
+	column   string
+	parent   string
+	onDelete string
+}
+
+// name returns the constraint name
+func (r reference) name() string {
+	return fmt.Sprintf("%s_%s_fkey", r.table, r.column)
+}
+
+// clause returns the constraint definition
+func (r reference) clause() string {
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (id) ON DELETE %s", r.name(), r.column, r.parent, r.onDelete)
+}
+
+var references = []reference{
+	{table: "sessions", column: "event_id", parent: "events", onDelete: "CASCADE"},
+	{table: "sessions", column: "user_id", parent: "users", onDelete: "RESTRICT"},
+	{table: "subscriptions", column: "user_id", parent: "users", onDelete: "CASCADE"},
+	{table: "subscriptions", column: "session_id", parent: "sessions", onDelete: "CASCADE"},
+	{table: "comments", column: "user_id", parent: "users", onDelete: "CASCADE"},
+	{table: "comments", column: "session_id", parent: "sessions", onDelete: "CASCADE"},
+}
+
+// orphaned returns the condition matching the rows that refer to missing rows
+func (r reference) orphaned() string {
+	return fmt.Sprintf("%s NOT IN (SELECT id FROM %s)", r.column, r.parent)
+}
+
+// addForeignKeys adds the foreign key constraints. The rows referring to missing rows would violate them,
+// so the migration fails listing their count unless MIGRATE_DELETE_ORPHANS=true allows to delete them
+func addForeignKeys(db *gorm.DB) error {
+	deleteOrphans := os.Getenv("MIGRATE_DELETE_ORPHANS") == "true"
+	found := []string{}
+	for _, r := range references {
+		var count int
+		err := db.Table(r.table).Where(r.orphaned()).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			continue
+		}
+		if !deleteOrphans {
+			found = append(found, fmt.Sprintf("%d in %s.%s", count, r.table, r.column))
+			continue
+		}
+		result := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", r.table, r.orphaned()))
+		if result.Error != nil {
+			return result.Error
+		}
+		log.Printf("Deleted %d rows of %s referring to missing %s", result.RowsAffected, r.table, r.parent)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("rows referring to missing rows found (%s), fix them or set MIGRATE_DELETE_ORPHANS=true to delete them", strings.Join(found, ", "))
+	}
+
+	if db.Dialect().GetName() == "sqlite3" {
+		return rebuildTables(db, false)
+	}
+	for _, r := range references {
+		err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", r.table, r.clause())).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropForeignKeys drops the foreign key constraints
+func dropForeignKeys(db *gorm.DB) error {
+	if db.Dialect().GetName() == "sqlite3" {
+		return rebuildTables(db, true)
+	}
+	for _, r := range references {
+		err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", r.table, r.name())).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildTables adds or drops the constraints in SQLite by rebuilding the tables
+func rebuildTables(db *gorm.DB, drop bool) error {
+	for _, table := range []string{"sessions", "subscriptions", "comments"} {
+		err := rebuildTable(db, table, func(definition string) string {
+			for _, r := range references {
+				if r.table != table {
+					continue
+				}
+				if drop {
+					definition = strings.Replace(definition, ",\n"+r.clause(), "", 1)
+				} else {
+					end := strings.LastIndex(definition, ")")
+					definition = definition[:end] + ",\n" + r.clause() + definition[end:]
+				}
+			}
+			return definition
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
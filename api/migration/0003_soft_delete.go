@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "soft_delete",
+		Up:      addDeletedAt,
+		Down:    dropDeletedAt,
+	})
+}
+
+// softDeleteTables are the tables that keep the deleted rows until they are purged
+var softDeleteTables = []string{"users", "events", "sessions", "subscriptions", "comments"}
+
+// addDeletedAt adds the indexed deleted_at column
+func addDeletedAt(db *gorm.DB) error {
+	for _, table := range softDeleteTables {
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN deleted_at %s", table, types(db).timestamp),
+			fmt.Sprintf("CREATE INDEX idx_%[1]s_deleted_at ON %[1]s (deleted_at)", table),
+		}
+		for _, statement := range statements {
+			err := db.Exec(statement).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropDeletedAt drops the deleted_at column and its index
+func dropDeletedAt(db *gorm.DB) error {
+	for _, table := range softDeleteTables {
+		err := db.Exec(fmt.Sprintf("DROP INDEX IF EXISTS idx_%s_deleted_at", table)).Error
+		if err != nil {
+			return err
+		}
+		if db.Dialect().GetName() == "sqlite3" {
+			err = rebuildTable(db, table, func(definition string) string {
+				return strings.Replace(definition, fmt.Sprintf(", deleted_at %s", types(db).timestamp), "", 1)
+			})
+		} else {
+			err = db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS deleted_at", table)).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "version",
+		Up:      addVersion,
+		Down:    dropVersion,
+	})
+}
+
+// versionColumn is the definition of the column used for optimistic locking
+const versionColumn = "version integer NOT NULL DEFAULT 1"
+
+// versionTables are the tables with rows that are updated with optimistic locking
+var versionTables = []string{"users", "events", "sessions", "subscriptions", "comments"}
+
+// addVersion adds the version column
+func addVersion(db *gorm.DB) error {
+	for _, table := range versionTables {
+		err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, versionColumn)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropVersion drops the version column
+func dropVersion(db *gorm.DB) error {
+	for _, table := range versionTables {
+		var err error
+		if db.Dialect().GetName() == "sqlite3" {
+			err = rebuildTable(db, table, func(definition string) string {
+				return strings.Replace(definition, ", "+versionColumn, "", 1)
+			})
+		} else {
+			err = db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS version", table)).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package migration
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "roles",
+		Up:      addRoles,
+		Down:    dropRoles,
+	})
+}
+
+// rolesColumn is the definition of the column with comma separated roles of the user
+const rolesColumn = "roles varchar(255) NOT NULL DEFAULT 'attendee'"
+
+// addRoles adds the roles column, existing users become attendees
+func addRoles(db *gorm.DB) error {
+	return db.Exec("ALTER TABLE users ADD COLUMN " + rolesColumn).Error
+}
+
+// dropRoles drops the roles column
+func dropRoles(db *gorm.DB) error {
+	if db.Dialect().GetName() == "sqlite3" {
+		return rebuildTable(db, "users", func(definition string) string {
+			return strings.Replace(definition, ", "+rolesColumn, "", 1)
+		})
+	}
+	return db.Exec("ALTER TABLE users DROP COLUMN IF EXISTS roles").Error
+}
@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "tokens",
+		Up:      createTokenTables,
+		Down:    dropTokenTables,
+	})
+}
+
+// createTokenTables creates the refresh_tokens table and the revoked_tokens table that denies the access tokens
+func createTokenTables(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE refresh_tokens (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			user_id %[1]s,
+			family %[1]s NOT NULL,
+			hash varchar(64) NOT NULL UNIQUE,
+			expires_at %[2]s NOT NULL,
+			used_at %[2]s,
+			revoked_at %[2]s,
+			PRIMARY KEY (id),
+			CONSTRAINT refresh_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_refresh_tokens_deleted_at ON refresh_tokens (deleted_at)",
+		"CREATE INDEX idx_refresh_tokens_family ON refresh_tokens (family)",
+		fmt.Sprintf(`CREATE TABLE revoked_tokens (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			jti varchar(36) NOT NULL UNIQUE,
+			expires_at %[2]s NOT NULL,
+			PRIMARY KEY (id)
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_revoked_tokens_deleted_at ON revoked_tokens (deleted_at)",
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropTokenTables drops the tables created by createTokenTables
+func dropTokenTables(db *gorm.DB) error {
+	for _, table := range []string{"revoked_tokens", "refresh_tokens"} {
+		err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "identities",
+		Up:      createIdentityTable,
+		Down:    dropIdentityTable,
+	})
+}
+
+// createIdentityTable creates the identities table that links the users to the subjects of OpenID Connect issuers
+func createIdentityTable(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE identities (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			user_id %[1]s,
+			issuer varchar(255) NOT NULL,
+			subject varchar(255) NOT NULL,
+			PRIMARY KEY (id),
+			CONSTRAINT identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_identities_deleted_at ON identities (deleted_at)",
+		"CREATE UNIQUE INDEX idx_identities_issuer_subject ON identities (issuer, subject)",
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropIdentityTable drops the table created by createIdentityTable
+func dropIdentityTable(db *gorm.DB) error {
+	return db.Exec("DROP TABLE IF EXISTS identities").Error
+}
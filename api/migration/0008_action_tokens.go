@@ -0,0 +1,66 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "action_tokens",
+		Up:      createActionTokens,
+		Down:    dropActionTokens,
+	})
+}
+
+// verifiedEmailColumn is the definition of the column with the last email verified by the user
+const verifiedEmailColumn = "verified_email varchar(100)"
+
+// createActionTokens creates the action_tokens table with the password reset and email verification tokens
+// and adds the verified email of the users
+func createActionTokens(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE action_tokens (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			user_id %[1]s,
+			purpose varchar(32) NOT NULL,
+			email varchar(100) NOT NULL,
+			hash varchar(64) NOT NULL UNIQUE,
+			expires_at %[2]s NOT NULL,
+			used_at %[2]s,
+			PRIMARY KEY (id),
+			CONSTRAINT action_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_action_tokens_deleted_at ON action_tokens (deleted_at)",
+		"ALTER TABLE users ADD COLUMN " + verifiedEmailColumn,
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropActionTokens drops the action_tokens table and the verified email column
+func dropActionTokens(db *gorm.DB) error {
+	err := db.Exec("DROP TABLE IF EXISTS action_tokens").Error
+	if err != nil {
+		return err
+	}
+	if db.Dialect().GetName() == "sqlite3" {
+		return rebuildTable(db, "users", func(definition string) string {
+			return strings.Replace(definition, ", "+verifiedEmailColumn, "", 1)
+		})
+	}
+	return db.Exec("ALTER TABLE users DROP COLUMN IF EXISTS verified_email").Error
+}
@@ -0,0 +1,50 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "login_attempts",
+		Up:      createLoginAttempts,
+		Down:    dropLoginAttempts,
+	})
+}
+
+// createLoginAttempts creates the login_attempts table with the audit records of the logins,
+// the records are not removed together with the users
+func createLoginAttempts(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE login_attempts (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			email varchar(100) NOT NULL,
+			ip varchar(45),
+			outcome varchar(32) NOT NULL,
+			PRIMARY KEY (id)
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_login_attempts_deleted_at ON login_attempts (deleted_at)",
+		"CREATE INDEX idx_login_attempts_email ON login_attempts (email)",
+		"CREATE INDEX idx_login_attempts_ip ON login_attempts (ip)",
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropLoginAttempts drops the table created by createLoginAttempts
+func dropLoginAttempts(db *gorm.DB) error {
+	return db.Exec("DROP TABLE IF EXISTS login_attempts").Error
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "two_factor",
+		Up:      createTwoFactorTables,
+		Down:    dropTwoFactorTables,
+	})
+}
+
+// createTwoFactorTables creates the two_factors table with the TOTP secrets and the recovery_codes table
+func createTwoFactorTables(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE two_factors (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			user_id %[1]s NOT NULL UNIQUE,
+			secret varchar(64) NOT NULL,
+			status varchar(16) NOT NULL,
+			last_counter bigint NOT NULL DEFAULT 0,
+			PRIMARY KEY (id),
+			CONSTRAINT two_factors_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_two_factors_deleted_at ON two_factors (deleted_at)",
+		fmt.Sprintf(`CREATE TABLE recovery_codes (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			user_id %[1]s,
+			hash varchar(64) NOT NULL UNIQUE,
+			used_at %[2]s,
+			PRIMARY KEY (id),
+			CONSTRAINT recovery_codes_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_recovery_codes_deleted_at ON recovery_codes (deleted_at)",
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropTwoFactorTables drops the tables created by createTwoFactorTables
+func dropTwoFactorTables(db *gorm.DB) error {
+	for _, table := range []string{"recovery_codes", "two_factors"} {
+		err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package migration
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "api_keys",
+		Up:      createAPIKeys,
+		Down:    dropAPIKeys,
+	})
+}
+
+// createAPIKeys creates the api_keys table with the hashes of the personal API keys
+func createAPIKeys(db *gorm.DB) error {
+	t := types(db)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE api_keys (
+			id %[1]s,
+			created_at %[2]s DEFAULT %[3]s,
+			updated_at %[2]s DEFAULT %[3]s,
+			deleted_at %[2]s,
+			version integer NOT NULL DEFAULT 1,
+			user_id %[1]s,
+			name varchar(100) NOT NULL,
+			prefix varchar(16) NOT NULL,
+			hash varchar(64) NOT NULL UNIQUE,
+			scopes varchar(255) NOT NULL,
+			expires_at %[2]s NOT NULL,
+			last_used_at %[2]s,
+			PRIMARY KEY (id),
+			CONSTRAINT api_keys_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`, t.uuid, t.timestamp, t.now),
+		"CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at)",
+		"CREATE INDEX idx_api_keys_user_id ON api_keys (user_id)",
+	}
+	for _, statement := range statements {
+		err := db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropAPIKeys drops the table created by createAPIKeys
+func dropAPIKeys(db *gorm.DB) error {
+	return db.Exec("DROP TABLE IF EXISTS api_keys").Error
+}
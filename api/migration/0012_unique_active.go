@@ -0,0 +1,94 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "unique_active",
+		Up:      addActiveUniqueIndexes,
+		Down:    dropActiveUniqueIndexes,
+	})
+}
+
+// uniqueColumn is a unique column of table with soft deleted rows
+type uniqueColumn struct {
+	table      string
+	column     string
+	definition string
+}
+
+// uniqueColumns are the columns with values that are unique only among the rows that are not deleted
+var uniqueColumns = []uniqueColumn{
+	{table: "users", column: "name", definition: "varchar(255) NOT NULL"},
+	{table: "users", column: "email", definition: "varchar(100) NOT NULL"},
+	{table: "events", column: "name", definition: "varchar(255) NOT NULL"},
+	{table: "sessions", column: "name", definition: "varchar(255) NOT NULL"},
+}
+
+// addActiveUniqueIndexes replaces the unique constraints with partial unique indexes that skip the deleted rows.
+// The indexes keep the names of the constraints, so the violations are reported for the same columns
+func addActiveUniqueIndexes(db *gorm.DB) error {
+	for _, current := range uniqueColumns {
+		var err error
+		if db.Dialect().GetName() == "sqlite3" {
+			err = rebuildTable(db, current.table, func(definition string) string {
+				return strings.Replace(definition, current.column+" "+current.definition+" UNIQUE", current.column+" "+current.definition, 1)
+			})
+		} else {
+			err = db.Exec(fmt.Sprintf("ALTER TABLE %[1]s DROP CONSTRAINT IF EXISTS %[1]s_%[2]s_key", current.table, current.column)).Error
+		}
+		if err != nil {
+			return err
+		}
+		err = db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX %[1]s_%[2]s_key ON %[1]s (%[2]s) WHERE deleted_at IS NULL", current.table, current.column)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropActiveUniqueIndexes restores the unique constraints replaced by addActiveUniqueIndexes.
+// It fails when deleted rows share their values with other rows, these have to be purged first
+func dropActiveUniqueIndexes(db *gorm.DB) error {
+	duplicates := []string{}
+	for _, current := range uniqueColumns {
+		var count int
+		err := db.Table(current.table + " AS a").
+			Where(fmt.Sprintf("EXISTS (SELECT 1 FROM %[1]s b WHERE b.%[2]s = a.%[2]s AND b.id <> a.id)", current.table, current.column)).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			duplicates = append(duplicates, fmt.Sprintf("%d in %s.%s", count, current.table, current.column))
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("rows sharing unique values found (%s), purge the deleted ones first", strings.Join(duplicates, ", "))
+	}
+
+	for _, current := range uniqueColumns {
+		err := db.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %s_%s_key", current.table, current.column)).Error
+		if err != nil {
+			return err
+		}
+		if db.Dialect().GetName() == "sqlite3" {
+			err = rebuildTable(db, current.table, func(definition string) string {
+				return strings.Replace(definition, current.column+" "+current.definition, current.column+" "+current.definition+" UNIQUE", 1)
+			})
+		} else {
+			err = db.Exec(fmt.Sprintf("ALTER TABLE %[1]s ADD CONSTRAINT %[1]s_%[2]s_key UNIQUE (%[2]s)", current.table, current.column)).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// lockID identifies the Postgres advisory lock held while migrating
+const lockID = 4711
+
+// Migration is a single versioned change of the database schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db *gorm.DB) error
+	Down    func(db *gorm.DB) error
+}
+
+// Status describes a migration and the time it was applied, nil when it is pending
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a record in the schema_migrations table
+type schemaMigration struct {
+	Version   int `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName keeps the table name independent of GORM naming rules
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var migrations = []Migration{}
+
+// register adds migration to the ordered list of known migrations
+func register(migration Migration) {
+	migrations = append(migrations, migration)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// All returns the known migrations ordered by version
+func All() []Migration {
+	return append([]Migration{}, migrations...)
+}
+
+// String returns the version and the name of the migration
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Up applies all pending migrations and returns them
+func Up(db *gorm.DB) ([]Migration, error) {
+	applied := []Migration{}
+	err := locked(db, func(tx *gorm.DB, versions map[int]time.Time) error {
+		for _, migration := range migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			err := migration.Up(tx)
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %v", migration, err)
+			}
+			err = tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+			if err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return []Migration{}, err
+	}
+	return applied, nil
+}
+
+// Down reverts up to given number of the last applied migrations and returns them
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	reverted := []Migration{}
+	err := locked(db, func(tx *gorm.DB, versions map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			err := migration.Down(tx)
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %v", migration, err)
+			}
+			err = tx.Delete(&schemaMigration{Version: migration.Version}).Error
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	if err != nil {
+		return []Migration{}, err
+	}
+	return reverted, nil
+}
+
+// List returns the status of all known migrations
+func List(db *gorm.DB) ([]Status, error) {
+	statuses := []Status{}
+	err := locked(db, func(tx *gorm.DB, versions map[int]time.Time) error {
+		for _, migration := range migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return []Status{}, err
+	}
+	return statuses, nil
+}
+
+// locked runs the function in transaction that holds the migration lock,
+// so replicas started at the same time do not apply the migrations twice
+func locked(db *gorm.DB, run func(tx *gorm.DB, versions map[int]time.Time) error) error {
+	tx, end, err := begin(db)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	// SQLite transactions are opened with immediate lock, Postgres needs an advisory one
+	if db.Dialect().GetName() == "postgres" {
+		err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at %s NOT NULL
+	)`, types(db).timestamp)).Error
+	if err != nil {
+		return err
+	}
+
+	records := []schemaMigration{}
+	err = tx.Find(&records).Error
+	if err != nil {
+		return err
+	}
+	versions := map[int]time.Time{}
+	for _, record := range records {
+		versions[record.Version] = record.AppliedAt
+	}
+
+	err = run(tx, versions)
+	if err != nil {
+		return err
+	}
+
+	if db.Dialect().GetName() == "sqlite3" {
+		var table, parent string
+		var rowID sql.NullInt64
+		var foreignKey int
+		err = tx.Raw("PRAGMA foreign_key_check").Row().Scan(&table, &rowID, &parent, &foreignKey)
+		if err == nil {
+			return fmt.Errorf("foreign key check failed for table %s referencing %s", table, parent)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// begin starts the transaction used for migration and returns function that ends it.
+// SQLite foreign keys are switched off for the connection of the transaction, so the tables
+// can be rebuilt without triggering the delete actions, and are checked before commit instead
+func begin(db *gorm.DB) (*gorm.DB, func(), error) {
+	if db.Dialect().GetName() != "sqlite3" {
+		tx := db.Begin()
+		return tx, func() { tx.Rollback() }, tx.Error
+	}
+
+	ctx := context.Background()
+	conn, err := db.DB().Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	end := func() {
+		conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+		conn.Close()
+	}
+
+	sqlTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		end()
+		return nil, nil, err
+	}
+	tx, err := gorm.Open("sqlite3", sqlTx)
+	if err != nil {
+		sqlTx.Rollback()
+		end()
+		return nil, nil, err
+	}
+	return tx, func() {
+		sqlTx.Rollback()
+		end()
+	}, nil
+}
+
+// rebuildTable changes the definition of SQLite table, which can not be altered in place,
+// by copying the rows to new table created with the changed definition
+func rebuildTable(db *gorm.DB, table string, change func(definition string) string) error {
+	var definition string
+	err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Row().Scan(&definition)
+	if err != nil {
+		return err
+	}
+	indexes := []string{}
+	rows, err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var index string
+		err = rows.Scan(&index)
+		if err != nil {
+			return err
+		}
+		indexes = append(indexes, index)
+	}
+
+	definition = change(definition)
+	err = db.Exec(fmt.Sprintf("CREATE TABLE %s_new %s", table, definition[strings.Index(definition, "("):])).Error
+	if err != nil {
+		return err
+	}
+
+	columns := []string{}
+	err = db.Raw(fmt.Sprintf("SELECT name FROM pragma_table_info('%s_new')", table)).Pluck("name", &columns).Error
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		fmt.Sprintf("INSERT INTO %[1]s_new (%[2]s) SELECT %[2]s FROM %[1]s", table, strings.Join(columns, ", ")),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %[1]s_new RENAME TO %[1]s", table),
+	}
+	statements = append(statements, indexes...)
+	for _, statement := range statements {
+		err = db.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnTypes holds the column types that differ between the dialects
+type columnTypes struct {
+	uuid      string
+	timestamp string
+	now       string
+}
+
+// types returns the column types for the database dialect
+func types(db *gorm.DB) columnTypes {
+	if db.Dialect().GetName() == "sqlite3" {
+		// UUIDs are kept as text and the default time has the format the driver uses for time values
+		return columnTypes{
+			uuid:      "varchar(36)",
+			timestamp: "datetime",
+			now:       "(strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))",
+		}
+	}
+	return columnTypes{
+		uuid:      "uuid",
+		timestamp: "timestamp with time zone",
+		now:       "CURRENT_TIMESTAMP",
+	}
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Scopes is a set of permission names the API key is limited to, stored as comma separated list
+type Scopes []string
+
+// Has checks if the permission is one of the scopes
+func (s Scopes) Has(permission string) bool {
+	for _, current := range s {
+		if current == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the scopes as comma separated list
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+// Scan reads the scopes from comma separated list
+func (s *Scopes) Scan(value interface{}) error {
+	var list string
+	switch current := value.(type) {
+	case string:
+		list = current
+	case []byte:
+		list = string(current)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T as scopes", value)
+	}
+	*s = Scopes{}
+	for _, scope := range strings.Split(list, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			*s = append(*s, scope)
+		}
+	}
+	return nil
+}
+
+// APIKey is a named key that authenticates machine clients as the user, limited to the scopes.
+// Only its hash is stored, the key is shown once when it is created
+type APIKey struct {
+	Base
+	User       User       `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID     uuid.UUID  `json:"-" validate:"required"`
+	Name       string     `gorm:"size:100;not null" json:"name" validate:"required;max=100"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix" validate:"required;max=16"`
+	Hash       string     `gorm:"size:64;not null;unique" json:"-" validate:"required;max=64"`
+	Scopes     Scopes     `gorm:"size:255;not null" json:"scopes" validate:"required"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at" validate:"required;after=now@create;gtfield=CreatedAt"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// GetID returns the ID
+func (k *APIKey) GetID() uuid.UUID {
+	return k.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (k *APIKey) GetCreatedAt() time.Time {
+	return k.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (k *APIKey) SetCreatedAt(createdAt time.Time) {
+	k.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (k *APIKey) Fields() []string {
+	// the hash is left out, sorting by it would reveal its prefix. The keys are listed only for their user
+	return append(baseFields, "name", "prefix", "expires_at", "last_used_at")
+}
+
+// Validate checks structure consistency
+func (k *APIKey) Validate(action string) error {
+	return validate(k, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (k *APIKey) PrepareSave() error {
+	err := k.Prepare()
+	if err != nil {
+		return err
+	}
+	k.Name = strings.TrimSpace(k.Name)
+
+	return k.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (k *APIKey) PrepareUpdate() error {
+	if k.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved API key")
+	}
+
+	err := k.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	k.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// Active checks if the key can be used at given time
+func (k *APIKey) Active(now time.Time) bool {
+	return now.Before(k.ExpiresAt)
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// OutcomeSuccess is the outcome of login with valid credentials
+	OutcomeSuccess = "success"
+
+	// OutcomeFailure is the outcome of login with unknown email, wrong password or wrong TOTP code
+	OutcomeFailure = "failure"
+
+	// OutcomeChallenged is the outcome of login with valid password, that requires TOTP code too
+	OutcomeChallenged = "challenged"
+
+	// OutcomeLocked is the outcome of login to account that is locked after failed logins
+	OutcomeLocked = "locked"
+
+	// OutcomeRateLimited is the outcome of login from client that has too many failed logins
+	OutcomeRateLimited = "rate_limited"
+
+	// OutcomeUnlocked records that admin unlocked the account
+	OutcomeUnlocked = "unlocked"
+)
+
+// LoginAttempt is the audit record of a login, the failed logins since the last success lock the account
+type LoginAttempt struct {
+	Base
+	Email   string `gorm:"size:100;not null;index" json:"email" validate:"required;max=100"`
+	IP      string `gorm:"column:ip;size:45;index" json:"ip" validate:"max=45"`
+	Outcome string `gorm:"size:32;not null" json:"outcome" validate:"required;enum=outcome"`
+}
+
+// GetID returns the ID
+func (a *LoginAttempt) GetID() uuid.UUID {
+	return a.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (a *LoginAttempt) GetCreatedAt() time.Time {
+	return a.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (a *LoginAttempt) SetCreatedAt(createdAt time.Time) {
+	a.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (a *LoginAttempt) Fields() []string {
+	return append(baseFields, "email", "ip", "outcome")
+}
+
+// Validate checks structure consistency
+func (a *LoginAttempt) Validate(action string) error {
+	return validate(a, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (a *LoginAttempt) PrepareSave() error {
+	err := a.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return a.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (a *LoginAttempt) PrepareUpdate() error {
+	if a.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved login attempt")
+	}
+
+	err := a.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	a.UpdatedAt = time.Now()
+
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
 )
 
 // Object is an abstration of all Base objects
@@ -12,32 +11,34 @@ type Object interface {
 	GetID() uuid.UUID
 	GetCreatedAt() time.Time
 	SetCreatedAt(createdAt time.Time)
-	Save(db *gorm.DB) error
-	Count(db *gorm.DB) (int, error)
-	FindAll(db *gorm.DB) (*[]Object, error)
-	FindByID(db *gorm.DB, uid uuid.UUID) error
-	Update(db *gorm.DB) error
-	Delete(db *gorm.DB) error
+	Fields() []string
+	Validate(action string) error
+	PrepareSave() error
+	PrepareUpdate() error
 }
 
 // Base holds technical fields
 type Base struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;" json:"id"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt *time.Time `sql:"index" json:"deleted_at,omitempty"`
+	Version   int        `gorm:"not null;default:1" json:"version"`
 }
 
-// Prepare initilises techncal fields
+// Prepare initilises techncal fields, the ID is generated when it is not set
 func (b *Base) Prepare() error {
-	uuid, err := uuid.NewV4()
-	if err != nil {
-		return err
+	if b.ID == uuid.Nil {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return err
+		}
+		b.ID = id
 	}
-
-	b.ID = uuid
-	now := time.Now()
+	now := time.Now().UTC()
 	b.CreatedAt = now
 	b.UpdatedAt = now
+	b.Version = 1
 
 	return nil
 }
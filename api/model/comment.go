@@ -7,16 +7,15 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
 )
 
 // Comment represents an user comment in a session
 type Comment struct {
 	Base
-	Message   string `gorm:"size:255;not null" json:"message"`
-	User      User   `json:"author"`
+	Message   string `gorm:"size:255;not null" json:"message" validate:"required;max=255"`
+	User      User   `gorm:"constraint:OnDelete:CASCADE" json:"author" validate:"required"`
 	UserID    uuid.UUID
-	Session   Session `json:"session"`
+	Session   Session `gorm:"constraint:OnDelete:CASCADE" json:"session" validate:"required"`
 	SessionID uuid.UUID
 }
 
@@ -35,108 +34,40 @@ func (c *Comment) SetCreatedAt(createdAt time.Time) {
 	c.CreatedAt = createdAt
 }
 
+// Fields returns the fields that lists can be sorted and filtered by
+func (c *Comment) Fields() []string {
+	return append(baseFields, "message", "user_id", "session_id")
+}
+
 // Validate checks structure consistency
 func (c *Comment) Validate(action string) error {
-	// always check
-	if c.Message == "" {
-		return fmt.Errorf("required Message")
-	}
-
-	if c.User.Name == "" {
-		return fmt.Errorf("required Author")
-	}
-
-	if c.Session.Name == "" {
-		return fmt.Errorf("required Session")
-	}
-
-	return nil
+	return validate(c, action)
 }
 
-// Save saves the structure as new object
-func (c *Comment) Save(db *gorm.DB) error {
-	c.Prepare()
-	c.Message = html.EscapeString(strings.TrimSpace(c.Message))
-
-	err := c.Validate("update")
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (c *Comment) PrepareSave() error {
+	err := c.Prepare()
 	if err != nil {
 		return err
 	}
 
-	err = db.Create(&c).Error
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// FindAll returns all known objects of this type
-func (c *Comment) FindAll(db *gorm.DB) (*[]Object, error) {
-	entites := []Comment{}
-	err := db.Model(&c).Limit(100).Find(&entites).Error
-	if err != nil {
-		return &[]Object{}, err
-	}
-
-	objects := []Object{}
-	for _, currentEntity := range entites {
-		objects = append(objects, &currentEntity)
-	}
-	return &objects, nil
-}
-
-// Count returns count of all known objects of this type
-func (c *Comment) Count(db *gorm.DB) (int, error) {
-	var count int
-	err := db.Model(&c).Count(&count).Error
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
+	c.Message = html.EscapeString(strings.TrimSpace(c.Message))
 
-// FindByID returns an objects with corresponding ID if exists
-func (c *Comment) FindByID(db *gorm.DB, uid uuid.UUID) error {
-	err := db.Model(&c).Where("id = ?", uid).Take(&c).Error
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.Validate(ActionCreate)
 }
 
-// Update updates the existing objects
-func (c *Comment) Update(db *gorm.DB) error {
+// PrepareUpdate checks the structure before the existing object is updated
+func (c *Comment) PrepareUpdate() error {
 	if c.ID == uuid.Nil {
 		return fmt.Errorf("cannot update non saved comment")
 	}
 
-	err := c.Validate("update")
+	err := c.Validate(ActionUpdate)
 	if err != nil {
 		return err
 	}
 
-	err = db.Model(&c).Updates(Comment{
-		Message: c.Message,
-		User:    c.User,
-		Session: c.Session,
-		Base: Base{
-			UpdatedAt: time.Now(),
-		},
-	}).Error
+	c.UpdatedAt = time.Now()
 
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Delete is removing existing objects
-func (c *Comment) Delete(db *gorm.DB) error {
-	err := db.Delete(&c).Error
-	if err != nil {
-		return err
-	}
 	return nil
 }
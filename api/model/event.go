@@ -7,14 +7,13 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
 )
 
 // Event represents an event
 type Event struct {
 	Base
-	Name     string    `gorm:"size:255;not null;unique" json:"name"`
-	Year     string    `gorm:"size:4;not null" json:"year"`
+	Name     string    `gorm:"size:255;not null;unique" json:"name" validate:"required;max=255"`
+	Year     string    `gorm:"size:4;not null" json:"year" validate:"required@create;regex=^[0-9]{4}$"`
 	Sessions []Session `gorm:"foreignkey:EventID"`
 }
 
@@ -33,21 +32,18 @@ func (e *Event) SetCreatedAt(createdAt time.Time) {
 	e.CreatedAt = createdAt
 }
 
+// Fields returns the fields that lists can be sorted and filtered by
+func (e *Event) Fields() []string {
+	return append(baseFields, "name", "year")
+}
+
 // Validate checks structure consistency
 func (e *Event) Validate(action string) error {
-	// always check
-	if e.Name == "" {
-		return fmt.Errorf("required Name")
-	}
-	if e.Name == "" {
-		return fmt.Errorf("required Year")
-	}
-
-	return nil
+	return validate(e, action)
 }
 
-// Save saves the structure as new object
-func (e *Event) Save(db *gorm.DB) error {
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (e *Event) PrepareSave() error {
 	err := e.Prepare()
 	if err != nil {
 		return err
@@ -56,83 +52,21 @@ func (e *Event) Save(db *gorm.DB) error {
 	e.Name = html.EscapeString(strings.TrimSpace(e.Name))
 	e.Year = html.EscapeString(strings.TrimSpace(e.Year))
 
-	err = e.Validate("update")
-	if err != nil {
-		return err
-	}
-
-	err = db.Create(&e).Error
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// FindAll returns all known objects of this type
-func (e *Event) FindAll(db *gorm.DB) (*[]Object, error) {
-	entites := []Event{}
-	err := db.Model(&e).Limit(100).Find(&entites).Error
-	if err != nil {
-		return &[]Object{}, err
-	}
-
-	objects := []Object{}
-	for _, currentEntity := range entites {
-		objects = append(objects, &currentEntity)
-	}
-	return &objects, nil
-}
-
-// Count returns count of all known objects of this type
-func (e *Event) Count(db *gorm.DB) (int, error) {
-	var count int
-	err := db.Model(&e).Count(&count).Error
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-// FindByID returns an objects with corresponding ID if exists
-func (e *Event) FindByID(db *gorm.DB, uid uuid.UUID) error {
-	err := db.Model(&e).Where("id = ?", uid).Take(&e).Error
-	if err != nil {
-		return err
-	}
-	return nil
+	return e.Validate(ActionCreate)
 }
 
-// Update updates the existing objects
-func (e *Event) Update(db *gorm.DB) error {
+// PrepareUpdate checks the structure before the existing object is updated
+func (e *Event) PrepareUpdate() error {
 	if e.ID == uuid.Nil {
 		return fmt.Errorf("cannot update non saved event")
 	}
 
-	err := e.Validate("update")
+	err := e.Validate(ActionUpdate)
 	if err != nil {
 		return err
 	}
 
-	err = db.Model(&e).Updates(Event{
-		Name: e.Name,
-		Year: e.Year,
-		Base: Base{
-			UpdatedAt: time.Now(),
-		},
-	}).Error
+	e.UpdatedAt = time.Now()
 
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Delete is removing existing objects
-func (e *Event) Delete(db *gorm.DB) error {
-	err := db.Delete(&e).Error
-	if err != nil {
-		return err
-	}
 	return nil
 }
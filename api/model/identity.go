@@ -0,0 +1,68 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Identity links the user to the subject of an external identity provider
+type Identity struct {
+	Base
+	User    User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID  uuid.UUID `json:"user_id" validate:"required"`
+	Issuer  string    `gorm:"size:255;not null;unique_index:idx_identities_issuer_subject" json:"issuer" validate:"required;max=255"`
+	Subject string    `gorm:"size:255;not null;unique_index:idx_identities_issuer_subject" json:"subject" validate:"required;max=255"`
+}
+
+// GetID returns the ID
+func (i *Identity) GetID() uuid.UUID {
+	return i.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (i *Identity) GetCreatedAt() time.Time {
+	return i.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (i *Identity) SetCreatedAt(createdAt time.Time) {
+	i.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (i *Identity) Fields() []string {
+	return append(baseFields, "user_id", "issuer", "subject")
+}
+
+// Validate checks structure consistency
+func (i *Identity) Validate(action string) error {
+	return validate(i, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (i *Identity) PrepareSave() error {
+	err := i.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return i.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (i *Identity) PrepareUpdate() error {
+	if i.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved identity")
+	}
+
+	err := i.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	i.UpdatedAt = time.Now()
+
+	return nil
+}
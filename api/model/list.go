@@ -1,7 +1,13 @@
 package model
 
-// List holds technical fields
+// List holds a page of objects together with the paging metadata. The count is
+// not known for the pages that start after a cursor
 type List struct {
-	Count int      `json:"count"`
-	Data  []Object `json:"data"`
+	Count      *int     `json:"count,omitempty"`
+	Limit      int      `json:"limit"`
+	Offset     int      `json:"offset"`
+	Next       string   `json:"next,omitempty"`
+	Previous   string   `json:"previous,omitempty"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+	Data       []Object `json:"data"`
 }
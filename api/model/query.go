@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// baseFields are the technical fields that all objects can be sorted and filtered by
+var baseFields = []string{"id", "created_at", "updated_at"}
+
+// Order defines sorting by a single field
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// Cursor marks the last object of a page ordered by creation time
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// Query holds paging, sorting and filtering parameters used when loading lists
+type Query struct {
+	Limit   int
+	Offset  int
+	Sort    []Order
+	Filters map[string]interface{}
+	After   *Cursor
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+const (
+	// RoleAdmin manages the users and all other objects
+	RoleAdmin = "admin"
+
+	// RoleOrganizer manages the events and their sessions
+	RoleOrganizer = "organizer"
+
+	// RoleSpeaker manages the sessions
+	RoleSpeaker = "speaker"
+
+	// RoleAttendee subscribes to sessions and comments them
+	RoleAttendee = "attendee"
+)
+
+// knownRoles lists the roles that can be granted
+var knownRoles = []string{RoleAdmin, RoleOrganizer, RoleSpeaker, RoleAttendee}
+
+// Roles is a set of role names, stored as comma separated list
+type Roles []string
+
+// Has checks if the role is one of the roles
+func (r Roles) Has(role string) bool {
+	for _, current := range r {
+		if current == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the roles as comma separated list
+func (r Roles) Value() (driver.Value, error) {
+	return strings.Join(r, ","), nil
+}
+
+// Scan reads the roles from comma separated list
+func (r *Roles) Scan(value interface{}) error {
+	var list string
+	switch current := value.(type) {
+	case string:
+		list = current
+	case []byte:
+		list = string(current)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T as roles", value)
+	}
+	*r = Roles{}
+	for _, role := range strings.Split(list, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			*r = append(*r, role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/badoux/checkmail"
+)
+
+// Actions the objects are validated for, the rules can be limited to some of them
+const (
+	// ActionCreate is used before new object is saved
+	ActionCreate = "create"
+	// ActionUpdate is used before existing object is updated
+	ActionUpdate = "update"
+	// ActionLogin is used for the credentials of the user when logging in
+	ActionLogin = "login"
+)
+
+// enums lists the allowed values of the fields, the enum rule refers them by name
+var enums = map[string][]string{
+	"role":    knownRoles,
+	"outcome": {OutcomeSuccess, OutcomeFailure, OutcomeChallenged, OutcomeLocked, OutcomeRateLimited, OutcomeUnlocked},
+	"purpose": {PurposePasswordReset, PurposeEmailVerification, PurposeTwoFactor},
+	"status":  {TwoFactorPending, TwoFactorEnabled, TwoFactorDisabled},
+}
+
+// dateLayout is the format of the dates in the after and before rules
+const dateLayout = "2006-01-02"
+
+// rule is single rule from the validate tag of a field
+type rule struct {
+	name    string
+	param   string
+	actions []string
+	limit   int
+	pattern *regexp.Regexp
+	date    time.Time
+}
+
+// fieldRules are the rules of single field
+type fieldRules struct {
+	index []int
+	field string
+	label string
+	rules []rule
+}
+
+// actionsPattern matches the list of actions at the end of the rule
+var actionsPattern = regexp.MustCompile(`^[a-z]+(\|[a-z]+)*$`)
+
+// rulesCache keeps the parsed rules per type
+var rulesCache sync.Map
+
+// validate checks the object against the rules in the validate tags of its fields. The tag lists
+// rules separated by semicolon, each one as name[=param][@action|action]. The rule is checked for
+// all actions when none are listed. Empty fields are checked only by the required rule.
+// Supported rules are:
+//
+//	required        the field is not empty, the associations are loaded
+//	min=N, max=N    the number of characters of the text, or the number of the items
+//	email           the text is an email address
+//	regex=EXPR      the text matches the regular expression
+//	enum=NAME       the text, or each of the items, is one of the values in the enums
+//	after=DATE      the time is after the date (2006-01-02) or now, before=DATE is the opposite
+//	eqfield=F       the field is equal to the field F, nefield, gtfield and ltfield compare them too
+//
+// All invalid fields are listed, each one with the first rule it does not pass
+func validate(object interface{}, action string) error {
+	value := reflect.Indirect(reflect.ValueOf(object))
+	action = strings.ToLower(action)
+	if action == "" {
+		action = ActionCreate
+	}
+
+	errs := &ValidationError{}
+	for _, current := range rulesOf(value.Type()) {
+		field := value.FieldByIndex(current.index)
+		for _, r := range current.rules {
+			if !r.applies(action) {
+				continue
+			}
+			if r.name != "required" && empty(field) {
+				continue
+			}
+			code, message := r.check(value, field, current.label)
+			if code != "" {
+				errs.add(current.field, code, message)
+				break
+			}
+		}
+	}
+	return errs.result()
+}
+
+// rulesOf returns the rules of the fields of the type
+func rulesOf(t reflect.Type) []fieldRules {
+	if cached, ok := rulesCache.Load(t); ok {
+		return cached.([]fieldRules)
+	}
+	list := []fieldRules{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		name, label := fieldNames(field)
+		list = append(list, fieldRules{index: field.Index, field: name, label: label, rules: parseRules(t, field, tag)})
+	}
+	rulesCache.Store(t, list)
+	return list
+}
+
+// parseRules parses the validate tag. Invalid tag is a programming error, so it panics
+func parseRules(t reflect.Type, field reflect.StructField, tag string) []rule {
+	rules := []rule{}
+	for _, text := range strings.Split(tag, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		r := rule{}
+		if at := strings.LastIndex(text, "@"); at >= 0 && actionsPattern.MatchString(text[at+1:]) {
+			r.actions = strings.Split(text[at+1:], "|")
+			text = text[:at]
+		}
+		r.name = text
+		if eq := strings.Index(text, "="); eq >= 0 {
+			r.name, r.param = text[:eq], text[eq+1:]
+		}
+
+		var err error
+		switch r.name {
+		case "required", "email":
+		case "min", "max":
+			r.limit, err = strconv.Atoi(r.param)
+		case "regex":
+			r.pattern, err = regexp.Compile(r.param)
+		case "enum":
+			if _, ok := enums[r.param]; !ok {
+				err = fmt.Errorf("unknown enum %s", r.param)
+			}
+		case "after", "before":
+			if r.param != "now" {
+				r.date, err = time.Parse(dateLayout, r.param)
+			}
+		case "eqfield", "nefield", "gtfield", "ltfield":
+			if _, ok := t.FieldByName(r.param); !ok {
+				err = fmt.Errorf("unknown field %s", r.param)
+			}
+		default:
+			err = fmt.Errorf("unknown rule")
+		}
+		if err != nil {
+			panic(fmt.Sprintf("invalid rule %q of %s.%s: %v", text, t.Name(), field.Name, err))
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// applies checks if the rule is checked for the action
+func (r rule) applies(action string) bool {
+	if len(r.actions) == 0 {
+		return true
+	}
+	for _, current := range r.actions {
+		if current == action {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the code and the message when the field does not pass the rule
+func (r rule) check(object reflect.Value, field reflect.Value, label string) (string, string) {
+	switch r.name {
+	case "required":
+		if empty(field) {
+			return CodeRequired, fmt.Sprintf("required %s", label)
+		}
+	case "min":
+		if size, unit := length(field); size < r.limit {
+			return CodeTooShort, fmt.Sprintf("%s should have at least %d %s", label, r.limit, unit)
+		}
+	case "max":
+		if size, unit := length(field); size > r.limit {
+			return CodeTooLong, fmt.Sprintf("%s should have at most %d %s", label, r.limit, unit)
+		}
+	case "email":
+		if checkmail.ValidateFormat(field.String()) != nil {
+			return CodeInvalid, fmt.Sprintf("invalid %s", label)
+		}
+	case "regex":
+		if !r.pattern.MatchString(field.String()) {
+			return CodeInvalid, fmt.Sprintf("invalid %s", label)
+		}
+	case "enum":
+		values := []string{field.String()}
+		if field.Kind() == reflect.Slice {
+			values = field.Convert(reflect.TypeOf(values)).Interface().([]string)
+		}
+		for _, current := range values {
+			if !oneOf(current, enums[r.param]) {
+				return CodeUnknown, fmt.Sprintf("unknown %s %s", r.param, current)
+			}
+		}
+	case "after", "before":
+		bound := r.date
+		if r.param == "now" {
+			bound = time.Now()
+		}
+		moment := timeOf(field)
+		if (r.name == "after" && !moment.After(bound)) || (r.name == "before" && !moment.Before(bound)) {
+			return CodeOutOfRange, fmt.Sprintf("%s should be %s %s", label, r.name, r.param)
+		}
+	case "eqfield", "nefield", "gtfield", "ltfield":
+		other := object.FieldByName(r.param)
+		if empty(other) {
+			return "", ""
+		}
+		result := compare(field, other)
+		switch {
+		case r.name == "eqfield" && result != 0:
+			return CodeInvalid, fmt.Sprintf("%s should be equal to %s", label, r.param)
+		case r.name == "nefield" && result == 0:
+			return CodeInvalid, fmt.Sprintf("%s should differ from %s", label, r.param)
+		case r.name == "gtfield" && result <= 0:
+			return CodeOutOfRange, fmt.Sprintf("%s should be %s %s", label, order(field, "greater than", "after"), r.param)
+		case r.name == "ltfield" && result >= 0:
+			return CodeOutOfRange, fmt.Sprintf("%s should be %s %s", label, order(field, "less than", "before"), r.param)
+		}
+	}
+	return "", ""
+}
+
+// empty checks if the field has no value. The associations are empty when they are not loaded
+func empty(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(field.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return field.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return field.IsNil()
+	case reflect.Struct:
+		if moment, ok := field.Interface().(time.Time); ok {
+			return moment.IsZero()
+		}
+		for i := 0; i < field.NumField(); i++ {
+			if !field.Type().Field(i).Anonymous && !field.Field(i).IsZero() {
+				return false
+			}
+		}
+		return true
+	}
+	return field.IsZero()
+}
+
+// length returns the number of characters of the text or the number of the items
+func length(field reflect.Value) (int, string) {
+	if field.Kind() == reflect.String {
+		return utf8.RuneCountInString(field.String()), "characters"
+	}
+	return field.Len(), "items"
+}
+
+// timeOf returns the time of time.Time or *time.Time field
+func timeOf(field reflect.Value) time.Time {
+	if field.Kind() == reflect.Ptr {
+		field = field.Elem()
+	}
+	return field.Interface().(time.Time)
+}
+
+// order returns the name of the comparison for the type of the field
+func order(field reflect.Value, values string, times string) string {
+	if field.Kind() == reflect.Struct || field.Kind() == reflect.Ptr {
+		return times
+	}
+	return values
+}
+
+// compare returns negative, zero or positive number when the field is less than, equal or greater than the other
+func compare(field reflect.Value, other reflect.Value) int {
+	switch field.Kind() {
+	case reflect.String:
+		return strings.Compare(field.String(), other.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return sign(field.Int() - other.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return sign(int64(field.Uint()) - int64(other.Uint()))
+	case reflect.Struct, reflect.Ptr:
+		first, second := timeOf(field), timeOf(other)
+		switch {
+		case first.Before(second):
+			return -1
+		case first.After(second):
+			return 1
+		}
+		return 0
+	}
+	if reflect.DeepEqual(field.Interface(), other.Interface()) {
+		return 0
+	}
+	return 1
+}
+
+// sign returns -1, 0 or 1 for the sign of the number
+func sign(number int64) int {
+	switch {
+	case number < 0:
+		return -1
+	case number > 0:
+		return 1
+	}
+	return 0
+}
+
+// oneOf checks if the value is one of the values
+func oneOf(value string, values []string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldNames returns the name of the field in the payloads and the name used in the messages.
+// The identifiers of the related objects are named after the objects
+func fieldNames(field reflect.StructField) (string, string) {
+	name := snakeCase(field.Name)
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		name = tag
+	}
+	label := field.Name
+	if name != snakeCase(field.Name) {
+		label = camelCase(name)
+	}
+	if len(label) > 2 && strings.HasSuffix(label, "ID") {
+		label = strings.TrimSuffix(label, "ID")
+	}
+	return name, label
+}
+
+// snakeCase converts the Go name to snake case, keeping the abbreviations together
+func snakeCase(name string) string {
+	runes := []rune(name)
+	result := []rune{}
+	for i, current := range runes {
+		if i > 0 && unicode.IsUpper(current) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			result = append(result, '_')
+		}
+		result = append(result, unicode.ToLower(current))
+	}
+	return string(result)
+}
+
+// camelCase converts the snake case name to camel case
+func camelCase(name string) string {
+	result := ""
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			result += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return result
+}
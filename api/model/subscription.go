@@ -5,15 +5,14 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
 )
 
 // Subscription represents a session subscription
 type Subscription struct {
 	Base
-	User      User `json:"user"`
+	User      User `gorm:"constraint:OnDelete:CASCADE" json:"user" validate:"required"`
 	UserID    uuid.UUID
-	Session   Session `json:"session"`
+	Session   Session `gorm:"constraint:OnDelete:CASCADE" json:"session" validate:"required"`
 	SessionID uuid.UUID
 }
 
@@ -32,102 +31,38 @@ func (s *Subscription) SetCreatedAt(createdAt time.Time) {
 	s.CreatedAt = createdAt
 }
 
+// Fields returns the fields that lists can be sorted and filtered by
+func (s *Subscription) Fields() []string {
+	return append(baseFields, "user_id", "session_id")
+}
+
 // Validate checks structure consistency
 func (s *Subscription) Validate(action string) error {
-	// always check
-	if s.User.Name == "" {
-		return fmt.Errorf("required User")
-	}
-
-	if s.Session.Name == "" {
-		return fmt.Errorf("required Session")
-	}
-
-	return nil
+	return validate(s, action)
 }
 
-// Save saves the structure as new object
-func (s *Subscription) Save(db *gorm.DB) error {
-	s.Prepare()
-
-	err := s.Validate("update")
-	if err != nil {
-		return err
-	}
-
-	err = db.Create(&s).Error
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (s *Subscription) PrepareSave() error {
+	err := s.Prepare()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// FindAll returns all known objects of this type
-func (s *Subscription) FindAll(db *gorm.DB) (*[]Object, error) {
-	entites := []Subscription{}
-	err := db.Model(&s).Limit(100).Find(&entites).Error
-	if err != nil {
-		return &[]Object{}, err
-	}
-
-	objects := []Object{}
-	for _, currentEntity := range entites {
-		objects = append(objects, &currentEntity)
-	}
-	return &objects, nil
+	return s.Validate(ActionCreate)
 }
 
-// Count returns count of all known objects of this type
-func (s *Subscription) Count(db *gorm.DB) (int, error) {
-	var count int
-	err := db.Model(&s).Count(&count).Error
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-// FindByID returns an objects with corresponding ID if exists
-func (s *Subscription) FindByID(db *gorm.DB, uid uuid.UUID) error {
-	err := db.Model(&s).Where("id = ?", uid).Take(&s).Error
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// Update updates the existing objects
-func (s *Subscription) Update(db *gorm.DB) error {
+// PrepareUpdate checks the structure before the existing object is updated
+func (s *Subscription) PrepareUpdate() error {
 	if s.ID == uuid.Nil {
 		return fmt.Errorf("cannot update non saved subscription")
 	}
 
-	err := s.Validate("update")
+	err := s.Validate(ActionUpdate)
 	if err != nil {
 		return err
 	}
 
-	err = db.Model(&s).Updates(Subscription{
-		User:    s.User,
-		Session: s.Session,
-		Base: Base{
-			UpdatedAt: time.Now(),
-		},
-	}).Error
+	s.UpdatedAt = time.Now()
 
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Delete is removing existing objects
-func (s *Subscription) Delete(db *gorm.DB) error {
-	err := db.Delete(&s).Error
-	if err != nil {
-		return err
-	}
 	return nil
 }
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// RefreshToken is a long lived token exchanged for new access tokens. Only its hash is stored,
+// each use replaces it with new token of the same family and a reused token revokes the whole family
+type RefreshToken struct {
+	Base
+	User      User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uuid.UUID `validate:"required"`
+	Family    uuid.UUID `gorm:"type:uuid;not null" validate:"required"`
+	Hash      string    `gorm:"size:64;not null;unique" validate:"required;max=64"`
+	ExpiresAt time.Time `gorm:"not null" validate:"required"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// GetID returns the ID
+func (t *RefreshToken) GetID() uuid.UUID {
+	return t.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (t *RefreshToken) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (t *RefreshToken) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (t *RefreshToken) Fields() []string {
+	return append(baseFields, "user_id", "family", "hash")
+}
+
+// Validate checks structure consistency
+func (t *RefreshToken) Validate(action string) error {
+	return validate(t, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (t *RefreshToken) PrepareSave() error {
+	err := t.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return t.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (t *RefreshToken) PrepareUpdate() error {
+	if t.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved refresh token")
+	}
+
+	err := t.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	t.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// Active checks if the token can be used at given time
+func (t *RefreshToken) Active(now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// RevokedToken denies the access token with given ID until it expires
+type RevokedToken struct {
+	Base
+	JTI       string    `gorm:"column:jti;size:36;not null;unique" validate:"required;max=36"`
+	ExpiresAt time.Time `gorm:"not null" validate:"required"`
+}
+
+// GetID returns the ID
+func (t *RevokedToken) GetID() uuid.UUID {
+	return t.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (t *RevokedToken) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (t *RevokedToken) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (t *RevokedToken) Fields() []string {
+	return append(baseFields, "jti")
+}
+
+// Validate checks structure consistency
+func (t *RevokedToken) Validate(action string) error {
+	return validate(t, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (t *RevokedToken) PrepareSave() error {
+	err := t.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return t.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (t *RevokedToken) PrepareUpdate() error {
+	if t.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved revoked token")
+	}
+
+	err := t.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	t.UpdatedAt = time.Now()
+
+	return nil
+}
+
+const (
+	// PurposePasswordReset is the purpose of the tokens that reset the password
+	PurposePasswordReset = "password_reset"
+
+	// PurposeEmailVerification is the purpose of the tokens that verify the email
+	PurposeEmailVerification = "email_verification"
+
+	// PurposeTwoFactor is the purpose of the challenge tokens exchanged with TOTP code on login
+	PurposeTwoFactor = "two_factor"
+)
+
+// ActionToken is a single use token, sent by email to reset the password or to verify the email of the user,
+// or returned by login to be exchanged with TOTP code. Only its hash is stored
+type ActionToken struct {
+	Base
+	User      User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uuid.UUID `validate:"required"`
+	Purpose   string    `gorm:"size:32;not null" validate:"required;enum=purpose"`
+	Email     string    `gorm:"size:100;not null" validate:"required;max=100"`
+	Hash      string    `gorm:"size:64;not null;unique" validate:"required;max=64"`
+	ExpiresAt time.Time `gorm:"not null" validate:"required"`
+	UsedAt    *time.Time
+}
+
+// GetID returns the ID
+func (t *ActionToken) GetID() uuid.UUID {
+	return t.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (t *ActionToken) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (t *ActionToken) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (t *ActionToken) Fields() []string {
+	return append(baseFields, "user_id", "purpose", "hash")
+}
+
+// Validate checks structure consistency
+func (t *ActionToken) Validate(action string) error {
+	return validate(t, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (t *ActionToken) PrepareSave() error {
+	err := t.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return t.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (t *ActionToken) PrepareUpdate() error {
+	if t.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved action token")
+	}
+
+	err := t.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	t.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// Active checks if the token can be used for the purpose at given time
+func (t *ActionToken) Active(purpose string, now time.Time) bool {
+	return t.Purpose == purpose && t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// TwoFactorPending is the status of enrolled secret that is not confirmed yet
+	TwoFactorPending = "pending"
+
+	// TwoFactorEnabled is the status of confirmed secret, that is required on login
+	TwoFactorEnabled = "enabled"
+
+	// TwoFactorDisabled is the status of secret that is not used anymore
+	TwoFactorDisabled = "disabled"
+)
+
+// TwoFactor is the TOTP secret shared with the authenticator app of the user
+type TwoFactor struct {
+	Base
+	User        User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;unique" validate:"required"`
+	Secret      string    `gorm:"size:64;not null" validate:"required;max=64"`
+	Status      string    `gorm:"size:16;not null" validate:"required;enum=status"`
+	LastCounter int64     `gorm:"not null;default:0"`
+}
+
+// GetID returns the ID
+func (t *TwoFactor) GetID() uuid.UUID {
+	return t.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (t *TwoFactor) GetCreatedAt() time.Time {
+	return t.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (t *TwoFactor) SetCreatedAt(createdAt time.Time) {
+	t.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (t *TwoFactor) Fields() []string {
+	return append(baseFields, "user_id", "status")
+}
+
+// Validate checks structure consistency
+func (t *TwoFactor) Validate(action string) error {
+	return validate(t, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (t *TwoFactor) PrepareSave() error {
+	err := t.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return t.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (t *TwoFactor) PrepareUpdate() error {
+	if t.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved two factor")
+	}
+
+	err := t.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	t.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// RecoveryCode is a single use code that replaces the TOTP code when the authenticator app is lost.
+// Only its hash is stored
+type RecoveryCode struct {
+	Base
+	User   User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID uuid.UUID `validate:"required"`
+	Hash   string    `gorm:"size:64;not null;unique" validate:"required;max=64"`
+	UsedAt *time.Time
+}
+
+// GetID returns the ID
+func (c *RecoveryCode) GetID() uuid.UUID {
+	return c.ID
+}
+
+// GetCreatedAt returns the CreatedAt
+func (c *RecoveryCode) GetCreatedAt() time.Time {
+	return c.CreatedAt
+}
+
+// SetCreatedAt sets the CreatedAt
+func (c *RecoveryCode) SetCreatedAt(createdAt time.Time) {
+	c.CreatedAt = createdAt
+}
+
+// Fields returns the fields that lists can be sorted and filtered by
+func (c *RecoveryCode) Fields() []string {
+	return append(baseFields, "user_id", "hash")
+}
+
+// Validate checks structure consistency
+func (c *RecoveryCode) Validate(action string) error {
+	return validate(c, action)
+}
+
+// PrepareSave initialises the technical fields and checks the structure before it is saved as new object
+func (c *RecoveryCode) PrepareSave() error {
+	err := c.Prepare()
+	if err != nil {
+		return err
+	}
+
+	return c.Validate(ActionCreate)
+}
+
+// PrepareUpdate checks the structure before the existing object is updated
+func (c *RecoveryCode) PrepareUpdate() error {
+	if c.ID == uuid.Nil {
+		return fmt.Errorf("cannot update non saved recovery code")
+	}
+
+	err := c.Validate(ActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	c.UpdatedAt = time.Now()
+
+	return nil
+}
@@ -6,23 +6,28 @@ import (
 	"strings"
 	"time"
 
-	"github.com/badoux/checkmail"
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // User represents an user
 type User struct {
 	Base
-	Name          string         `gorm:"size:255;not null;unique" json:"name"`
-	Email         string         `gorm:"size:100;not null;unique" json:"email"`
-	Password      string         `gorm:"size:100;not null;" json:"password"`
+	Name          string         `gorm:"size:255;not null;unique" json:"name" validate:"required@create|update;max=255"`
+	Email         string         `gorm:"size:100;not null;unique" json:"email" validate:"required;email;max=100"`
+	Password      string         `gorm:"size:100;not null;" json:"password" validate:"required@create|login;max=72"`
+	Roles         Roles          `gorm:"size:255;not null;default:'attendee'" json:"roles" validate:"enum=role"`
+	VerifiedEmail string         `gorm:"size:100" json:"-"`
 	Subscriptions []Subscription `gorm:"foreignkey:UserID"`
 	Sessions      []Session      `gorm:"foreignkey:UserID"`
 	Comments      []Comment      `gorm:"foreignkey:UserID"`
 }
 
+// EmailVerified checks if the user proved the ownership of the current email
+func (u *User) EmailVerified() bool {
+	return u.Email != "" && u.VerifiedEmail == u.Email
+}
+
 // GetID returns the ID
 func (u *User) GetID() uuid.UUID {
 	return u.ID
@@ -38,6 +43,12 @@ func (u *User) SetCreatedAt(createdAt time.Time) {
 	u.CreatedAt = createdAt
 }
 
+// Fields returns the fields that lists can be sorted and filtered by
+func (u *User) Fields() []string {
+	// the email is left out, filtering by it would tell if an address is registered
+	return append(baseFields, "name")
+}
+
 // hash hashes the string. Used in password management
 func hash(password string) ([]byte, error) {
 	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -50,36 +61,11 @@ func VerifyPassword(hashedPassword, password string) error {
 
 // Validate checks structure consistency
 func (u *User) Validate(action string) error {
-	// always check
-	if u.Password == "" {
-		return fmt.Errorf("required Password")
-	}
-	if u.Email == "" {
-		return fmt.Errorf("required Email")
-	}
-	if err := checkmail.ValidateFormat(u.Email); err != nil {
-		return fmt.Errorf("invalid Email")
-	}
-
-	// specific checks
-	switch strings.ToLower(action) {
-	case "update":
-		if u.Name == "" {
-			return fmt.Errorf("required Name")
-		}
-	case "login":
-		// no specific checks
-	default:
-		if u.Name == "" {
-			return fmt.Errorf("required Name")
-		}
-	}
-
-	return nil
+	return validate(u, action)
 }
 
-// Save saves the structure as new object
-func (u *User) Save(db *gorm.DB) error {
+// PrepareSave initialises the technical fields, checks the structure and hashes the password before it is saved as new object
+func (u *User) PrepareSave() error {
 	err := u.Prepare()
 	if err != nil {
 		return err
@@ -87,8 +73,11 @@ func (u *User) Save(db *gorm.DB) error {
 
 	u.Name = html.EscapeString(strings.TrimSpace(u.Name))
 	u.Email = html.EscapeString(strings.TrimSpace(u.Email))
+	if len(u.Roles) == 0 {
+		u.Roles = Roles{RoleAttendee}
+	}
 
-	err = u.Validate("update")
+	err = u.Validate(ActionCreate)
 	if err != nil {
 		return err
 	}
@@ -99,84 +88,29 @@ func (u *User) Save(db *gorm.DB) error {
 	}
 	u.Password = string(hashedPassword)
 
-	err = db.Create(&u).Error
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// FindAll returns all known objects of this type
-func (u *User) FindAll(db *gorm.DB) (*[]Object, error) {
-	entites := []User{}
-	err := db.Model(&u).Limit(100).Find(&entites).Error
-	if err != nil {
-		return &[]Object{}, err
-	}
-
-	objects := []Object{}
-	for _, currentEntity := range entites {
-		objects = append(objects, &currentEntity)
-	}
-	return &objects, nil
-}
-
-// Count returns count of all known objects of this type
-func (u *User) Count(db *gorm.DB) (int, error) {
-	var count int
-	err := db.Model(&u).Count(&count).Error
-	if err != nil {
-		return 0, err
-	}
-	return count, nil
-}
-
-// FindByID returns an objects with corresponding ID if exists
-func (u *User) FindByID(db *gorm.DB, uid uuid.UUID) error {
-	err := db.Model(&u).Where("id = ?", uid).Take(&u).Error
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
-// Update updates the existing objects
-func (u *User) Update(db *gorm.DB) error {
+// PrepareUpdate checks the structure and hashes the new password before the existing object is updated.
+// Blank password is not updated, so the stored hash is kept
+func (u *User) PrepareUpdate() error {
 	if u.ID == uuid.Nil {
 		return fmt.Errorf("cannot update non saved user")
 	}
 
-	hashedPassword, err := hash(u.Password)
-	if err != nil {
-		return fmt.Errorf("cannot hash the password: %w", err)
-	}
-	u.Password = string(hashedPassword)
-
-	err = u.Validate("update")
+	err := u.Validate(ActionUpdate)
 	if err != nil {
 		return err
 	}
 
-	err = db.Model(&u).Updates(User{
-		Name:     u.Name,
-		Email:    u.Email,
-		Password: u.Password,
-		Base: Base{
-			UpdatedAt: time.Now(),
-		},
-	}).Error
-
-	if err != nil {
-		return err
+	if u.Password != "" {
+		hashedPassword, err := hash(u.Password)
+		if err != nil {
+			return fmt.Errorf("cannot hash the password: %w", err)
+		}
+		u.Password = string(hashedPassword)
 	}
-	return nil
-}
+	u.UpdatedAt = time.Now()
 
-// Delete is removing existing objects
-func (u *User) Delete(db *gorm.DB) error {
-	err := db.Delete(&u).Error
-	if err != nil {
-		return err
-	}
 	return nil
 }
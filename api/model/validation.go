@@ -0,0 +1,68 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codes of the field errors, they are stable so the clients can react on them
+const (
+	// CodeRequired is used for missing field
+	CodeRequired = "required"
+	// CodeInvalid is used for field with invalid format
+	CodeInvalid = "invalid"
+	// CodeUnknown is used for value that is not one of the allowed values
+	CodeUnknown = "unknown"
+	// CodeUnique is used for value that is already used by other object
+	CodeUnique = "unique"
+	// CodeTooShort is used for value shorter than allowed
+	CodeTooShort = "too_short"
+	// CodeTooLong is used for value longer than allowed
+	CodeTooLong = "too_long"
+	// CodeOutOfRange is used for value outside of the allowed range
+	CodeOutOfRange = "out_of_range"
+)
+
+// FieldError describes single invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists all invalid fields of an object
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error returns the messages of all invalid fields
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, current := range e.Fields {
+		messages = append(messages, current.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// FieldErrors returns the invalid fields
+func (e *ValidationError) FieldErrors() []FieldError {
+	return e.Fields
+}
+
+// add records invalid field
+func (e *ValidationError) add(field string, code string, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// required records missing field, the name is the one used in the messages
+func (e *ValidationError) required(field string, name string) {
+	e.add(field, CodeRequired, fmt.Sprintf("required %s", name))
+}
+
+// result returns the error when there are invalid fields
+func (e *ValidationError) result() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
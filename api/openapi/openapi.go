@@ -0,0 +1,231 @@
+// Package openapi describes the API in the OpenAPI 3 format. The schemas are generated from the Go types
+// of the payloads, so the document follows the changes of the payloads
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Version is the version of the OpenAPI specification the documents follow
+const Version = "3.0.3"
+
+// Document is the root of the OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Tag groups the operations
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of single path by lower case method
+type PathItem map[string]*Operation
+
+// Operation describes single method of a path
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter describes path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the payload of the request by media type
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// MediaType holds the schema of the payload
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Response describes single response, or refers to the one in the components
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]*Header   `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Components holds the reusable parts of the document
+type Components struct {
+	Schemas         Schemas                    `json:"schemas"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how the requests are authenticated
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+// Schema describes a value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Schemas are the named schemas of the components
+type Schemas map[string]*Schema
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Ref returns reference to the named schema
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Of returns the schema of the type of the value. The named structs are added
+// to the schemas with the name of their type and are referenced
+func (s Schemas) Of(value interface{}) *Schema {
+	return s.schema(reflect.TypeOf(value))
+}
+
+// Named adds the schema of the type of the value with given name and returns reference to it
+func (s Schemas) Named(name string, value interface{}) *Schema {
+	return s.Define(name, s.object(reflect.TypeOf(value)))
+}
+
+// Define adds the schema with given name and returns reference to it
+func (s Schemas) Define(name string, schema *Schema) *Schema {
+	s[name] = schema
+	return Ref(name)
+}
+
+// schema returns the schema of the type
+func (s Schemas) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.schema(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			// registered before the fields, so the recursive types refer to it
+			s[t.Name()] = &Schema{}
+			*s[t.Name()] = *s.object(t)
+		}
+		return Ref(t.Name())
+	}
+	return &Schema{}
+}
+
+// object returns the schema of the struct with the properties named after the json tags of the fields.
+// The fields of the embedded structs are included and the fields without omitempty are required
+func (s Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		if tag[0] == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && tag[0] == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.object(field.Type)
+			for name, property := range embedded.Properties {
+				schema.Properties[name] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.schema(field.Type)
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if !omitEmpty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
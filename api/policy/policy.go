@@ -0,0 +1,171 @@
+package policy
+
+import (
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+)
+
+// Permission allows a group of operations
+type Permission string
+
+const (
+	// ReadContent allows to read all objects
+	ReadContent Permission = "content:read"
+
+	// WriteProfile allows the users to change and delete their own profile
+	WriteProfile Permission = "profile:write"
+
+	// ManageUsers allows to grant roles to the users, unlock them and read their login records
+	ManageUsers Permission = "users:manage"
+
+	// WriteEvents allows to create, change and delete events
+	WriteEvents Permission = "events:write"
+
+	// WriteSessions allows to create, change and delete sessions
+	WriteSessions Permission = "sessions:write"
+
+	// WriteSubscriptions allows to create, change and delete subscriptions
+	WriteSubscriptions Permission = "subscriptions:write"
+
+	// WriteComments allows to create, change and delete comments
+	WriteComments Permission = "comments:write"
+
+	// WriteAnySessions allows to change, delete and restore the sessions of all authors
+	WriteAnySessions Permission = "sessions:write-any"
+
+	// WriteAnySubscriptions allows to change, delete and restore the subscriptions of all users
+	WriteAnySubscriptions Permission = "subscriptions:write-any"
+
+	// WriteAnyComments allows to change, delete and restore the comments of all authors
+	WriteAnyComments Permission = "comments:write-any"
+
+	// ManageAPIKeys allows the users to create, list and revoke their own API keys
+	ManageAPIKeys Permission = "api-keys:manage"
+
+	// ManageTwoFactor allows the users to enable and disable TOTP two-factor authentication of their own profile
+	ManageTwoFactor Permission = "two-factor:manage"
+
+	// PurgeDeleted allows to remove permanently the objects deleted before the retention window
+	PurgeDeleted Permission = "deleted:purge"
+)
+
+// grants maps the roles to the permissions they have
+var grants = map[string][]Permission{
+	model.RoleAdmin:     {ReadContent, WriteProfile, ManageUsers, WriteEvents, WriteSessions, WriteSubscriptions, WriteComments, WriteAnySessions, WriteAnySubscriptions, WriteAnyComments, ManageAPIKeys, ManageTwoFactor, PurgeDeleted},
+	model.RoleOrganizer: {ReadContent, WriteProfile, WriteEvents, WriteSessions, WriteSubscriptions, WriteComments, WriteAnySessions, WriteAnyComments, ManageAPIKeys, ManageTwoFactor},
+	model.RoleSpeaker:   {ReadContent, WriteProfile, WriteSessions, WriteSubscriptions, WriteComments, ManageAPIKeys},
+	model.RoleAttendee:  {ReadContent, WriteProfile, WriteSubscriptions, WriteComments, ManageAPIKeys},
+}
+
+// rule is the permission required to call a route with given method
+type rule struct {
+	method     string
+	route      string
+	permission Permission
+}
+
+// rules lists the permissions required by the routes that need authentication
+var rules = []rule{
+	{http.MethodGet, "/user", ReadContent},
+	{http.MethodGet, "/user/{id}", ReadContent},
+	{http.MethodPut, "/user/{id}", WriteProfile},
+	{http.MethodPatch, "/user/{id}", WriteProfile},
+	{http.MethodDelete, "/user/{id}", WriteProfile},
+	{http.MethodPost, "/user/{id}/restore", WriteProfile},
+	{http.MethodPut, "/user/{id}/roles", ManageUsers},
+	{http.MethodPost, "/user/{id}/unlock", ManageUsers},
+	{http.MethodGet, "/user/{id}/login-attempt", ManageUsers},
+	{http.MethodGet, "/user/{id}/api-key", ManageAPIKeys},
+	{http.MethodPost, "/user/{id}/api-key", ManageAPIKeys},
+	{http.MethodDelete, "/user/{id}/api-key/{key_id}", ManageAPIKeys},
+	{http.MethodPost, "/user/{id}/totp", ManageTwoFactor},
+	{http.MethodPost, "/user/{id}/totp/confirm", ManageTwoFactor},
+	{http.MethodPost, "/user/{id}/totp/disable", ManageTwoFactor},
+	{http.MethodGet, "/user/{id}/subscription", ReadContent},
+	{http.MethodPost, "/user/{id}/subscription", WriteSubscriptions},
+
+	{http.MethodGet, "/event", ReadContent},
+	{http.MethodPost, "/event", WriteEvents},
+	{http.MethodGet, "/event/{id}", ReadContent},
+	{http.MethodPut, "/event/{id}", WriteEvents},
+	{http.MethodPatch, "/event/{id}", WriteEvents},
+	{http.MethodDelete, "/event/{id}", WriteEvents},
+	{http.MethodPost, "/event/{id}/restore", WriteEvents},
+	{http.MethodGet, "/event/{id}/session", ReadContent},
+	{http.MethodPost, "/event/{id}/session", WriteSessions},
+
+	{http.MethodGet, "/session", ReadContent},
+	{http.MethodPost, "/session", WriteSessions},
+	{http.MethodGet, "/session/{id}", ReadContent},
+	{http.MethodPut, "/session/{id}", WriteSessions},
+	{http.MethodPatch, "/session/{id}", WriteSessions},
+	{http.MethodDelete, "/session/{id}", WriteSessions},
+	{http.MethodPost, "/session/{id}/restore", WriteAnySessions},
+	{http.MethodGet, "/session/{id}/subscription", ReadContent},
+	{http.MethodPost, "/session/{id}/subscription", WriteSubscriptions},
+	{http.MethodGet, "/session/{id}/comment", ReadContent},
+	{http.MethodPost, "/session/{id}/comment", WriteComments},
+
+	{http.MethodGet, "/subscription", ReadContent},
+	{http.MethodPost, "/subscription", WriteSubscriptions},
+	{http.MethodGet, "/subscription/{id}", ReadContent},
+	{http.MethodPut, "/subscription/{id}", WriteSubscriptions},
+	{http.MethodPatch, "/subscription/{id}", WriteSubscriptions},
+	{http.MethodDelete, "/subscription/{id}", WriteSubscriptions},
+	{http.MethodPost, "/subscription/{id}/restore", WriteAnySubscriptions},
+
+	{http.MethodGet, "/comment", ReadContent},
+	{http.MethodPost, "/comment", WriteComments},
+	{http.MethodGet, "/comment/{id}", ReadContent},
+	{http.MethodPut, "/comment/{id}", WriteComments},
+	{http.MethodPatch, "/comment/{id}", WriteComments},
+	{http.MethodDelete, "/comment/{id}", WriteComments},
+	{http.MethodPost, "/comment/{id}/restore", WriteAnyComments},
+
+	{http.MethodPost, "/purge", PurgeDeleted},
+}
+
+// Required returns the permission required to call the route template with given method
+func Required(method string, route string) (Permission, bool) {
+	for _, current := range rules {
+		if current.method == method && current.route == route {
+			return current.permission, true
+		}
+	}
+	return "", false
+}
+
+// Allowed checks if any of the roles has the permission
+func Allowed(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		for _, granted := range grants[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Known checks if the permission is granted to any role
+func Known(permission Permission) bool {
+	for _, granted := range grants {
+		for _, current := range granted {
+			if current == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InScope checks if the permission is one of the scopes
+func InScope(scopes []string, permission Permission) bool {
+	for _, scope := range scopes {
+		if Permission(scope) == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,42 @@ package response
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/model"
 )
 
+// ProblemType is the media type of the error responses
+const ProblemType = "application/problem+json"
+
+// Problem is an error response in the problem details format (RFC 7807)
+type Problem struct {
+	Type     string             `json:"type"`
+	Title    string             `json:"title"`
+	Status   int                `json:"status"`
+	Detail   string             `json:"detail,omitempty"`
+	Instance string             `json:"instance,omitempty"`
+	Errors   []model.FieldError `json:"errors,omitempty"`
+}
+
+// fieldErrors is implemented by the errors that list the invalid fields
+type fieldErrors interface {
+	FieldErrors() []model.FieldError
+}
+
+// instanceWriter is a response writer that knows the path of the request it responds to
+type instanceWriter struct {
+	http.ResponseWriter
+	instance string
+}
+
+// WithInstance returns a response writer whose error responses refer to the path of the request
+func WithInstance(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	return &instanceWriter{ResponseWriter: w, instance: r.URL.Path}
+}
+
 // JSON returns data as JSON stream
 func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.WriteHeader(statusCode)
@@ -15,15 +47,26 @@ func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	}
 }
 
-// ERROR returns error as JSON representation
+// ERROR returns error as problem details, with the invalid fields when the error lists them
 func ERROR(w http.ResponseWriter, statusCode int, err error) {
+	if err == nil {
+		statusCode = http.StatusBadRequest
+	}
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+	}
 	if err != nil {
-		JSON(w, statusCode, struct {
-			Error string `json:"error"`
-		}{
-			Error: err.Error(),
-		})
-		return
+		problem.Detail = err.Error()
+		var fields fieldErrors
+		if errors.As(err, &fields) {
+			problem.Errors = fields.FieldErrors()
+		}
+	}
+	if current, ok := w.(*instanceWriter); ok {
+		problem.Instance = current.instance
 	}
-	JSON(w, http.StatusBadRequest, nil)
+	w.Header().Set("Content-Type", ProblemType)
+	JSON(w, statusCode, problem)
 }
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/migration"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+
+	_ "github.com/jinzhu/gorm/dialects/postgres" //postgres database driver
+)
+
+// GORM is a Storage that keeps the objects in relational database using GORM
+type GORM struct {
+	DB *gorm.DB
+}
+
+var _ Storage = &GORM{}
+
+// NewGORM applies the pending migrations and wraps the connection in GORM storage
+func NewGORM(db *gorm.DB) (*GORM, error) {
+	applied, err := migration.Up(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, m := range applied {
+		log.Printf("Applied migration %s", m)
+	}
+
+	return &GORM{DB: db}, nil
+}
+
+// where adds the filtering conditions to the statement
+func where(db *gorm.DB, query model.Query) *gorm.DB {
+	for field, value := range query.Filters {
+		db = db.Where(fmt.Sprintf("%s = ?", field), value)
+	}
+	return db
+}
+
+// page adds the filtering, keyset, sorting and paging conditions to the statement
+func page(db *gorm.DB, query model.Query) *gorm.DB {
+	db = where(db, query)
+	if query.After != nil {
+		db = db.Where("created_at > ? OR (created_at = ? AND id > ?)", query.After.CreatedAt, query.After.CreatedAt, query.After.ID)
+	}
+	for _, order := range query.Sort {
+		if order.Desc {
+			db = db.Order(fmt.Sprintf("%s desc", order.Field))
+		} else {
+			db = db.Order(order.Field)
+		}
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	if query.Offset > 0 {
+		db = db.Offset(query.Offset)
+	}
+	return db
+}
+
+// notFound replaces the GORM specific not found error
+func notFound(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// referenced replaces the database specific foreign key violation errors
+func referenced(err error) error {
+	if driverErr, ok := err.(*pq.Error); ok && driverErr.Code == "23503" {
+		return ErrReferenced
+	}
+	if sqliteReferenced(err) {
+		return ErrReferenced
+	}
+	return err
+}
+
+// missingParent replaces the foreign key violation errors of the saved objects
+func missingParent(err error) error {
+	if referenced(err) == ErrReferenced {
+		return ErrMissingParent
+	}
+	return err
+}
+
+// deletedParent checks if the object refers to deleted object, which the foreign keys do not reject
+func deletedParent(tx *gorm.DB, object model.Object) error {
+	value := reflect.ValueOf(object).Elem()
+	for _, current := range associations(value.Type()) {
+		parentID := value.FieldByIndex(current.foreign).Interface().(uuid.UUID)
+		if parentID == uuid.Nil {
+			continue
+		}
+		var count int
+		err := tx.Unscoped().Model(reflect.New(current.parent).Interface()).Where("id = ? AND deleted_at IS NOT NULL", parentID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrMissingParent
+		}
+	}
+	return nil
+}
+
+// unique replaces the database specific unique violation errors
+func unique(err error) error {
+	if driverErr, ok := err.(*pq.Error); ok && driverErr.Code == "23505" {
+		// The constraints created for unique columns are named {table}_{column}_key
+		field := strings.TrimSuffix(strings.TrimPrefix(driverErr.Constraint, driverErr.Table+"_"), "_key")
+		return &UniqueError{Field: field}
+	}
+	if field, ok := sqliteUnique(err); ok {
+		return &UniqueError{Field: field}
+	}
+	return err
+}
+
+// withoutAssociations stops GORM from saving the related objects loaded with the object, as they would be
+// written with the values read before and without the version check. Only their foreign keys are set
+func withoutAssociations(tx *gorm.DB) *gorm.DB {
+	return tx.Set("gorm:association_autoupdate", false).Set("gorm:association_autocreate", false)
+}
+
+// Save stores the object as new one
+func (s *GORM) Save(object model.Object) error {
+	err := object.PrepareSave()
+	if err != nil {
+		return err
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		err := deletedParent(tx, object)
+		if err != nil {
+			return err
+		}
+		return missingParent(unique(withoutAssociations(tx).Create(object).Error))
+	})
+}
+
+// Update updates the stored object
+func (s *GORM) Update(object model.Object) error {
+	err := object.PrepareUpdate()
+	if err != nil {
+		return err
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		err := deletedParent(tx, object)
+		if err != nil {
+			return err
+		}
+		expected := version(object)
+		db := withoutAssociations(tx).Model(object).Omit("created_at", "version")
+		if expected > 0 {
+			db = db.Where("version = ?", expected)
+		}
+		result := db.Updates(object)
+		if result.Error != nil {
+			return missingParent(unique(result.Error))
+		}
+		if result.RowsAffected == 0 {
+			return mismatch(tx, object)
+		}
+
+		err = tx.Model(object).UpdateColumn("version", gorm.Expr("version + 1")).Error
+		if err != nil {
+			return err
+		}
+		var current int
+		err = tx.Model(blank(object)).Where("id = ?", object.GetID()).Select("version").Row().Scan(&current)
+		if err != nil {
+			return err
+		}
+		setVersion(object, current)
+		return nil
+	})
+}
+
+// mismatch returns version mismatch error when the object that was not changed exists
+func mismatch(tx *gorm.DB, object model.Object) error {
+	if version(object) == 0 {
+		return nil
+	}
+	var count int
+	err := tx.Model(blank(object)).Where("id = ?", object.GetID()).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// UpdateColumn sets single column of the stored object with given ID, without changing its version
+func (s *GORM) UpdateColumn(object model.Object, uid uuid.UUID, column string, value interface{}) error {
+	result := s.DB.Model(blank(object)).Where("id = ?", uid).UpdateColumn(column, value)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete marks the stored object and the objects referring to it with cascade delete policy as deleted
+func (s *GORM) Delete(object model.Object) error {
+	return referenced(s.DB.Transaction(func(tx *gorm.DB) error {
+		deletedAt := time.Now().UTC()
+		if expected := version(object); expected > 0 {
+			result := tx.Model(blank(object)).Where("id = ? AND version = ?", object.GetID(), expected).UpdateColumn("deleted_at", deletedAt)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return mismatch(tx, object)
+			}
+		}
+		return softDelete(tx, object, []uuid.UUID{object.GetID()}, deletedAt)
+	}))
+}
+
+// softDelete marks the rows with given IDs and the rows referring to them as deleted
+func softDelete(tx *gorm.DB, object model.Object, ids []uuid.UUID, deletedAt time.Time) error {
+	for _, current := range references(reflect.TypeOf(object).Elem()) {
+		child := reflect.New(current.child).Interface().(model.Object)
+		// Restricted references are kept also by deleted rows until they are purged
+		if current.onDelete != "CASCADE" {
+			var count int
+			err := tx.Unscoped().Model(child).Where(fmt.Sprintf("%s IN (?)", current.column), ids).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrReferenced
+			}
+			continue
+		}
+
+		childIDs := []uuid.UUID{}
+		err := tx.Model(child).Where(fmt.Sprintf("%s IN (?)", current.column), ids).Pluck("id", &childIDs).Error
+		if err != nil {
+			return err
+		}
+		if len(childIDs) > 0 {
+			err = softDelete(tx, child, childIDs, deletedAt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Unscoped().Model(blank(object)).Where("id IN (?)", ids).UpdateColumn("deleted_at", deletedAt).Error
+}
+
+// Restore restores the deleted object with given ID together with the objects deleted with it
+func (s *GORM) Restore(object model.Object, uid uuid.UUID) error {
+	reset(object)
+	err := s.DB.Unscoped().Model(object).Where("id = ?", uid).Take(object).Error
+	if err != nil {
+		return notFound(err)
+	}
+	deletedAt := reflect.ValueOf(object).Elem().FieldByName("DeletedAt").Interface().(*time.Time)
+	if deletedAt == nil {
+		return nil
+	}
+
+	for _, current := range associations(reflect.TypeOf(object).Elem()) {
+		var count int
+		parentID := reflect.ValueOf(object).Elem().FieldByIndex(current.foreign).Interface()
+		err = s.DB.Unscoped().Model(reflect.New(current.parent).Interface()).Where("id = ? AND deleted_at IS NOT NULL", parentID).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDeletedParent
+		}
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		return restore(tx, object, []uuid.UUID{uid}, *deletedAt)
+	})
+	if err != nil {
+		// The restored rows may use the unique values taken after they were deleted
+		return unique(err)
+	}
+	return s.FindByID(object, uid)
+}
+
+// restore clears the deleted mark of the rows with given IDs and the rows referring to them deleted at the same time
+func restore(tx *gorm.DB, object model.Object, ids []uuid.UUID, deletedAt time.Time) error {
+	err := tx.Unscoped().Model(blank(object)).Where("id IN (?)", ids).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		return err
+	}
+
+	for _, current := range references(reflect.TypeOf(object).Elem()) {
+		if current.onDelete != "CASCADE" {
+			continue
+		}
+		child := reflect.New(current.child).Interface().(model.Object)
+		childIDs := []uuid.UUID{}
+		err = tx.Unscoped().Model(child).Where(fmt.Sprintf("%s IN (?) AND deleted_at = ?", current.column), ids, deletedAt).Pluck("id", &childIDs).Error
+		if err != nil {
+			return err
+		}
+		if len(childIDs) > 0 {
+			err = restore(tx, child, childIDs, deletedAt)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Purge removes permanently the objects deleted before given time
+func (s *GORM) Purge(before time.Time) (int, error) {
+	count := 0
+	// The referring objects are removed before the referenced ones
+	for i := len(models) - 1; i >= 0; i-- {
+		result := s.DB.Unscoped().Where("deleted_at < ?", before).Delete(blank(models[i]))
+		if result.Error != nil {
+			return count, referenced(result.Error)
+		}
+		count += int(result.RowsAffected)
+	}
+	return count, nil
+}
+
+// FindByID loads the object with given ID
+func (s *GORM) FindByID(object model.Object, uid uuid.UUID) error {
+	reset(object)
+	return notFound(s.DB.Model(object).Where("id = ?", uid).Take(object).Error)
+}
+
+// Find loads the first object that matches the query
+func (s *GORM) Find(object model.Object, query model.Query) error {
+	reset(object)
+	return notFound(page(s.DB.Model(object), query).Take(object).Error)
+}
+
+// FindAll returns the objects of the same type that match the query
+func (s *GORM) FindAll(object model.Object, query model.Query) ([]model.Object, error) {
+	entities := reflect.New(reflect.SliceOf(reflect.TypeOf(object).Elem()))
+	err := page(s.DB.Model(blank(object)), query).Find(entities.Interface()).Error
+	if err != nil {
+		return []model.Object{}, err
+	}
+
+	objects := []model.Object{}
+	for i := 0; i < entities.Elem().Len(); i++ {
+		objects = append(objects, entities.Elem().Index(i).Addr().Interface().(model.Object))
+	}
+	return objects, nil
+}
+
+// Count returns count of the objects of the same type that match the query filters
+func (s *GORM) Count(object model.Object, query model.Query) (int, error) {
+	var count int
+	err := where(s.DB.Model(blank(object)), query).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Close closes the database connection
+func (s *GORM) Close() error {
+	return s.DB.Close()
+}
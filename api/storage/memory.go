@@ -0,0 +1,588 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/gofrs/uuid"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// column describes a struct field that is stored as table column
+type column struct {
+	name   string
+	index  []int
+	unique bool
+}
+
+// Memory is a Storage that keeps the objects in memory, used for tests and local demos
+type Memory struct {
+	mutex  sync.RWMutex
+	tables map[reflect.Type]map[uuid.UUID]reflect.Value
+}
+
+var _ Storage = &Memory{}
+
+// NewMemory creates an empty in-memory storage
+func NewMemory() *Memory {
+	return &Memory{
+		tables: map[reflect.Type]map[uuid.UUID]reflect.Value{},
+	}
+}
+
+// Reset removes all stored objects
+func (s *Memory) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tables = map[reflect.Type]map[uuid.UUID]reflect.Value{}
+}
+
+// columns returns the fields of given struct type that are stored as columns
+func columns(t reflect.Type) []column {
+	result := []column{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		settings := tagSettings(field)
+		if _, ignored := settings["-"]; ignored {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range columns(field.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				result = append(result, embedded)
+			}
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Slice:
+			// only the slices with own column value like roles are stored
+			if !field.Type.Implements(valuerType) {
+				continue
+			}
+		case reflect.Struct:
+			if field.Type != timeType {
+				continue
+			}
+		case reflect.Ptr:
+			if field.Type.Elem() != timeType {
+				continue
+			}
+		case reflect.Map, reflect.Interface:
+			continue
+		}
+		name := columnName(field.Name)
+		if value, ok := settings["COLUMN"]; ok {
+			name = value
+		}
+		_, unique := settings["UNIQUE"]
+		result = append(result, column{
+			name:   name,
+			index:  []int{i},
+			unique: unique,
+		})
+	}
+	return result
+}
+
+// findColumn returns the column with given name
+func findColumn(t reflect.Type, name string) (column, error) {
+	for _, current := range columns(t) {
+		if current.name == name {
+			return current, nil
+		}
+	}
+	return column{}, fmt.Errorf("unknown field %s", name)
+}
+
+// idOf returns the ID of the struct value
+func idOf(value reflect.Value) uuid.UUID {
+	return value.FieldByName("ID").Interface().(uuid.UUID)
+}
+
+// isDeleted checks if the row is marked as deleted
+func isDeleted(value reflect.Value) bool {
+	return !value.FieldByName("DeletedAt").IsNil()
+}
+
+// row returns a copy of the struct value that holds only the columns
+func row(value reflect.Value) reflect.Value {
+	result := reflect.New(value.Type()).Elem()
+	for _, current := range columns(value.Type()) {
+		result.FieldByIndex(current.index).Set(value.FieldByIndex(current.index))
+	}
+	return result
+}
+
+// table returns the table that holds the values of given type
+func (s *Memory) table(t reflect.Type) map[uuid.UUID]reflect.Value {
+	table, ok := s.tables[t]
+	if !ok {
+		table = map[uuid.UUID]reflect.Value{}
+		s.tables[t] = table
+	}
+	return table
+}
+
+// checkUnique verifies that unique columns of the row are not used by other rows that are not deleted
+func (s *Memory) checkUnique(value reflect.Value) error {
+	id := idOf(value)
+	for _, current := range columns(value.Type()) {
+		if !current.unique {
+			continue
+		}
+		for otherID, other := range s.table(value.Type()) {
+			if otherID != id && !isDeleted(other) && other.FieldByIndex(current.index).Interface() == value.FieldByIndex(current.index).Interface() {
+				return &UniqueError{Field: current.name}
+			}
+		}
+	}
+	return nil
+}
+
+// checkParents verifies that the objects the row refers to exist and are not deleted
+func (s *Memory) checkParents(value reflect.Value) error {
+	for _, current := range associations(value.Type()) {
+		parent, ok := s.table(current.parent)[value.FieldByIndex(current.foreign).Interface().(uuid.UUID)]
+		if !ok || isDeleted(parent) {
+			return ErrMissingParent
+		}
+	}
+	return nil
+}
+
+// setReferences sets the foreign keys of the related objects like GORM does, the related objects are not stored
+func setReferences(value reflect.Value) {
+	for _, current := range associations(value.Type()) {
+		related := value.FieldByIndex(current.index)
+		if related.IsZero() || idOf(related) == uuid.Nil {
+			continue
+		}
+		value.FieldByIndex(current.foreign).Set(reflect.ValueOf(idOf(related)))
+	}
+}
+
+// Save stores the object as new one
+func (s *Memory) Save(object model.Object) error {
+	err := object.PrepareSave()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value := reflect.ValueOf(object).Elem()
+	if _, ok := s.table(value.Type())[object.GetID()]; ok {
+		return fmt.Errorf("duplicate value %s for primary key", object.GetID())
+	}
+
+	setReferences(value)
+
+	newRow := row(value)
+	err = s.checkParents(newRow)
+	if err != nil {
+		return err
+	}
+	err = s.checkUnique(newRow)
+	if err != nil {
+		return err
+	}
+	s.table(value.Type())[object.GetID()] = newRow
+	return nil
+}
+
+// Update updates the non blank fields of the stored object
+func (s *Memory) Update(object model.Object) error {
+	err := object.PrepareUpdate()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value := reflect.ValueOf(object).Elem()
+	existing, ok := s.table(value.Type())[object.GetID()]
+	if !ok || isDeleted(existing) {
+		return nil
+	}
+	current := existing.FieldByName("Version").Interface().(int)
+	if expected := version(object); expected > 0 && expected != current {
+		return ErrVersionMismatch
+	}
+
+	setReferences(value)
+
+	newRow := row(existing)
+	for _, column := range columns(value.Type()) {
+		field := value.FieldByIndex(column.index)
+		if column.name == "created_at" || column.name == "version" || field.IsZero() {
+			continue
+		}
+		newRow.FieldByIndex(column.index).Set(field)
+	}
+	newRow.FieldByName("Version").SetInt(int64(current + 1))
+
+	err = s.checkParents(newRow)
+	if err != nil {
+		return err
+	}
+	err = s.checkUnique(newRow)
+	if err != nil {
+		return err
+	}
+	s.table(value.Type())[object.GetID()] = newRow
+	setVersion(object, current+1)
+	return nil
+}
+
+// UpdateColumn sets single column of the stored object with given ID, without changing its version
+func (s *Memory) UpdateColumn(object model.Object, uid uuid.UUID, name string, value interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t := reflect.TypeOf(object).Elem()
+	current, err := findColumn(t, name)
+	if err != nil {
+		return err
+	}
+	existing, ok := s.table(t)[uid]
+	if !ok || isDeleted(existing) {
+		return ErrNotFound
+	}
+	field := existing.FieldByIndex(current.index)
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	field.Set(reflect.ValueOf(value).Convert(field.Type()))
+	return nil
+}
+
+// Delete marks the stored object and the objects referring to it with cascade delete policy as deleted
+func (s *Memory) Delete(object model.Object) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, ok := s.table(reflect.TypeOf(object).Elem())[object.GetID()]
+	if expected := version(object); ok && !isDeleted(existing) && expected > 0 && expected != existing.FieldByName("Version").Interface().(int) {
+		return ErrVersionMismatch
+	}
+
+	deleted := map[reflect.Type]map[uuid.UUID]bool{}
+	err := s.collect(reflect.TypeOf(object).Elem(), object.GetID(), deleted)
+	if err != nil {
+		return err
+	}
+	deletedAt := time.Now().UTC()
+	for t, ids := range deleted {
+		for id := range ids {
+			if existing, ok := s.table(t)[id]; ok {
+				existing.FieldByName("DeletedAt").Set(reflect.ValueOf(&deletedAt))
+			}
+		}
+	}
+	return nil
+}
+
+// collect finds the rows deleted together with given row following the delete policies of the references to it
+func (s *Memory) collect(t reflect.Type, id uuid.UUID, deleted map[reflect.Type]map[uuid.UUID]bool) error {
+	if deleted[t][id] {
+		return nil
+	}
+	if deleted[t] == nil {
+		deleted[t] = map[uuid.UUID]bool{}
+	}
+	deleted[t][id] = true
+
+	for _, current := range references(t) {
+		for childID, childRow := range s.table(current.child) {
+			if childRow.FieldByIndex(current.foreign).Interface() != id {
+				continue
+			}
+			// Restricted references are kept also by deleted rows until they are purged
+			if current.onDelete != "CASCADE" {
+				return ErrReferenced
+			}
+			if isDeleted(childRow) {
+				continue
+			}
+			err := s.collect(current.child, childID, deleted)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Restore restores the deleted object with given ID together with the objects deleted with it
+func (s *Memory) Restore(object model.Object, uid uuid.UUID) error {
+	reset(object)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value := reflect.ValueOf(object).Elem()
+	existing, ok := s.table(value.Type())[uid]
+	if !ok {
+		return ErrNotFound
+	}
+	if isDeleted(existing) {
+		for _, current := range associations(value.Type()) {
+			parent, ok := s.table(current.parent)[existing.FieldByIndex(current.foreign).Interface().(uuid.UUID)]
+			if ok && isDeleted(parent) {
+				return ErrDeletedParent
+			}
+		}
+		deletedAt := existing.FieldByName("DeletedAt").Interface().(*time.Time)
+		restored := s.restore(value.Type(), uid, *deletedAt)
+		for _, current := range restored {
+			err := s.checkUnique(current)
+			if err != nil {
+				// The rows are deleted again, the restored values would clash with the active ones
+				for _, row := range restored {
+					row.FieldByName("DeletedAt").Set(reflect.ValueOf(deletedAt))
+				}
+				return err
+			}
+		}
+	}
+	value.Set(existing)
+	return nil
+}
+
+// restore clears the deleted mark of the row and the rows referring to it deleted at the same time.
+// It returns the restored rows
+func (s *Memory) restore(t reflect.Type, id uuid.UUID, deletedAt time.Time) []reflect.Value {
+	restored := []reflect.Value{s.table(t)[id]}
+	restored[0].FieldByName("DeletedAt").Set(reflect.Zero(reflect.PtrTo(timeType)))
+	for _, current := range references(t) {
+		for childID, childRow := range s.table(current.child) {
+			if childRow.FieldByIndex(current.foreign).Interface() == id && isDeleted(childRow) &&
+				childRow.FieldByName("DeletedAt").Interface().(*time.Time).Equal(deletedAt) {
+				restored = append(restored, s.restore(current.child, childID, deletedAt)...)
+			}
+		}
+	}
+	return restored
+}
+
+// Purge removes permanently the objects deleted before given time
+func (s *Memory) Purge(before time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, table := range s.tables {
+		for id, current := range table {
+			if isDeleted(current) && current.FieldByName("DeletedAt").Interface().(*time.Time).Before(before) {
+				delete(table, id)
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// FindByID loads the object with given ID
+func (s *Memory) FindByID(object model.Object, uid uuid.UUID) error {
+	reset(object)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	value := reflect.ValueOf(object).Elem()
+	existing, ok := s.table(value.Type())[uid]
+	if !ok || isDeleted(existing) {
+		return ErrNotFound
+	}
+	value.Set(existing)
+	return nil
+}
+
+// Find loads the first object that matches the query
+func (s *Memory) Find(object model.Object, query model.Query) error {
+	reset(object)
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rows, err := s.page(reflect.TypeOf(object).Elem(), query)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	reflect.ValueOf(object).Elem().Set(rows[0])
+	return nil
+}
+
+// FindAll returns the objects of the same type that match the query
+func (s *Memory) FindAll(object model.Object, query model.Query) ([]model.Object, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rows, err := s.page(reflect.TypeOf(object).Elem(), query)
+	if err != nil {
+		return []model.Object{}, err
+	}
+
+	objects := []model.Object{}
+	for _, current := range rows {
+		entity := reflect.New(current.Type())
+		entity.Elem().Set(current)
+		objects = append(objects, entity.Interface().(model.Object))
+	}
+	return objects, nil
+}
+
+// Count returns count of the objects of the same type that match the query filters
+func (s *Memory) Count(object model.Object, query model.Query) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rows, err := s.where(reflect.TypeOf(object).Elem(), query)
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// Close does nothing as there are no resources to release
+func (s *Memory) Close() error {
+	return nil
+}
+
+// where returns the rows that match the query filters
+func (s *Memory) where(t reflect.Type, query model.Query) ([]reflect.Value, error) {
+	filters := map[string]column{}
+	for name := range query.Filters {
+		current, err := findColumn(t, name)
+		if err != nil {
+			return nil, err
+		}
+		filters[name] = current
+	}
+
+	rows := []reflect.Value{}
+	for _, current := range s.table(t) {
+		if isDeleted(current) {
+			continue
+		}
+		matches := true
+		for name, value := range query.Filters {
+			if fmt.Sprint(current.FieldByIndex(filters[name].index).Interface()) != fmt.Sprint(value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			rows = append(rows, current)
+		}
+	}
+	return rows, nil
+}
+
+// page returns the rows that match the query filters and keyset ordered and limited by the query
+func (s *Memory) page(t reflect.Type, query model.Query) ([]reflect.Value, error) {
+	rows, err := s.where(t, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.After != nil {
+		after := []reflect.Value{}
+		for _, current := range rows {
+			createdAt := current.FieldByName("CreatedAt").Interface().(time.Time)
+			if createdAt.After(query.After.CreatedAt) ||
+				(createdAt.Equal(query.After.CreatedAt) && idOf(current).String() > query.After.ID.String()) {
+				after = append(after, current)
+			}
+		}
+		rows = after
+	}
+
+	order := query.Sort
+	if len(order) == 0 {
+		order = []model.Order{{Field: "created_at"}, {Field: "id"}}
+	}
+	sortColumns := []column{}
+	for _, current := range order {
+		sortColumn, err := findColumn(t, current.Field)
+		if err != nil {
+			return nil, err
+		}
+		sortColumns = append(sortColumns, sortColumn)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, current := range sortColumns {
+			result := compare(rows[i].FieldByIndex(current.index), rows[j].FieldByIndex(current.index))
+			if result == 0 {
+				continue
+			}
+			if order[k].Desc {
+				return result > 0
+			}
+			return result < 0
+		}
+		return false
+	})
+
+	if query.Offset > 0 {
+		if query.Offset >= len(rows) {
+			return []reflect.Value{}, nil
+		}
+		rows = rows[query.Offset:]
+	}
+	if query.Limit > 0 && query.Limit < len(rows) {
+		rows = rows[:query.Limit]
+	}
+	return rows, nil
+}
+
+// compare returns the order of two column values
+func compare(a, b reflect.Value) int {
+	switch first := a.Interface().(type) {
+	case time.Time:
+		second := b.Interface().(time.Time)
+		if first.Before(second) {
+			return -1
+		}
+		if first.After(second) {
+			return 1
+		}
+		return 0
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if a.Int() < b.Int() {
+			return -1
+		}
+		if a.Int() > b.Int() {
+			return 1
+		}
+		return 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if a.Uint() < b.Uint() {
+			return -1
+		}
+		if a.Uint() > b.Uint() {
+			return 1
+		}
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
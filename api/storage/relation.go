@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/gofrs/uuid"
+)
+
+var uuidType = reflect.TypeOf(uuid.UUID{})
+var objectType = reflect.TypeOf((*model.Object)(nil)).Elem()
+
+// models are the stored object types, the referenced types are listed before the types referring to them
+var models = []model.Object{&model.User{}, &model.Event{}, &model.Session{}, &model.Subscription{}, &model.Comment{}, &model.RefreshToken{}, &model.RevokedToken{}, &model.Identity{}, &model.ActionToken{}, &model.LoginAttempt{}, &model.TwoFactor{}, &model.RecoveryCode{}, &model.APIKey{}}
+
+// association describes a related object referenced by foreign key field
+type association struct {
+	index    []int
+	foreign  []int
+	column   string
+	parent   reflect.Type
+	onDelete string
+}
+
+// reference is an association of other stored type that refers to given type
+type reference struct {
+	association
+	child reflect.Type
+}
+
+// columnName converts the field name to column name the same way GORM does
+func columnName(name string) string {
+	runes := []rune(name)
+	result := strings.Builder{}
+	for i, current := range runes {
+		if unicode.IsUpper(current) && i > 0 {
+			previousLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || (nextLower && unicode.IsUpper(runes[i-1])) {
+				result.WriteRune('_')
+			}
+		}
+		result.WriteRune(unicode.ToLower(current))
+	}
+	return result.String()
+}
+
+// tagSettings returns the upper cased GORM tag settings of the field
+func tagSettings(field reflect.StructField) map[string]string {
+	settings := map[string]string{}
+	for _, setting := range strings.Split(field.Tag.Get("gorm"), ";") {
+		parts := strings.SplitN(setting, ":", 2)
+		key := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if key == "" {
+			continue
+		}
+		settings[key] = ""
+		if len(parts) == 2 {
+			settings[key] = parts[1]
+		}
+	}
+	return settings
+}
+
+// associations returns the related objects of given struct type referenced by foreign key fields
+func associations(t reflect.Type) []association {
+	result := []association{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous || field.Type.Kind() != reflect.Struct || !reflect.PtrTo(field.Type).Implements(objectType) {
+			continue
+		}
+		foreign, ok := t.FieldByName(fmt.Sprintf("%sID", field.Name))
+		if !ok || foreign.Type != uuidType {
+			continue
+		}
+		onDelete := "RESTRICT"
+		for _, option := range strings.Split(tagSettings(field)["CONSTRAINT"], ",") {
+			parts := strings.SplitN(option, ":", 2)
+			if len(parts) == 2 && strings.ToUpper(parts[0]) == "ONDELETE" {
+				onDelete = strings.ToUpper(parts[1])
+			}
+		}
+		result = append(result, association{
+			index:    []int{i},
+			foreign:  foreign.Index,
+			column:   columnName(foreign.Name),
+			parent:   field.Type,
+			onDelete: onDelete,
+		})
+	}
+	return result
+}
+
+// references returns the associations of the stored types that refer to given type
+func references(t reflect.Type) []reference {
+	result := []reference{}
+	for _, current := range models {
+		child := reflect.TypeOf(current).Elem()
+		for _, association := range associations(child) {
+			if association.parent == t {
+				result = append(result, reference{association: association, child: child})
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRetention is how long the deleted objects are kept when PURGE_RETENTION is not set
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Retention returns how long the deleted objects are kept before they are purged, as set by PURGE_RETENTION
+func Retention() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("PURGE_RETENTION"))
+	if value == "" {
+		return DefaultRetention, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PURGE_RETENTION: %v", err)
+	}
+	return window, nil
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	_ "github.com/jinzhu/gorm/dialects/sqlite" //sqlite database driver
+)
+
+// OpenSQLite opens the SQLite database file
+func OpenSQLite(file string) (*gorm.DB, error) {
+	// Immediate transactions lock the database for writing from the start
+	conn, err := sql.Open("sqlite3", file+"?_txlock=immediate&_busy_timeout=5000&_foreign_keys=1")
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open("sqlite3", conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Timestamps are compared as text, so all of them are stored in UTC
+	db.SetNowFuncOverride(func() time.Time {
+		return time.Now().UTC()
+	})
+	return db, nil
+}
@@ -0,0 +1,29 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteReferenced checks if the error is SQLite foreign key violation
+func sqliteReferenced(err error) bool {
+	driverErr, ok := err.(sqlite3.Error)
+	// SQLite reports the restricted delete as trigger constraint
+	return ok && (driverErr.ExtendedCode == sqlite3.ErrConstraintForeignKey || driverErr.ExtendedCode == sqlite3.ErrConstraintTrigger)
+}
+
+// sqliteUnique returns the column of SQLite unique violation error
+func sqliteUnique(err error) (string, bool) {
+	driverErr, ok := err.(sqlite3.Error)
+	if !ok || driverErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return "", false
+	}
+	// The message ends with the columns as {table}.{column}
+	columns := driverErr.Error()[strings.LastIndex(driverErr.Error(), ":")+1:]
+	column := strings.TrimSpace(strings.Split(columns, ",")[0])
+	return column[strings.Index(column, ".")+1:], true
+}
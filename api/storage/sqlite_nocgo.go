@@ -0,0 +1,14 @@
+//go:build !cgo
+// +build !cgo
+
+package storage
+
+// sqliteReferenced reports no SQLite errors, as the SQLite driver is not available without cgo
+func sqliteReferenced(err error) bool {
+	return false
+}
+
+// sqliteUnique reports no SQLite errors, as the SQLite driver is not available without cgo
+func sqliteUnique(err error) (string, bool) {
+	return "", false
+}
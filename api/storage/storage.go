@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrReferenced is returned when the object can not be deleted while other objects refer to it
+var ErrReferenced = errors.New("object is referenced by other objects")
+
+// ErrVersionMismatch is returned when the object was changed since the version that is updated or deleted
+var ErrVersionMismatch = errors.New("object was modified by another request")
+
+// ErrDeletedParent is returned when the object can not be restored while the object it refers to is deleted
+var ErrDeletedParent = errors.New("referenced object is deleted")
+
+// ErrMissingParent is returned when the object refers to object that does not exist or is deleted
+var ErrMissingParent = errors.New("referenced object does not exist")
+
+// ErrUnique is returned when the value of unique field is already used by other object
+var ErrUnique = errors.New("duplicate value of unique field")
+
+// UniqueError tells which unique field has duplicate value, it matches ErrUnique
+type UniqueError struct {
+	Field string
+}
+
+// Error returns the description of the duplicate field
+func (e *UniqueError) Error() string {
+	return fmt.Sprintf("%s is already used", e.Field)
+}
+
+// Unwrap returns ErrUnique
+func (e *UniqueError) Unwrap() error {
+	return ErrUnique
+}
+
+// FieldErrors returns the duplicate field as invalid one
+func (e *UniqueError) FieldErrors() []model.FieldError {
+	return []model.FieldError{{Field: e.Field, Code: model.CodeUnique, Message: e.Error()}}
+}
+
+// Storage is an abstraction of the persistence used by the API server
+type Storage interface {
+	// Save stores the object as new one
+	Save(object model.Object) error
+	// Update updates the stored object and increases its version, when the version is set it should match the stored one
+	Update(object model.Object) error
+	// UpdateColumn sets single column of the stored object with given ID, without changing its version
+	UpdateColumn(object model.Object, uid uuid.UUID, column string, value interface{}) error
+	// Delete marks the stored object as deleted, when the version is set it should match the stored one
+	Delete(object model.Object) error
+	// Restore restores the deleted object with given ID
+	Restore(object model.Object, uid uuid.UUID) error
+	// Purge removes permanently the objects deleted before given time and returns their count
+	Purge(before time.Time) (int, error)
+	// FindByID loads the object with given ID
+	FindByID(object model.Object, uid uuid.UUID) error
+	// Find loads the first object that matches the query
+	Find(object model.Object, query model.Query) error
+	// FindAll returns the objects of the same type that match the query
+	FindAll(object model.Object, query model.Query) ([]model.Object, error)
+	// Count returns count of the objects of the same type that match the query filters
+	Count(object model.Object, query model.Query) (int, error)
+	// Close releases the resources used by the storage
+	Close() error
+}
+
+// Open creates the storage for given database driver
+func Open(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) (Storage, error) {
+	if dbDriver == "memory" {
+		return NewMemory(), nil
+	}
+
+	db, err := Connect(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+	if err != nil {
+		return nil, err
+	}
+	return NewGORM(db)
+}
+
+// Connect opens the SQL database for given database driver without migrating it
+func Connect(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) (*gorm.DB, error) {
+	switch dbDriver {
+	case "postgres", "":
+		DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", dbHost, dbPort, dbUser, dbName, dbPassword)
+		return gorm.Open("postgres", DBURL)
+	case "sqlite":
+		return OpenSQLite(dbName)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %s", dbDriver)
+	}
+}
+
+// reset clears the object before it is loaded
+func reset(object model.Object) {
+	value := reflect.ValueOf(object).Elem()
+	value.Set(reflect.Zero(value.Type()))
+}
+
+// version returns the version of the object
+func version(object model.Object) int {
+	return reflect.ValueOf(object).Elem().FieldByName("Version").Interface().(int)
+}
+
+// setVersion sets the version of the object
+func setVersion(object model.Object, version int) {
+	reflect.ValueOf(object).Elem().FieldByName("Version").SetInt(int64(version))
+}
+
+// blank returns new empty object of the same type
+func blank(object model.Object) model.Object {
+	return reflect.New(reflect.TypeOf(object).Elem()).Interface().(model.Object)
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+)
+
+// tokenState holds the tokens of the login and the time the access token expires
+type tokenState struct {
+	dto.Tokens
+	expiresAt time.Time
+}
+
+// newTokenState returns the state of tokens received now
+func newTokenState(tokens dto.Tokens) tokenState {
+	return tokenState{Tokens: tokens, expiresAt: time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second)}
+}
+
+// LogIn logs in with the email and the password. They are kept, so the client logs in again when the
+// refresh token expires. It returns *TwoFactorRequiredError when the user has to enter TOTP code
+func (c *Client) LogIn(ctx context.Context, email string, password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logIn(ctx, email, password)
+}
+
+// logIn logs in while the tokens are locked
+func (c *Client) logIn(ctx context.Context, email string, password string) error {
+	result := struct {
+		dto.Tokens
+		ChallengeToken string `json:"challenge_token"`
+	}{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/login", payload: dto.Login{Email: email, Password: password}, result: &result, public: true})
+	if err != nil {
+		return err
+	}
+	if result.ChallengeToken != "" {
+		return &TwoFactorRequiredError{Challenge: dto.Challenge{
+			ChallengeToken: result.ChallengeToken,
+			TokenType:      result.TokenType,
+			ExpiresIn:      result.ExpiresIn,
+		}}
+	}
+	c.email, c.password = email, password
+	c.tokens = newTokenState(result.Tokens)
+	return nil
+}
+
+// LogInTOTP completes the login with the challenge and the TOTP code
+func (c *Client) LogInTOTP(ctx context.Context, challenge dto.Challenge, code string) error {
+	return c.logInTwoFactor(ctx, dto.TwoFactor{ChallengeToken: challenge.ChallengeToken, Code: code})
+}
+
+// LogInRecoveryCode completes the login with the challenge and one of the recovery codes
+func (c *Client) LogInRecoveryCode(ctx context.Context, challenge dto.Challenge, recoveryCode string) error {
+	return c.logInTwoFactor(ctx, dto.TwoFactor{ChallengeToken: challenge.ChallengeToken, RecoveryCode: recoveryCode})
+}
+
+// logInTwoFactor completes the login with the second factor. The credentials are not kept,
+// as the client can not log in again without new code
+func (c *Client) logInTwoFactor(ctx context.Context, payload dto.TwoFactor) error {
+	tokens := dto.Tokens{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/login/totp", payload: payload, result: &tokens, public: true})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.email, c.password = "", ""
+	c.tokens = newTokenState(tokens)
+	return nil
+}
+
+// LogOut revokes the tokens of the login and forgets the credentials
+func (c *Client) LogOut(ctx context.Context) error {
+	c.mu.Lock()
+	refreshToken := c.tokens.RefreshToken
+	c.mu.Unlock()
+
+	err := c.do(ctx, call{method: http.MethodPost, path: "/logout", payload: dto.Refresh{RefreshToken: refreshToken}})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = tokenState{}
+	c.email, c.password = "", ""
+	return nil
+}
+
+// Tokens returns the current tokens, e.g. to keep them between the runs
+func (c *Client) Tokens() dto.Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens.Tokens
+}
+
+// SetTokens sets the tokens from previous login, the access token is considered valid for ExpiresIn seconds from now
+func (c *Client) SetTokens(tokens dto.Tokens) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = newTokenState(tokens)
+}
+
+// authorize adds the authentication to the request. It logs in when the client has no tokens and
+// refreshes the access token when it expires soon. It returns the access token it used
+func (c *Client) authorize(ctx context.Context, request *http.Request) (string, error) {
+	if c.apiKey != "" {
+		request.Header.Set("X-API-Key", c.apiKey)
+		return "", nil
+	}
+
+	c.mu.Lock()
+	current := c.tokens
+	c.mu.Unlock()
+	if current.AccessToken == "" || time.Until(current.expiresAt) < refreshBefore {
+		err := c.refresh(ctx, current.AccessToken)
+		if err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		current = c.tokens
+		c.mu.Unlock()
+	}
+	request.Header.Set("Authorization", "Bearer "+current.AccessToken)
+	return current.AccessToken, nil
+}
+
+// refresh replaces the access token that expired or was rejected. Nothing is done when other request
+// replaced it meanwhile. The client logs in again when the refresh token is rejected too
+func (c *Client) refresh(ctx context.Context, expired string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens.AccessToken != expired {
+		return nil
+	}
+
+	if c.tokens.RefreshToken != "" {
+		tokens := dto.Tokens{}
+		err := c.do(ctx, call{method: http.MethodPost, path: "/token/refresh", payload: dto.Refresh{RefreshToken: c.tokens.RefreshToken}, result: &tokens, public: true})
+		if err == nil {
+			c.tokens = newTokenState(tokens)
+			return nil
+		}
+		if StatusCode(err) != http.StatusUnauthorized {
+			return err
+		}
+		c.tokens = tokenState{}
+	}
+
+	if c.email == "" {
+		return ErrNotLoggedIn
+	}
+	err := c.logIn(ctx, c.email, c.password)
+	twoFactor := &TwoFactorRequiredError{}
+	if errors.As(err, &twoFactor) {
+		return ErrNotLoggedIn
+	}
+	return err
+}
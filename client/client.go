@@ -0,0 +1,231 @@
+// Package client is a typed client of the API. It logs in and refreshes the tokens when they expire,
+// iterates over the pages of the lists, repeats the idempotent requests that fail with server error
+// and returns the error responses of the API as *Error
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultRetries is the number of times the idempotent requests are repeated after server error
+	defaultRetries = 2
+
+	// defaultBackoff is the wait before the first repeat, it doubles for each next one
+	defaultBackoff = 200 * time.Millisecond
+
+	// refreshBefore is how long before the access token expires it is refreshed
+	refreshBefore = 30 * time.Second
+)
+
+// ifMatch returns the header that makes the change conditional on the version, when it is known
+func ifMatch(version int) http.Header {
+	header := http.Header{}
+	if version > 0 {
+		header.Set("If-Match", fmt.Sprintf("\"%d\"", version))
+	}
+	return header
+}
+
+// Client calls the API on behalf of single user or API key. It is safe for concurrent use
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	apiKey     string
+
+	// mu guards the tokens and the credentials, it is held while the tokens are refreshed
+	// so the refresh token is used once even by concurrent requests
+	mu        sync.Mutex
+	tokens    tokenState
+	email     string
+	password  string
+	userAgent string
+}
+
+// Option configures the client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client that sends the requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times the idempotent requests are repeated after server error
+// and the wait before the first repeat, that doubles for each next one
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithCredentials sets the email and the password the client logs in with when it has no tokens
+// or they can not be refreshed
+func WithCredentials(email string, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// WithAPIKey authenticates the requests with the API key instead of tokens
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New returns client of the API at the base URL, e.g. http://127.0.0.1:8080
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+		userAgent:  "e2e-rest-client",
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// call is single request of the API
+type call struct {
+	method  string
+	path    string
+	header  http.Header
+	payload interface{}
+	result  interface{}
+	// public calls are sent without authentication
+	public bool
+}
+
+// idempotent checks if the request can be repeated safely
+func (r call) idempotent() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// do sends the request and decodes the response in the result. The idempotent requests are repeated
+// after server and network errors, the authenticated ones are repeated once with refreshed token
+// when the access token is rejected
+func (c *Client) do(ctx context.Context, r call) error {
+	var body []byte
+	if r.payload != nil {
+		var err error
+		body, err = json.Marshal(r.payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		request, err := http.NewRequest(r.method, c.baseURL+r.path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request = request.WithContext(ctx)
+		for name, values := range r.header {
+			request.Header[name] = values
+		}
+		if body != nil && request.Header.Get("Content-Type") == "" {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("User-Agent", c.userAgent)
+		token := ""
+		if !r.public {
+			token, err = c.authorize(ctx, request)
+			if err != nil {
+				return err
+			}
+		}
+
+		response, err := c.httpClient.Do(request)
+		if err != nil {
+			if r.idempotent() && attempt < c.retries && c.wait(ctx, attempt) {
+				continue
+			}
+			return err
+		}
+
+		if response.StatusCode >= http.StatusInternalServerError && r.idempotent() && attempt < c.retries {
+			discard(response)
+			if c.wait(ctx, attempt) {
+				continue
+			}
+			return ctx.Err()
+		}
+		if response.StatusCode == http.StatusUnauthorized && token != "" && !refreshed {
+			discard(response)
+			refreshed = true
+			err = c.refresh(ctx, token)
+			if err != nil {
+				return err
+			}
+			attempt--
+			continue
+		}
+		return decode(response, r.result)
+	}
+}
+
+// wait waits before the repeat of the request, it returns false when the context is done
+func (c *Client) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(c.backoff << uint(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// decode reads the result from successful response or returns the error from the response
+func decode(response *http.Response, result interface{}) error {
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return readError(response)
+	}
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		discard(response)
+		return nil
+	}
+	err := json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("cannot decode the response of %s %s: %w", response.Request.Method, response.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// discard reads the rest of the body, so the connection can be reused
+func discard(response *http.Response) {
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+}
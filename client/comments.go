@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/gofrs/uuid"
+)
+
+// CreateComment comments the session, the author is the current user
+func (c *Client) CreateComment(ctx context.Context, comment dto.CommentCreate) (dto.Comment, error) {
+	result := dto.Comment{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/comment", payload: comment, result: &result})
+	return result, err
+}
+
+// GetComment returns the comment
+func (c *Client) GetComment(ctx context.Context, id uuid.UUID) (dto.Comment, error) {
+	result := dto.Comment{}
+	err := c.do(ctx, call{method: http.MethodGet, path: "/comment/" + id.String(), result: &result})
+	return result, err
+}
+
+// UpdateComment updates the comment. The update is rejected when the version is given and the comment was changed meanwhile
+func (c *Client) UpdateComment(ctx context.Context, id uuid.UUID, version int, comment dto.CommentUpdate) (dto.Comment, error) {
+	result := dto.Comment{}
+	err := c.do(ctx, call{method: http.MethodPut, path: "/comment/" + id.String(), header: ifMatch(version), payload: comment, result: &result})
+	return result, err
+}
+
+// DeleteComment deletes the comment. The delete is rejected when the version is given and the comment was changed meanwhile
+func (c *Client) DeleteComment(ctx context.Context, id uuid.UUID, version int) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/comment/" + id.String(), header: ifMatch(version)})
+}
+
+// ListComments returns iterator over the comments
+func (c *Client) ListComments(options *ListOptions) *CommentIterator {
+	return &CommentIterator{iterator: newIterator(c, "/comment", options)}
+}
+
+// ListSessionComments returns iterator over the comments of the session
+func (c *Client) ListSessionComments(sessionID uuid.UUID, options *ListOptions) *CommentIterator {
+	return &CommentIterator{iterator: newIterator(c, "/session/"+sessionID.String()+"/comment", options)}
+}
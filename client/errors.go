@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/response"
+)
+
+// ErrNotLoggedIn is returned when the request needs authentication and the client has no tokens or credentials
+var ErrNotLoggedIn = errors.New("client is not logged in")
+
+// Error is the error response of the API in the problem details format
+type Error struct {
+	response.Problem
+	// RetryAfter is how long to wait before the request is repeated, when the API tells it
+	RetryAfter time.Duration
+}
+
+// Error returns the status and the details of the error
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%d %s", e.Status, e.Title)
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Title, e.Detail)
+}
+
+// StatusCode returns the HTTP status of the error response, or 0 when the error is not from the API
+func StatusCode(err error) int {
+	apiError := &Error{}
+	if errors.As(err, &apiError) {
+		return apiError.Status
+	}
+	return 0
+}
+
+// TwoFactorRequiredError is returned by the login when the user has two-factor authentication enabled.
+// The login is completed with the challenge by LogInTOTP or LogInRecoveryCode
+type TwoFactorRequiredError struct {
+	Challenge dto.Challenge
+}
+
+// Error returns the message of the error
+func (e *TwoFactorRequiredError) Error() string {
+	return "two-factor authentication code is required"
+}
+
+// readError returns the error from the error response. The responses that are not problem
+// details, e.g. from proxies, are returned with their status
+func readError(response *http.Response) error {
+	apiError := &Error{}
+	body, err := ioutil.ReadAll(response.Body)
+	if err == nil {
+		json.Unmarshal(body, &apiError.Problem)
+	}
+	if apiError.Status == 0 {
+		apiError.Status = response.StatusCode
+	}
+	if apiError.Title == "" {
+		apiError.Title = http.StatusText(response.StatusCode)
+	}
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		apiError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiError
+}
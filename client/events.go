@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/gofrs/uuid"
+)
+
+// CreateEvent creates new event
+func (c *Client) CreateEvent(ctx context.Context, event dto.EventCreate) (dto.Event, error) {
+	result := dto.Event{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/event", payload: event, result: &result})
+	return result, err
+}
+
+// GetEvent returns the event
+func (c *Client) GetEvent(ctx context.Context, id uuid.UUID) (dto.Event, error) {
+	result := dto.Event{}
+	err := c.do(ctx, call{method: http.MethodGet, path: "/event/" + id.String(), result: &result})
+	return result, err
+}
+
+// UpdateEvent updates the event. The update is rejected when the version is given and the event was changed meanwhile
+func (c *Client) UpdateEvent(ctx context.Context, id uuid.UUID, version int, event dto.EventUpdate) (dto.Event, error) {
+	result := dto.Event{}
+	err := c.do(ctx, call{method: http.MethodPut, path: "/event/" + id.String(), header: ifMatch(version), payload: event, result: &result})
+	return result, err
+}
+
+// DeleteEvent deletes the event with its sessions. The delete is rejected when the version is given
+// and the event was changed meanwhile
+func (c *Client) DeleteEvent(ctx context.Context, id uuid.UUID, version int) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/event/" + id.String(), header: ifMatch(version)})
+}
+
+// ListEvents returns iterator over the events
+func (c *Client) ListEvents(options *ListOptions) *EventIterator {
+	return &EventIterator{iterator: newIterator(c, "/event", options)}
+}
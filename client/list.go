@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+)
+
+// ListOptions are the paging, sorting and filtering parameters of the lists
+type ListOptions struct {
+	// Limit is the size of the pages, the server default is used when it is 0
+	Limit int
+	// Sort holds comma separated fields, prefixed with - for descending order
+	Sort string
+	// Filters match the fields of the objects by value
+	Filters map[string]string
+}
+
+// path returns the path of the first page of the list
+func (o *ListOptions) path(path string) string {
+	if o == nil {
+		return path
+	}
+	values := url.Values{}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	for field, value := range o.Filters {
+		values.Set(field, value)
+	}
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+// page is a page of the list with undecoded objects
+type page struct {
+	Count *int              `json:"count"`
+	Next  string            `json:"next"`
+	Data  []json.RawMessage `json:"data"`
+}
+
+// iterator fetches the pages of the list one by one following their next links
+type iterator struct {
+	client *Client
+	next   string
+	data   []json.RawMessage
+	count  int
+	err    error
+}
+
+// newIterator returns iterator starting at the first page
+func newIterator(c *Client, path string, options *ListOptions) iterator {
+	return iterator{client: c, next: options.path(path)}
+}
+
+// advance decodes the next object of the list in the target, fetching the next page when needed.
+// It returns false at the end of the list or on error
+func (it *iterator) advance(ctx context.Context, target interface{}) bool {
+	for len(it.data) == 0 {
+		if it.err != nil || it.next == "" {
+			return false
+		}
+		current := page{}
+		it.err = it.client.do(ctx, call{method: http.MethodGet, path: it.next, result: &current})
+		if it.err != nil {
+			return false
+		}
+		it.next = current.Next
+		it.data = current.Data
+		if current.Count != nil {
+			it.count = *current.Count
+		}
+	}
+	it.err = json.Unmarshal(it.data[0], target)
+	it.data = it.data[1:]
+	return it.err == nil
+}
+
+// Err returns the error that stopped the iteration
+func (it *iterator) Err() error {
+	return it.err
+}
+
+// Count returns the total count of the objects in the list, as reported by the first page
+func (it *iterator) Count() int {
+	return it.count
+}
+
+// UserIterator iterates over list of users
+type UserIterator struct {
+	iterator
+	user dto.UserSelf
+}
+
+// Next moves to the next user, it returns false at the end of the list or on error
+func (it *UserIterator) Next(ctx context.Context) bool {
+	it.user = dto.UserSelf{}
+	return it.advance(ctx, &it.user)
+}
+
+// User returns the current user
+func (it *UserIterator) User() dto.UserSelf {
+	return it.user
+}
+
+// EventIterator iterates over list of events
+type EventIterator struct {
+	iterator
+	event dto.Event
+}
+
+// Next moves to the next event, it returns false at the end of the list or on error
+func (it *EventIterator) Next(ctx context.Context) bool {
+	it.event = dto.Event{}
+	return it.advance(ctx, &it.event)
+}
+
+// Event returns the current event
+func (it *EventIterator) Event() dto.Event {
+	return it.event
+}
+
+// SessionIterator iterates over list of sessions
+type SessionIterator struct {
+	iterator
+	session dto.Session
+}
+
+// Next moves to the next session, it returns false at the end of the list or on error
+func (it *SessionIterator) Next(ctx context.Context) bool {
+	it.session = dto.Session{}
+	return it.advance(ctx, &it.session)
+}
+
+// Session returns the current session
+func (it *SessionIterator) Session() dto.Session {
+	return it.session
+}
+
+// SubscriptionIterator iterates over list of subscriptions
+type SubscriptionIterator struct {
+	iterator
+	subscription dto.Subscription
+}
+
+// Next moves to the next subscription, it returns false at the end of the list or on error
+func (it *SubscriptionIterator) Next(ctx context.Context) bool {
+	it.subscription = dto.Subscription{}
+	return it.advance(ctx, &it.subscription)
+}
+
+// Subscription returns the current subscription
+func (it *SubscriptionIterator) Subscription() dto.Subscription {
+	return it.subscription
+}
+
+// CommentIterator iterates over list of comments
+type CommentIterator struct {
+	iterator
+	comment dto.Comment
+}
+
+// Next moves to the next comment, it returns false at the end of the list or on error
+func (it *CommentIterator) Next(ctx context.Context) bool {
+	it.comment = dto.Comment{}
+	return it.advance(ctx, &it.comment)
+}
+
+// Comment returns the current comment
+func (it *CommentIterator) Comment() dto.Comment {
+	return it.comment
+}
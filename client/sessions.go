@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/gofrs/uuid"
+)
+
+// CreateSession creates new session of the event, the author is the current user
+func (c *Client) CreateSession(ctx context.Context, session dto.SessionCreate) (dto.Session, error) {
+	result := dto.Session{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/session", payload: session, result: &result})
+	return result, err
+}
+
+// GetSession returns the session
+func (c *Client) GetSession(ctx context.Context, id uuid.UUID) (dto.Session, error) {
+	result := dto.Session{}
+	err := c.do(ctx, call{method: http.MethodGet, path: "/session/" + id.String(), result: &result})
+	return result, err
+}
+
+// UpdateSession updates the session. The update is rejected when the version is given and the session was changed meanwhile
+func (c *Client) UpdateSession(ctx context.Context, id uuid.UUID, version int, session dto.SessionUpdate) (dto.Session, error) {
+	result := dto.Session{}
+	err := c.do(ctx, call{method: http.MethodPut, path: "/session/" + id.String(), header: ifMatch(version), payload: session, result: &result})
+	return result, err
+}
+
+// DeleteSession deletes the session with its comments and subscriptions. The delete is rejected
+// when the version is given and the session was changed meanwhile
+func (c *Client) DeleteSession(ctx context.Context, id uuid.UUID, version int) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/session/" + id.String(), header: ifMatch(version)})
+}
+
+// ListSessions returns iterator over the sessions
+func (c *Client) ListSessions(options *ListOptions) *SessionIterator {
+	return &SessionIterator{iterator: newIterator(c, "/session", options)}
+}
+
+// ListEventSessions returns iterator over the sessions of the event
+func (c *Client) ListEventSessions(eventID uuid.UUID, options *ListOptions) *SessionIterator {
+	return &SessionIterator{iterator: newIterator(c, "/event/"+eventID.String()+"/session", options)}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/gofrs/uuid"
+)
+
+// CreateSubscription subscribes the current user to the session
+func (c *Client) CreateSubscription(ctx context.Context, subscription dto.SubscriptionCreate) (dto.Subscription, error) {
+	result := dto.Subscription{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/subscription", payload: subscription, result: &result})
+	return result, err
+}
+
+// GetSubscription returns the subscription
+func (c *Client) GetSubscription(ctx context.Context, id uuid.UUID) (dto.Subscription, error) {
+	result := dto.Subscription{}
+	err := c.do(ctx, call{method: http.MethodGet, path: "/subscription/" + id.String(), result: &result})
+	return result, err
+}
+
+// UpdateSubscription updates the subscription. The update is rejected when the version is given
+// and the subscription was changed meanwhile
+func (c *Client) UpdateSubscription(ctx context.Context, id uuid.UUID, version int, subscription dto.SubscriptionUpdate) (dto.Subscription, error) {
+	result := dto.Subscription{}
+	err := c.do(ctx, call{method: http.MethodPut, path: "/subscription/" + id.String(), header: ifMatch(version), payload: subscription, result: &result})
+	return result, err
+}
+
+// DeleteSubscription deletes the subscription. The delete is rejected when the version is given
+// and the subscription was changed meanwhile
+func (c *Client) DeleteSubscription(ctx context.Context, id uuid.UUID, version int) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/subscription/" + id.String(), header: ifMatch(version)})
+}
+
+// ListSubscriptions returns iterator over the subscriptions
+func (c *Client) ListSubscriptions(options *ListOptions) *SubscriptionIterator {
+	return &SubscriptionIterator{iterator: newIterator(c, "/subscription", options)}
+}
+
+// ListSessionSubscriptions returns iterator over the subscriptions of the session
+func (c *Client) ListSessionSubscriptions(sessionID uuid.UUID, options *ListOptions) *SubscriptionIterator {
+	return &SubscriptionIterator{iterator: newIterator(c, "/session/"+sessionID.String()+"/subscription", options)}
+}
+
+// ListUserSubscriptions returns iterator over the subscriptions of the user
+func (c *Client) ListUserSubscriptions(userID uuid.UUID, options *ListOptions) *SubscriptionIterator {
+	return &SubscriptionIterator{iterator: newIterator(c, "/user/"+userID.String()+"/subscription", options)}
+}
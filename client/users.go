@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/gofrs/uuid"
+)
+
+// Register creates new user, it does not need login
+func (c *Client) Register(ctx context.Context, user dto.UserCreate) (dto.UserSelf, error) {
+	result := dto.UserSelf{}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/user", payload: user, result: &result, public: true})
+	return result, err
+}
+
+// GetUser returns the user, the email is returned only to the user and to the user managers
+func (c *Client) GetUser(ctx context.Context, id uuid.UUID) (dto.UserSelf, error) {
+	result := dto.UserSelf{}
+	err := c.do(ctx, call{method: http.MethodGet, path: "/user/" + id.String(), result: &result})
+	return result, err
+}
+
+// UpdateUser updates the user. The update is rejected when the version is given and the user was changed meanwhile
+func (c *Client) UpdateUser(ctx context.Context, id uuid.UUID, version int, user dto.UserUpdate) (dto.UserSelf, error) {
+	result := dto.UserSelf{}
+	err := c.do(ctx, call{method: http.MethodPut, path: "/user/" + id.String(), header: ifMatch(version), payload: user, result: &result})
+	return result, err
+}
+
+// DeleteUser deletes the user. The delete is rejected when the version is given and the user was changed meanwhile
+func (c *Client) DeleteUser(ctx context.Context, id uuid.UUID, version int) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/user/" + id.String(), header: ifMatch(version)})
+}
+
+// ListUsers returns iterator over the users
+func (c *Client) ListUsers(options *ListOptions) *UserIterator {
+	return &UserIterator{iterator: newIterator(c, "/user", options)}
+}
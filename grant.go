@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/storage"
+)
+
+const grantUsage = "usage: grant email role..."
+
+// grant executes the grant subcommand that replaces the roles of the user, used to create the first admin
+func grant(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string, args []string) error {
+	if len(args) < 2 {
+		return errors.New(grantUsage)
+	}
+	if dbDriver == "memory" {
+		return errors.New("memory storage has no users to grant roles to")
+	}
+
+	s, err := storage.Open(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	user := model.User{}
+	err = s.Find(&user, model.Query{
+		Filters: map[string]interface{}{"email": args[0]},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot find user %s: %w", args[0], err)
+	}
+
+	// The stored password hash is kept
+	user.Password = ""
+	user.Roles = model.Roles(args[1:])
+	err = s.Update(&user)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Granted %v to %s\n", user.Roles, user.Email)
+	return nil
+}
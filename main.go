@@ -15,12 +15,37 @@ func main() {
 		log.Println(".env file not loaded due to:", err)
 	}
 
+	dbDriver := os.Getenv("DB_DRIVER")
 	dbUser := os.Getenv("POSTGRES_USER")
 	dbPassword := os.Getenv("POSTGRES_PASSWORD")
 	dbPort := os.Getenv("POSTGRES_PORT")
 	dbHost := os.Getenv("POSTGRES_HOST")
 	dbName := os.Getenv("POSTGRES_DB")
+	if dbDriver == "sqlite" {
+		dbName = os.Getenv("SQLITE_FILE")
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "grant" {
+		if err := grant(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		if err := purge(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	server.Initialize(dbUser, dbPassword, dbPort, dbHost, dbName)
+	server.Initialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 	server.Run(":8080")
 }
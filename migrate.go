@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/migration"
+	"github.com/dzahariev/e2e-rest/api/storage"
+)
+
+const migrateUsage = "usage: migrate up|down [steps]|status"
+
+// migrate executes the migrate subcommand against the configured database
+func migrate(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if dbDriver == "memory" {
+		return errors.New("memory storage has no schema to migrate")
+	}
+
+	db, err := storage.Connect(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migration.Up(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied %s\n", m)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		reverted, err := migration.Down(db, steps)
+		if err != nil {
+			return err
+		}
+		for _, m := range reverted {
+			fmt.Printf("Reverted %s\n", m)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		}
+	case "status":
+		statuses, err := migration.List(db)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.AppliedAt == nil {
+				fmt.Printf("%s\tpending\n", status)
+			} else {
+				fmt.Printf("%s\tapplied at %s\n", status, status.AppliedAt.Format(time.RFC3339))
+			}
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
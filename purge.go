@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/storage"
+)
+
+// purge executes the purge subcommand that removes permanently the objects deleted before the retention window
+func purge(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) error {
+	window, err := storage.Retention()
+	if err != nil {
+		return err
+	}
+
+	s, err := storage.Open(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	count, err := s.Purge(time.Now().Add(-window))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d objects deleted more than %s ago\n", count, window)
+	return nil
+}
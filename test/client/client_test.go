@@ -0,0 +1,339 @@
+package clienttests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/controller"
+	"github.com/dzahariev/e2e-rest/api/dto"
+	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/client"
+	. "github.com/dzahariev/e2e-rest/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Client Suite")
+}
+
+var _ = Describe("Tests configuration", func() {
+	var (
+		server        = controller.Server{}
+		dbName        = fmt.Sprintf("cln_%s", strings.ReplaceAll(GetID().String(), "-", ""))
+		validPassword = "secret007"
+		ctx           = context.Background()
+		admin         = model.User{}
+		api           *httptest.Server
+	)
+
+	BeforeSuite(func() {
+		err := LoadEnvironment()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
+		dbUser := os.Getenv("TEST_POSTGRES_USER")
+		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
+		dbPort := os.Getenv("TEST_POSTGRES_PORT")
+		dbHost := os.Getenv("TEST_POSTGRES_HOST")
+
+		err = CreateDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		Expect(err).ShouldNot(HaveOccurred())
+		server.DBInitialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.MailerInitialize()
+		server.RoutesInitialize()
+		api = httptest.NewServer(server.Router)
+	})
+
+	AfterSuite(func() {
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
+		dbUser := os.Getenv("TEST_POSTGRES_USER")
+		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
+		dbPort := os.Getenv("TEST_POSTGRES_PORT")
+		dbHost := os.Getenv("TEST_POSTGRES_HOST")
+
+		api.Close()
+		server.Storage.Close()
+		err := DropDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	BeforeEach(func() {
+		err := RecreateTables(server.Storage)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		admin = model.User{
+			Base: model.Base{
+				ID: GetID(),
+			},
+			Name:     "Super Admin",
+			Email:    "super.admin@mymail.local",
+			Password: validPassword,
+			Roles:    model.Roles{model.RoleAdmin},
+		}
+		err = server.Storage.Save(&admin)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	loggedClient := func(options ...client.Option) *client.Client {
+		c := client.New(api.URL, options...)
+		err := c.LogIn(ctx, admin.Email, validPassword)
+		Expect(err).ShouldNot(HaveOccurred())
+		return c
+	}
+
+	// failing returns server that responds with the status to the first failures requests with the method
+	failing := func(method string, failures int32, status int, calls *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == method && atomic.AddInt32(calls, 1) <= failures {
+				w.WriteHeader(status)
+				return
+			}
+			server.Router.ServeHTTP(w, r)
+		}))
+	}
+
+	var _ = Describe("Client test", func() {
+		Context("login", func() {
+			It("should get tokens", func() {
+				c := loggedClient()
+				Expect(c.Tokens().AccessToken).ShouldNot(BeEmpty())
+				Expect(c.Tokens().RefreshToken).ShouldNot(BeEmpty())
+			})
+
+			It("should return the error of wrong password", func() {
+				err := client.New(api.URL).LogIn(ctx, admin.Email, "wrong")
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should log in lazily with the credentials", func() {
+				c := client.New(api.URL, client.WithCredentials(admin.Email, validPassword))
+				_, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Lazy", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(c.Tokens().AccessToken).ShouldNot(BeEmpty())
+			})
+
+			It("should fail without tokens and credentials", func() {
+				_, err := client.New(api.URL).CreateEvent(ctx, dto.EventCreate{Name: "Anonymous", Year: "2020"})
+				Expect(err).Should(Equal(client.ErrNotLoggedIn))
+			})
+
+			It("should refresh rejected access token", func() {
+				tokens := loggedClient().Tokens()
+				c := client.New(api.URL)
+				c.SetTokens(dto.Tokens{AccessToken: "invalid", RefreshToken: tokens.RefreshToken, TokenType: tokens.TokenType, ExpiresIn: tokens.ExpiresIn})
+
+				_, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Refreshed", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(c.Tokens().AccessToken).ShouldNot(Equal("invalid"))
+				Expect(c.Tokens().RefreshToken).ShouldNot(Equal(tokens.RefreshToken))
+			})
+
+			It("should refresh access token that expires soon", func() {
+				c := loggedClient()
+				tokens := c.Tokens()
+				tokens.ExpiresIn = 0
+				c.SetTokens(tokens)
+
+				_, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Refreshed", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(c.Tokens().RefreshToken).ShouldNot(Equal(tokens.RefreshToken))
+			})
+
+			It("should log in again when the refresh token is rejected", func() {
+				c := client.New(api.URL, client.WithCredentials(admin.Email, validPassword))
+				c.SetTokens(dto.Tokens{AccessToken: "invalid", RefreshToken: "invalid", ExpiresIn: 900})
+
+				_, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Relogged", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(c.Tokens().RefreshToken).ShouldNot(Equal("invalid"))
+			})
+
+			It("should forget the tokens after logout", func() {
+				c := loggedClient()
+				err := c.LogOut(ctx)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(c.Tokens()).Should(Equal(dto.Tokens{}))
+
+				_, err = c.CreateEvent(ctx, dto.EventCreate{Name: "Logged out", Year: "2020"})
+				Expect(err).Should(Equal(client.ErrNotLoggedIn))
+			})
+		})
+
+		Context("resources", func() {
+			It("should register user", func() {
+				c := client.New(api.URL)
+				user, err := c.Register(ctx, dto.UserCreate{Name: "Joe Satriani", Email: "joe.satriani@mymail.local", Password: validPassword})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(user.Email).Should(Equal("joe.satriani@mymail.local"))
+
+				_, err = c.Register(ctx, dto.UserCreate{Name: "Joe Satriani", Email: "joe.satriani@mymail.local", Password: validPassword})
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusConflict))
+
+				err = c.LogIn(ctx, "joe.satriani@mymail.local", validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+				self, err := c.GetUser(ctx, user.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(self.Name).Should(Equal("Joe Satriani"))
+			})
+
+			It("should create, update and delete event", func() {
+				c := loggedClient()
+				event, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Rock Fest", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				updated, err := c.UpdateEvent(ctx, event.ID, event.Version, dto.EventUpdate{Name: "Rock Fest 2", Year: "2021"})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(updated.Version).Should(BeNumerically(">", event.Version))
+
+				_, err = c.UpdateEvent(ctx, event.ID, event.Version, dto.EventUpdate{Name: "Rock Fest 3", Year: "2021"})
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusPreconditionFailed))
+
+				read, err := c.GetEvent(ctx, event.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(read.Name).Should(Equal("Rock Fest 2"))
+
+				err = c.DeleteEvent(ctx, event.ID, read.Version)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = c.GetEvent(ctx, event.ID)
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusNotFound))
+			})
+
+			It("should create session, subscription and comment", func() {
+				c := loggedClient()
+				event, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Rock Fest", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				session, err := c.CreateSession(ctx, dto.SessionCreate{Name: "Opening", Event: dto.Reference{ID: event.ID}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(session.Author.ID).Should(Equal(admin.ID))
+
+				subscription, err := c.CreateSubscription(ctx, dto.SubscriptionCreate{Session: dto.Reference{ID: session.ID}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(subscription.User.ID).Should(Equal(admin.ID))
+
+				comment, err := c.CreateComment(ctx, dto.CommentCreate{Message: "Great", Session: dto.Reference{ID: session.ID}})
+				Expect(err).ShouldNot(HaveOccurred())
+				comment, err = c.UpdateComment(ctx, comment.ID, comment.Version, dto.CommentUpdate{Message: "Awesome", Session: dto.Reference{ID: session.ID}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(comment.Message).Should(Equal("Awesome"))
+
+				err = c.DeleteSession(ctx, session.ID, 0)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = c.GetComment(ctx, comment.ID)
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusNotFound))
+			})
+
+			It("should return the invalid fields", func() {
+				_, err := loggedClient().CreateEvent(ctx, dto.EventCreate{Year: "2020"})
+				apiError := &client.Error{}
+				Expect(err).Should(BeAssignableToTypeOf(apiError))
+				apiError = err.(*client.Error)
+				Expect(apiError.Status).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				Expect(apiError.Errors).Should(ContainElement(model.FieldError{Field: "name", Code: model.CodeRequired, Message: "required Name"}))
+			})
+		})
+
+		Context("lists", func() {
+			It("should iterate over all pages", func() {
+				c := loggedClient()
+				for i := 0; i < 5; i++ {
+					_, err := c.CreateEvent(ctx, dto.EventCreate{Name: fmt.Sprintf("Event %d", i), Year: "2020"})
+					Expect(err).ShouldNot(HaveOccurred())
+				}
+
+				names := []string{}
+				events := c.ListEvents(&client.ListOptions{Limit: 2, Sort: "name"})
+				for events.Next(ctx) {
+					names = append(names, events.Event().Name)
+				}
+				Expect(events.Err()).ShouldNot(HaveOccurred())
+				Expect(events.Count()).Should(Equal(5))
+				Expect(names).Should(Equal([]string{"Event 0", "Event 1", "Event 2", "Event 3", "Event 4"}))
+			})
+
+			It("should filter the list", func() {
+				c := loggedClient()
+				_, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Rock Fest", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = c.CreateEvent(ctx, dto.EventCreate{Name: "Jazz Fest", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				events := c.ListEvents(&client.ListOptions{Filters: map[string]string{"name": "Jazz Fest"}})
+				Expect(events.Next(ctx)).Should(BeTrue())
+				Expect(events.Event().Name).Should(Equal("Jazz Fest"))
+				Expect(events.Next(ctx)).Should(BeFalse())
+				Expect(events.Err()).ShouldNot(HaveOccurred())
+			})
+
+			It("should follow the cursors", func() {
+				c := loggedClient()
+				event, err := c.CreateEvent(ctx, dto.EventCreate{Name: "Rock Fest", Year: "2020"})
+				Expect(err).ShouldNot(HaveOccurred())
+				session, err := c.CreateSession(ctx, dto.SessionCreate{Name: "Opening", Event: dto.Reference{ID: event.ID}})
+				Expect(err).ShouldNot(HaveOccurred())
+				for i := 0; i < 3; i++ {
+					_, err := c.CreateComment(ctx, dto.CommentCreate{Message: fmt.Sprintf("Comment %d", i), Session: dto.Reference{ID: session.ID}})
+					Expect(err).ShouldNot(HaveOccurred())
+				}
+
+				count := 0
+				comments := c.ListSessionComments(session.ID, &client.ListOptions{Limit: 2})
+				for comments.Next(ctx) {
+					Expect(comments.Comment().Session.ID).Should(Equal(session.ID))
+					count++
+				}
+				Expect(comments.Err()).ShouldNot(HaveOccurred())
+				Expect(count).Should(Equal(3))
+			})
+
+			It("should stop on error", func() {
+				users := loggedClient().ListUsers(&client.ListOptions{Filters: map[string]string{"unknown": "value"}})
+				Expect(users.Next(ctx)).Should(BeFalse())
+				Expect(client.StatusCode(users.Err())).Should(BeEquivalentTo(http.StatusBadRequest))
+			})
+		})
+
+		Context("retries", func() {
+			It("should repeat the idempotent requests after server error", func() {
+				calls := int32(0)
+				flaky := failing(http.MethodGet, 2, http.StatusServiceUnavailable, &calls)
+				defer flaky.Close()
+
+				c := client.New(flaky.URL, client.WithRetries(2, time.Millisecond), client.WithCredentials(admin.Email, validPassword))
+				events := c.ListEvents(nil)
+				Expect(events.Next(ctx)).Should(BeFalse())
+				Expect(events.Err()).ShouldNot(HaveOccurred())
+				Expect(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(3))
+			})
+
+			It("should return the server error when the retries are exhausted", func() {
+				calls := int32(0)
+				flaky := failing(http.MethodGet, 5, http.StatusServiceUnavailable, &calls)
+				defer flaky.Close()
+
+				c := client.New(flaky.URL, client.WithRetries(2, time.Millisecond), client.WithCredentials(admin.Email, validPassword))
+				_, err := c.GetEvent(ctx, GetID())
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusServiceUnavailable))
+				Expect(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(3))
+			})
+
+			It("should not repeat the other requests", func() {
+				calls := int32(0)
+				flaky := failing(http.MethodPost, 1, http.StatusBadGateway, &calls)
+				defer flaky.Close()
+
+				err := client.New(flaky.URL, client.WithRetries(2, time.Millisecond)).LogIn(ctx, admin.Email, validPassword)
+				Expect(client.StatusCode(err)).Should(BeEquivalentTo(http.StatusBadGateway))
+				Expect(atomic.LoadInt32(&calls)).Should(BeEquivalentTo(1))
+			})
+		})
+	})
+})
@@ -7,13 +7,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/dzahariev/e2e-rest/api/controller"
+	"github.com/dzahariev/e2e-rest/api/dto"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/openapi"
+	"github.com/dzahariev/e2e-rest/api/policy"
+	"github.com/dzahariev/e2e-rest/api/response"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	. "github.com/dzahariev/e2e-rest/test"
+	"github.com/gorilla/mux"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -32,6 +39,7 @@ var (
 		Name:     "Super Admin",
 		Email:    "super.admin@mymail.local",
 		Password: userPassword,
+		Roles:    model.Roles{model.RoleAdmin},
 	}
 
 	validLoginPayload = struct {
@@ -50,7 +58,7 @@ func TestController(t *testing.T) {
 
 func CreateUserAndGetToken(server *controller.Server) string {
 	loggedUser.Password = userPassword
-	err := loggedUser.Save(server.DB)
+	err := server.Storage.Save(&loggedUser)
 	Expect(err).ShouldNot(HaveOccurred())
 
 	token, err := server.GetTokenForUser(validLoginPayload.Email, validLoginPayload.Password)
@@ -165,6 +173,10 @@ var _ = Describe("Tests configuration", func() {
 				Year: "2020",
 			},
 			EventID: event1ID},
+		Parents: []model.Object{eventEntityType.NewEntity},
+		Payload: func() interface{} {
+			return dto.SessionCreate{Name: "Main theme", Event: dto.Reference{ID: eventEntityType.NewEntity.GetID()}}
+		},
 	}
 
 	// Subscription
@@ -247,6 +259,10 @@ var _ = Describe("Tests configuration", func() {
 			},
 			SessionID: session1ID,
 		},
+		Parents: []model.Object{sessionEntityType.NewEntity},
+		Payload: func() interface{} {
+			return dto.SubscriptionCreate{Session: dto.Reference{ID: sessionEntityType.NewEntity.GetID()}}
+		},
 	}
 
 	// Comment
@@ -331,35 +347,41 @@ var _ = Describe("Tests configuration", func() {
 			},
 			SessionID: session1ID,
 		},
+		Parents: []model.Object{sessionEntityType.NewEntity},
+		Payload: func() interface{} {
+			return dto.CommentCreate{Message: "Special comment!", Session: dto.Reference{ID: sessionEntityType.NewEntity.GetID()}}
+		},
 	}
 
 	BeforeSuite(func() {
 		err := LoadEnvironment()
 		Expect(err).ShouldNot(HaveOccurred())
 
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
 		dbUser := os.Getenv("TEST_POSTGRES_USER")
 		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
 		dbPort := os.Getenv("TEST_POSTGRES_PORT")
 		dbHost := os.Getenv("TEST_POSTGRES_HOST")
 
-		err = CreateDB(server.DB, dbUser, dbPassword, dbPort, dbHost, dbName)
+		err = CreateDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 		Expect(err).ShouldNot(HaveOccurred())
-		server.Initialize(dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.Initialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 	})
 
 	AfterSuite(func() {
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
 		dbUser := os.Getenv("TEST_POSTGRES_USER")
 		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
 		dbPort := os.Getenv("TEST_POSTGRES_PORT")
 		dbHost := os.Getenv("TEST_POSTGRES_HOST")
 
-		server.DB.Close()
-		err := DropDB(server.DB, dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.Storage.Close()
+		err := DropDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
 	BeforeEach(func() {
-		err := RecreateTables(server.DB)
+		err := RecreateTables(server.Storage)
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
@@ -382,6 +404,770 @@ var _ = Describe("Tests configuration", func() {
 		Entry(fmt.Sprintf("should successfully get all %s", commentEntityType.Name), commentEntityType),
 	)
 
+	DescribeTable("Get all for entity should return a page with valid token",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveWithParents(server.Storage, entityType.NewEntity1)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("GET", fmt.Sprintf("/%s?limit=1&sort=-created_at", strings.ToLower(entityType.Name)), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			list := struct {
+				Count    int               `json:"count"`
+				Limit    int               `json:"limit"`
+				Next     string            `json:"next"`
+				Previous string            `json:"previous"`
+				Data     []json.RawMessage `json:"data"`
+			}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &list)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(list.Count).Should(BeNumerically(">=", 2))
+			Expect(list.Limit).Should(BeEquivalentTo(1))
+			Expect(list.Data).Should(HaveLen(1))
+			Expect(list.Next).Should(ContainSubstring("offset=1"))
+			Expect(list.Previous).Should(BeEmpty())
+		},
+		Entry(fmt.Sprintf("should successfully get page of %s", userEntityType.Name), userEntityType),
+		Entry(fmt.Sprintf("should successfully get page of %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should successfully get page of %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should successfully get page of %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should successfully get page of %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Get all for entity should return Status Bad Request with unknown filter",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			request, err := http.NewRequest("GET", fmt.Sprintf("/%s?unknown=value", strings.ToLower(entityType.Name)), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+		},
+		Entry(fmt.Sprintf("should fail to get all %s", userEntityType.Name), userEntityType),
+		Entry(fmt.Sprintf("should fail to get all %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should fail to get all %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should fail to get all %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should fail to get all %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Get all users should not filter or sort by email",
+		func(query string) {
+			token := CreateUserAndGetToken(&server)
+
+			request, err := http.NewRequest("GET", fmt.Sprintf("/user?%s", query), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+		},
+		Entry("should fail to filter by email", "email=john.smith%40mymail.local"),
+		Entry("should fail to sort by email", "sort=email"),
+	)
+
+	DescribeTable("Get all for entity should stream the pages using cursor",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveWithParents(server.Storage, entityType.NewEntity1)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			type page struct {
+				Count      *int   `json:"count"`
+				NextCursor string `json:"next_cursor"`
+				Data       []struct {
+					ID string `json:"id"`
+				} `json:"data"`
+			}
+
+			getPage := func(query string) (int, page) {
+				request, err := http.NewRequest("GET", fmt.Sprintf("/%s?%s", strings.ToLower(entityType.Name), query), nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				request.Header.Set("Authorization", token)
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				result := page{}
+				if requestRecorder.Code == http.StatusOK {
+					err = json.Unmarshal(requestRecorder.Body.Bytes(), &result)
+					Expect(err).ShouldNot(HaveOccurred())
+				}
+				return requestRecorder.Code, result
+			}
+
+			code, first := getPage("limit=1")
+			Expect(code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(first.Data).Should(HaveLen(1))
+			Expect(first.NextCursor).ShouldNot(BeEmpty())
+			Expect(first.Count).ShouldNot(BeNil())
+
+			code, second := getPage(fmt.Sprintf("limit=1&cursor=%s", first.NextCursor))
+			Expect(code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(second.Data).Should(HaveLen(1))
+			Expect(second.Count).Should(BeNil())
+			Expect(second.Data[0].ID).ShouldNot(BeEquivalentTo(first.Data[0].ID))
+
+			code, _ = getPage(fmt.Sprintf("limit=1&cursor=%sinv", first.NextCursor))
+			Expect(code).Should(BeEquivalentTo(http.StatusBadRequest))
+		},
+		Entry(fmt.Sprintf("should successfully stream all %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should successfully stream all %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Nested entities should be created and listed for existing parent",
+		func(parentName string, parent model.Object, childType EntityType) {
+			token := CreateUserAndGetToken(&server)
+			err := SaveWithParents(server.Storage, parent)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveParents(server.Storage, childType)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			path := fmt.Sprintf("/%s/%s/%s", strings.ToLower(parentName), parent.GetID().String(), strings.ToLower(childType.Name))
+			entityJSON, err := childType.CreatePayload()
+			Expect(err).ShouldNot(HaveOccurred())
+			request, err := http.NewRequest("POST", path, bytes.NewBufferString(string(entityJSON)))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+			Expect(requestRecorder.Header().Get("Location")).Should(MatchRegexp("^%s/[0-9a-f-]{36}$", path))
+
+			request, err = http.NewRequest("GET", path, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			list := struct {
+				Count int `json:"count"`
+			}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &list)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(list.Count).Should(BeEquivalentTo(1))
+		},
+		Entry(fmt.Sprintf("should successfully create %s of %s", sessionEntityType.Name, eventEntityType.Name), eventEntityType.Name, eventEntityType.NewEntity, sessionEntityType),
+		Entry(fmt.Sprintf("should successfully create %s of %s", commentEntityType.Name, sessionEntityType.Name), sessionEntityType.Name, sessionEntityType.NewEntity, commentEntityType),
+		Entry(fmt.Sprintf("should successfully create %s of %s", subscriptionEntityType.Name, sessionEntityType.Name), sessionEntityType.Name, sessionEntityType.NewEntity, subscriptionEntityType),
+		Entry(fmt.Sprintf("should successfully create %s of %s", subscriptionEntityType.Name, userEntityType.Name), userEntityType.Name, userEntityType.NewEntity1, subscriptionEntityType),
+	)
+
+	DescribeTable("Nested entities should return Status Not Found for missing parent",
+		func(parentType EntityType, childType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			path := fmt.Sprintf("/%s/%s/%s", strings.ToLower(parentType.Name), GetID().String(), strings.ToLower(childType.Name))
+			request, err := http.NewRequest("GET", path, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNotFound))
+
+			entityJSON, err := json.Marshal(childType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			request, err = http.NewRequest("POST", path, bytes.NewBufferString(string(entityJSON)))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNotFound))
+		},
+		Entry(fmt.Sprintf("should fail to get %s of missing %s", sessionEntityType.Name, eventEntityType.Name), eventEntityType, sessionEntityType),
+		Entry(fmt.Sprintf("should fail to get %s of missing %s", commentEntityType.Name, sessionEntityType.Name), sessionEntityType, commentEntityType),
+		Entry(fmt.Sprintf("should fail to get %s of missing %s", subscriptionEntityType.Name, sessionEntityType.Name), sessionEntityType, subscriptionEntityType),
+		Entry(fmt.Sprintf("should fail to get %s of missing %s", subscriptionEntityType.Name, userEntityType.Name), userEntityType, subscriptionEntityType),
+	)
+
+	Context("filter the events", func() {
+		It("should return only the events from requested year", func() {
+			token := CreateUserAndGetToken(&server)
+			err := SaveWithParents(server.Storage, eventEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("GET", "/event?year=2019", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			list := struct {
+				Count int `json:"count"`
+			}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &list)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(list.Count).Should(BeEquivalentTo(0))
+		})
+	})
+
+	Context("patch the entities", func() {
+		patch := func(token string, path string, contentType string, body string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest("PATCH", path, bytes.NewBufferString(body))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			request.Header.Set("Content-Type", contentType)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			return requestRecorder
+		}
+
+		It("should update only the fields of merge patch", func() {
+			token := CreateUserAndGetToken(&server)
+			event := eventEntityType.NewEntity.(*model.Event)
+			err := server.Storage.Save(event)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			requestRecorder := patch(token, fmt.Sprintf("/event/%s", event.ID), "application/merge-patch+json", `{"name":"Spring Summit"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(requestRecorder.Header().Get("ETag")).To(Equal(`"2"`))
+
+			stored := model.Event{}
+			err = server.Storage.FindByID(&stored, event.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Name).To(Equal("Spring Summit"))
+			Expect(stored.Year).To(Equal(event.Year))
+		})
+
+		It("should apply JSON patch operations", func() {
+			token := CreateUserAndGetToken(&server)
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			requestRecorder := patch(token, fmt.Sprintf("/session/%s", session.ID), "application/json-patch+json",
+				`[{"op":"test","path":"/name","value":"Other"},{"op":"replace","path":"/name","value":"Closing"}]`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+
+			requestRecorder = patch(token, fmt.Sprintf("/session/%s", session.ID), "application/json-patch+json",
+				fmt.Sprintf(`[{"op":"test","path":"/name","value":%q},{"op":"replace","path":"/name","value":"Closing"}]`, session.Name))
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			stored := model.Session{}
+			err = server.Storage.FindByID(&stored, session.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Name).To(Equal("Closing"))
+			Expect(stored.UserID).To(Equal(session.UserID))
+			Expect(stored.EventID).To(Equal(session.EventID))
+		})
+
+		It("should validate the patched entity", func() {
+			token := CreateUserAndGetToken(&server)
+			event := eventEntityType.NewEntity.(*model.Event)
+			err := server.Storage.Save(event)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			requestRecorder := patch(token, fmt.Sprintf("/event/%s", event.ID), "application/merge-patch+json", `{"name":null}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+
+			requestRecorder = patch(token, fmt.Sprintf("/event/%s", event.ID), "application/json", `{"name":"Spring Summit"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnsupportedMediaType))
+		})
+
+		It("should keep the password of the user when it is not patched", func() {
+			token := CreateUserAndGetToken(&server)
+
+			requestRecorder := patch(token, fmt.Sprintf("/user/%s", loggedUser.ID), "application/merge-patch+json", `{"name":"Admin"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			_, err := server.GetTokenForUser(loggedUser.Email, userPassword)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("update the user without password", func() {
+		It("should keep the password", func() {
+			token := CreateUserAndGetToken(&server)
+
+			request, err := http.NewRequest("PUT", fmt.Sprintf("/user/%s", loggedUser.ID), bytes.NewBufferString(fmt.Sprintf(`{"name":"Admin","email":%q}`, loggedUser.Email)))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			_, err = server.GetTokenForUser(loggedUser.Email, userPassword)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("role based access", func() {
+		tokenWithRoles := func(roles ...string) string {
+			user := model.User{Name: "Jane Doe", Email: "jane.doe@mymail.local", Password: userPassword, Roles: roles}
+			err := server.Storage.Save(&user)
+			Expect(err).ShouldNot(HaveOccurred())
+			token, err := server.GetTokenForUser(user.Email, userPassword)
+			Expect(err).ShouldNot(HaveOccurred())
+			return fmt.Sprintf("Bearer %v", token)
+		}
+		call := func(token string, method string, path string, body string) int {
+			request, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			return requestRecorder.Code
+		}
+
+		It("should allow attendee to read but not to create events", func() {
+			token := tokenWithRoles(model.RoleAttendee)
+
+			Expect(call(token, "GET", "/event", "")).Should(BeEquivalentTo(http.StatusOK))
+			Expect(call(token, "POST", "/event", `{"name":"Spring Summit","year":"2021"}`)).Should(BeEquivalentTo(http.StatusForbidden))
+		})
+
+		It("should allow only admin to restore other users", func() {
+			other := model.User{Name: "John Doe", Email: "john.doe@mymail.local", Password: userPassword}
+			err := server.Storage.Save(&other)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&other)
+			Expect(err).ShouldNot(HaveOccurred())
+			path := fmt.Sprintf("/user/%s/restore", other.ID)
+
+			Expect(call(tokenWithRoles(model.RoleOrganizer), "POST", path, "")).Should(BeEquivalentTo(http.StatusForbidden))
+			Expect(call(CreateUserAndGetToken(&server), "POST", path, "")).Should(BeEquivalentTo(http.StatusOK))
+		})
+
+		It("should allow only admin to purge deleted objects", func() {
+			event := model.Event{Name: "Autumn Summit", Year: "2020"}
+			err := server.Storage.Save(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+			os.Setenv("PURGE_RETENTION", "0s")
+			defer os.Unsetenv("PURGE_RETENTION")
+
+			Expect(call(tokenWithRoles(model.RoleOrganizer), "POST", "/purge", "")).Should(BeEquivalentTo(http.StatusForbidden))
+			Expect(server.Storage.Restore(&model.Event{}, event.ID)).Should(Succeed())
+			err = server.Storage.Delete(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(call(CreateUserAndGetToken(&server), "POST", "/purge", "")).Should(BeEquivalentTo(http.StatusOK))
+			Expect(server.Storage.Restore(&model.Event{}, event.ID)).Should(Equal(storage.ErrNotFound))
+		})
+
+		It("should allow organizer to create events", func() {
+			token := tokenWithRoles(model.RoleOrganizer)
+
+			Expect(call(token, "POST", "/event", `{"name":"Spring Summit","year":"2021"}`)).Should(BeEquivalentTo(http.StatusCreated))
+		})
+
+		It("should allow only admin to grant roles", func() {
+			adminToken := CreateUserAndGetToken(&server)
+			token := tokenWithRoles(model.RoleAttendee)
+			user := model.User{}
+			err := server.Storage.Find(&user, model.Query{Filters: map[string]interface{}{"email": "jane.doe@mymail.local"}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(call(token, "PUT", fmt.Sprintf("/user/%s/roles", user.ID), `{"roles":["admin"]}`)).Should(BeEquivalentTo(http.StatusForbidden))
+			Expect(call(adminToken, "PUT", fmt.Sprintf("/user/%s/roles", user.ID), `{"roles":["owner"]}`)).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+			Expect(call(adminToken, "PUT", fmt.Sprintf("/user/%s/roles", user.ID), `{"roles":["organizer","speaker"]}`)).Should(BeEquivalentTo(http.StatusOK))
+
+			stored := model.User{}
+			err = server.Storage.FindByID(&stored, user.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Roles).To(Equal(model.Roles{model.RoleOrganizer, model.RoleSpeaker}))
+			_, err = server.GetTokenForUser(user.Email, userPassword)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should not grant roles on registration", func() {
+			request, err := http.NewRequest("POST", "/user", bytes.NewBufferString(`{"name":"Jane Doe","email":"jane.doe@mymail.local","password":"secret007","roles":["admin"]}`))
+			Expect(err).ShouldNot(HaveOccurred())
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+
+			user := model.User{}
+			err = server.Storage.Find(&user, model.Query{Filters: map[string]interface{}{"email": "jane.doe@mymail.local"}})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(user.Roles).To(Equal(model.Roles{model.RoleAttendee}))
+		})
+
+		It("should have policy for every route that needs authentication", func() {
+			// public routes and logout, that is allowed to every authenticated user
+			public := map[string]bool{
+				"GET /":                      true,
+				"GET /openapi.json":          true,
+				"GET /docs":                  true,
+				"POST /login":                true,
+				"POST /login/totp":           true,
+				"POST /user":                 true,
+				"POST /token/refresh":        true,
+				"POST /logout":               true,
+				"GET /.well-known/jwks.json": true,
+				"GET /login/oidc":            true,
+				"GET /login/oidc/callback":   true,
+				"POST /password/forgot":      true,
+				"POST /password/reset":       true,
+				"POST /user/verify":          true,
+			}
+			err := server.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+				template, err := route.GetPathTemplate()
+				Expect(err).ShouldNot(HaveOccurred())
+				methods, err := route.GetMethods()
+				Expect(err).ShouldNot(HaveOccurred())
+				for _, method := range methods {
+					if public[method+" "+template] {
+						continue
+					}
+					_, ok := policy.Required(method, template)
+					Expect(ok).To(BeTrue(), fmt.Sprintf("missing policy for %s %s", method, template))
+				}
+				return nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("ownership", func() {
+		login := func(email string, roles ...string) (model.User, string) {
+			user := model.User{Name: email, Email: email, Password: userPassword, Roles: roles}
+			err := server.Storage.Save(&user)
+			Expect(err).ShouldNot(HaveOccurred())
+			token, err := server.GetTokenForUser(user.Email, userPassword)
+			Expect(err).ShouldNot(HaveOccurred())
+			return user, fmt.Sprintf("Bearer %v", token)
+		}
+		call := func(token string, method string, path string, body string) *httptest.ResponseRecorder {
+			request, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			return requestRecorder
+		}
+
+		It("should take the author of created comment from the token", func() {
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+			author, token := login("jane.doe@mymail.local", model.RoleAttendee)
+
+			requestRecorder := call(token, "POST", fmt.Sprintf("/session/%s/comment", session.ID), fmt.Sprintf(`{"message":"Great!","author":{"id":%q,"name":"Joe Satriani"}}`, session.UserID))
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+
+			comment := model.Comment{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &comment)
+			Expect(err).ShouldNot(HaveOccurred())
+			stored := model.Comment{}
+			err = server.Storage.FindByID(&stored, comment.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.UserID).To(Equal(author.ID))
+		})
+
+		It("should allow only the author or moderator to change and delete the comment", func() {
+			_, authorToken := login("jane.doe@mymail.local", model.RoleAttendee)
+			_, otherToken := login("jim.doe@mymail.local", model.RoleAttendee)
+			_, organizerToken := login("joan.doe@mymail.local", model.RoleOrganizer)
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			requestRecorder := call(authorToken, "POST", fmt.Sprintf("/session/%s/comment", session.ID), `{"message":"Great!"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+			comment := model.Comment{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &comment)
+			Expect(err).ShouldNot(HaveOccurred())
+			path := fmt.Sprintf("/comment/%s", comment.ID)
+
+			Expect(call(otherToken, "PUT", path, `{"message":"Boring!"}`).Code).Should(BeEquivalentTo(http.StatusForbidden))
+			Expect(call(otherToken, "DELETE", path, "").Code).Should(BeEquivalentTo(http.StatusForbidden))
+			request, err := http.NewRequest("PATCH", path, bytes.NewBufferString(`{"message":"Really great!"}`))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", authorToken)
+			request.Header.Set("Content-Type", "application/merge-patch+json")
+			requestRecorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(call(organizerToken, "DELETE", path, "").Code).Should(BeEquivalentTo(http.StatusNoContent))
+		})
+
+		It("should not subscribe other users", func() {
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+			user, token := login("jane.doe@mymail.local", model.RoleAttendee)
+			other, _ := login("jim.doe@mymail.local", model.RoleAttendee)
+			sessionJSON, err := json.Marshal(session)
+			Expect(err).ShouldNot(HaveOccurred())
+			body := fmt.Sprintf(`{"session":%s}`, sessionJSON)
+
+			Expect(call(token, "POST", fmt.Sprintf("/user/%s/subscription", other.ID), body).Code).Should(BeEquivalentTo(http.StatusForbidden))
+			Expect(call(token, "POST", fmt.Sprintf("/user/%s/subscription", user.ID), body).Code).Should(BeEquivalentTo(http.StatusCreated))
+		})
+	})
+
+	Context("views of the entities", func() {
+		get := func(token string, path string) map[string]interface{} {
+			request, err := http.NewRequest("GET", path, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			view := map[string]interface{}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &view)
+			Expect(err).ShouldNot(HaveOccurred())
+			return view
+		}
+
+		It("should not return the password hash of the registered user", func() {
+			request, err := http.NewRequest("POST", "/user", bytes.NewBufferString(`{"name":"Jane Doe","email":"jane.doe@mymail.local","password":"secret007"}`))
+			Expect(err).ShouldNot(HaveOccurred())
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+
+			view := map[string]interface{}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &view)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(view).Should(HaveKeyWithValue("email", "jane.doe@mymail.local"))
+			Expect(view).ShouldNot(HaveKey("password"))
+		})
+
+		It("should return only the public view of other users", func() {
+			token := CreateUserAndGetToken(&server)
+			user := model.User{Name: "Jane Doe", Email: "jane.doe@mymail.local", Password: userPassword}
+			err := server.Storage.Save(&user)
+			Expect(err).ShouldNot(HaveOccurred())
+			userToken, err := server.GetTokenForUser(user.Email, userPassword)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			view := get(fmt.Sprintf("Bearer %v", userToken), fmt.Sprintf("/user/%s", loggedUser.ID))
+			Expect(view).Should(HaveKeyWithValue("name", loggedUser.Name))
+			Expect(view).ShouldNot(HaveKey("email"))
+			Expect(view).ShouldNot(HaveKey("password"))
+
+			view = get(fmt.Sprintf("Bearer %v", userToken), fmt.Sprintf("/user/%s", user.ID))
+			Expect(view).Should(HaveKeyWithValue("email", user.Email))
+			Expect(view).ShouldNot(HaveKey("password"))
+
+			view = get(token, fmt.Sprintf("/user/%s", user.ID))
+			Expect(view).Should(HaveKeyWithValue("email", user.Email))
+			Expect(view).ShouldNot(HaveKey("password"))
+		})
+
+		It("should reference the author and the event of the session", func() {
+			token := CreateUserAndGetToken(&server)
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			view := get(token, fmt.Sprintf("/session/%s", session.ID))
+			Expect(view).ShouldNot(HaveKey("UserID"))
+			Expect(view).ShouldNot(HaveKey("EventID"))
+			Expect(view["author"]).Should(Equal(map[string]interface{}{"id": session.UserID.String(), "name": session.User.Name}))
+			Expect(view["event"]).Should(Equal(map[string]interface{}{"id": session.EventID.String(), "name": session.Event.Name}))
+		})
+
+		It("should not create the referenced parent", func() {
+			token := CreateUserAndGetToken(&server)
+			body := fmt.Sprintf(`{"name":"Keynote","event":{"id":%q,"name":"Fake Summit","year":"2020"}}`, GetID())
+			request, err := http.NewRequest("POST", "/session", bytes.NewBufferString(body))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+		})
+	})
+
+	Context("error responses", func() {
+		post := func(token string, path string, body string) (*httptest.ResponseRecorder, response.Problem) {
+			request, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+			Expect(err).ShouldNot(HaveOccurred())
+			if token != "" {
+				request.Header.Set("Authorization", token)
+			}
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+
+			problem := response.Problem{}
+			if requestRecorder.Code >= http.StatusBadRequest {
+				Expect(requestRecorder.Header().Get("Content-Type")).To(Equal(response.ProblemType))
+				err = json.Unmarshal(requestRecorder.Body.Bytes(), &problem)
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+			return requestRecorder, problem
+		}
+
+		It("should list all invalid fields", func() {
+			token := CreateUserAndGetToken(&server)
+
+			requestRecorder, problem := post(token, "/session", `{}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+			Expect(problem.Status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(problem.Title).To(Equal(http.StatusText(http.StatusUnprocessableEntity)))
+			Expect(problem.Instance).To(Equal("/session"))
+			Expect(problem.Errors).To(Equal([]model.FieldError{
+				{Field: "name", Code: model.CodeRequired, Message: "required Name"},
+				{Field: "event", Code: model.CodeRequired, Message: "required Event"},
+			}))
+		})
+
+		It("should check the rules of the fields", func() {
+			token := CreateUserAndGetToken(&server)
+
+			requestRecorder, problem := post(token, "/event", fmt.Sprintf(`{"name":%q,"year":"21"}`, strings.Repeat("x", 256)))
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+			Expect(problem.Errors).To(Equal([]model.FieldError{
+				{Field: "name", Code: model.CodeTooLong, Message: "Name should have at most 255 characters"},
+				{Field: "year", Code: model.CodeInvalid, Message: "invalid Year"},
+			}))
+
+			requestRecorder, problem = post(token, "/event", `{"name":"Spring Summit"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+			Expect(problem.Errors).To(Equal([]model.FieldError{{Field: "year", Code: model.CodeRequired, Message: "required Year"}}))
+		})
+
+		It("should return Status Conflict for duplicate unique fields", func() {
+			token := CreateUserAndGetToken(&server)
+
+			requestRecorder, _ := post(token, "/event", `{"name":"Spring Summit","year":"2021"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+			requestRecorder, problem := post(token, "/event", `{"name":"Spring Summit","year":"2022"}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+			Expect(problem.Errors).To(Equal([]model.FieldError{{Field: "name", Code: model.CodeUnique, Message: "name is already used"}}))
+
+			requestRecorder, problem = post("", "/user", fmt.Sprintf(`{"name":"Jane Doe","email":%q,"password":"secret007"}`, loggedUser.Email))
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+			Expect(problem.Errors).To(HaveLen(1))
+			Expect(problem.Errors[0].Field).To(Equal("email"))
+		})
+
+		It("should describe the authentication errors", func() {
+			requestRecorder, problem := post("", "/event", `{}`)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			Expect(problem.Type).To(Equal("about:blank"))
+			Expect(problem.Status).To(Equal(http.StatusUnauthorized))
+			Expect(problem.Instance).To(Equal("/event"))
+			Expect(problem.Errors).To(BeEmpty())
+		})
+	})
+
+	Context("delete the author of sessions", func() {
+		It("should return Status Conflict and keep the user", func() {
+			token := CreateUserAndGetToken(&server)
+			err := SaveWithParents(server.Storage, &model.Session{Name: "Keynote", User: loggedUser, Event: *eventEntityType.NewEntity1.(*model.Event)})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("DELETE", fmt.Sprintf("/user/%s", loggedUser.ID), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+
+			err = server.Storage.FindByID(&model.User{}, loggedUser.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("OpenAPI document", func() {
+		document := func() openapi.Document {
+			request, err := http.NewRequest("GET", "/openapi.json", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			result := openapi.Document{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &result)
+			Expect(err).ShouldNot(HaveOccurred())
+			return result
+		}
+
+		It("should describe every registered route", func() {
+			registered := []string{}
+			err := server.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+				template, err := route.GetPathTemplate()
+				Expect(err).ShouldNot(HaveOccurred())
+				methods, err := route.GetMethods()
+				Expect(err).ShouldNot(HaveOccurred())
+				for _, method := range methods {
+					registered = append(registered, method+" "+template)
+				}
+				return nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			documented := []string{}
+			for path, item := range document().Paths {
+				for method, operation := range item {
+					documented = append(documented, strings.ToUpper(method)+" "+path)
+					Expect(operation.Summary).ShouldNot(BeEmpty(), fmt.Sprintf("missing documentation of %s %s", method, path))
+					Expect(operation.OperationID).ShouldNot(BeEmpty())
+					Expect(operation.Responses).Should(HaveKey("default"))
+				}
+			}
+			Expect(documented).To(ConsistOf(registered))
+			// the documentation of removed or renamed routes is not left behind
+			Expect(controller.DocumentedRoutes()).To(ConsistOf(registered))
+		})
+
+		It("should require authentication for the routes with policy", func() {
+			for path, item := range document().Paths {
+				for method, operation := range item {
+					if _, ok := policy.Required(strings.ToUpper(method), path); ok {
+						Expect(operation.Security).ShouldNot(BeEmpty(), fmt.Sprintf("missing security of %s %s", method, path))
+						Expect(operation.Responses).Should(HaveKey("401"))
+					}
+				}
+			}
+		})
+
+		It("should define all referenced schemas and responses", func() {
+			spec := document()
+			data, err := json.Marshal(spec)
+			Expect(err).ShouldNot(HaveOccurred())
+			for _, match := range regexp.MustCompile(`"\$ref":"#/components/(schemas|responses)/([^"]+)"`).FindAllStringSubmatch(string(data), -1) {
+				if match[1] == "schemas" {
+					Expect(spec.Components.Schemas).Should(HaveKey(match[2]))
+				} else {
+					Expect(spec.Components.Responses).Should(HaveKey(match[2]))
+				}
+			}
+			Expect(spec.Components.Schemas["UserSelf"].Properties).Should(HaveKey("email"))
+			Expect(spec.Components.Schemas["UserSelf"].Properties).ShouldNot(HaveKey("password"))
+			Expect(spec.Components.Schemas["Problem"].Properties).Should(HaveKey("errors"))
+		})
+
+		It("should show the document", func() {
+			request, err := http.NewRequest("GET", "/docs", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(requestRecorder.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+			Expect(requestRecorder.Body.String()).To(ContainSubstring("/openapi.json"))
+			Expect(requestRecorder.Body.String()).To(MatchRegexp(`redoc/v[0-9.]+/bundles`))
+		})
+	})
+
 	DescribeTable("Get all for entity should return Status Unauthorized with wrong token",
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
@@ -419,7 +1205,9 @@ var _ = Describe("Tests configuration", func() {
 	DescribeTable("Create entity should return OK with valid token",
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
-			entityJSON, err := json.Marshal(entityType.NewEntity)
+			err := SaveParents(server.Storage, entityType)
+			Expect(err).ShouldNot(HaveOccurred())
+			entityJSON, err := entityType.CreatePayload()
 			Expect(err).ShouldNot(HaveOccurred())
 			request, err := http.NewRequest("POST", fmt.Sprintf("/%s", strings.ToLower(entityType.Name)), bytes.NewBufferString(string(entityJSON)))
 			Expect(err).ShouldNot(HaveOccurred())
@@ -428,6 +1216,12 @@ var _ = Describe("Tests configuration", func() {
 			requestRecorder := httptest.NewRecorder()
 			server.Router.ServeHTTP(requestRecorder, request)
 			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+			created := struct {
+				ID string `json:"id"`
+			}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &created)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(requestRecorder.Header().Get("Location")).Should(HaveSuffix(fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), created.ID)))
 		},
 		Entry(fmt.Sprintf("should successfully fetch %s", userEntityType.Name), userEntityType),
 		Entry(fmt.Sprintf("should successfully fetch %s", eventEntityType.Name), eventEntityType),
@@ -478,7 +1272,7 @@ var _ = Describe("Tests configuration", func() {
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
 
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			request, err := http.NewRequest("GET", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
@@ -499,7 +1293,7 @@ var _ = Describe("Tests configuration", func() {
 	DescribeTable("Get single entity should return Status Unauthorized with wrong token",
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			request, err := http.NewRequest("GET", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
@@ -519,7 +1313,7 @@ var _ = Describe("Tests configuration", func() {
 
 	DescribeTable("Get single entity should return Status Unauthorized when token is not provided",
 		func(entityType EntityType) {
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			request, err := http.NewRequest("GET", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
@@ -540,7 +1334,7 @@ var _ = Describe("Tests configuration", func() {
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
 
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 			entityType.NewEntity.SetCreatedAt(time.Now())
 
@@ -554,6 +1348,14 @@ var _ = Describe("Tests configuration", func() {
 			requestRecorder := httptest.NewRecorder()
 			server.Router.ServeHTTP(requestRecorder, request)
 			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			result := map[string]interface{}{}
+			err = json.Unmarshal(requestRecorder.Body.Bytes(), &result)
+			Expect(err).ShouldNot(HaveOccurred())
+			createdAt, err := time.Parse(time.RFC3339, result["created_at"].(string))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(createdAt.IsZero()).Should(BeFalse())
+			Expect(result["version"]).Should(BeEquivalentTo(2))
 		},
 		// Entry(fmt.Sprintf("should successfully update single %s", userEntityType.Name), userEntityType),
 		Entry(fmt.Sprintf("should successfully update single %s", eventEntityType.Name), eventEntityType),
@@ -566,7 +1368,7 @@ var _ = Describe("Tests configuration", func() {
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
 
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 			entityType.NewEntity.SetCreatedAt(time.Now())
 
@@ -590,7 +1392,7 @@ var _ = Describe("Tests configuration", func() {
 
 	DescribeTable("Update single entity should return Status Unauthorized when token is not provided",
 		func(entityType EntityType) {
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 			entityType.NewEntity.SetCreatedAt(time.Now())
 
@@ -615,7 +1417,7 @@ var _ = Describe("Tests configuration", func() {
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
 
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			request, err := http.NewRequest("DELETE", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
@@ -633,11 +1435,170 @@ var _ = Describe("Tests configuration", func() {
 		Entry(fmt.Sprintf("should successfully delete single %s", commentEntityType.Name), commentEntityType),
 	)
 
+	DescribeTable("Delete single entity should return Status Not Found for missing entity",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			remove := func(id string) int {
+				request, err := http.NewRequest("DELETE", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), id), nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				request.Header.Set("Authorization", token)
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				return requestRecorder.Code
+			}
+
+			Expect(remove(GetID().String())).Should(BeEquivalentTo(http.StatusNotFound))
+			Expect(remove(entityType.NewEntity.GetID().String())).Should(BeEquivalentTo(http.StatusNoContent))
+			Expect(remove(entityType.NewEntity.GetID().String())).Should(BeEquivalentTo(http.StatusNotFound))
+		},
+		Entry(fmt.Sprintf("should fail to delete missing %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should fail to delete missing %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should fail to delete missing %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should fail to delete missing %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Get single entity should return Not Modified with matching If-None-Match",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("GET", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(requestRecorder.Header().Get("ETag")).To(Equal(`"1"`))
+
+			request.Header.Set("If-None-Match", requestRecorder.Header().Get("ETag"))
+			requestRecorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNotModified))
+			Expect(requestRecorder.Body.Len()).To(BeEquivalentTo(0))
+		},
+		Entry(fmt.Sprintf("should not return unchanged single %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should not return unchanged single %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should not return unchanged single %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should not return unchanged single %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Update single entity should check If-Match",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			entityJSON, err := json.Marshal(entityType.NewEntity1)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("PUT", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), bytes.NewBufferString(string(entityJSON)))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			request.Header.Set("If-Match", `"1"`)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			Expect(requestRecorder.Header().Get("ETag")).To(Equal(`"2"`))
+
+			request, err = http.NewRequest("PUT", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), bytes.NewBufferString(string(entityJSON)))
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			request.Header.Set("If-Match", `"1"`)
+			requestRecorder = httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusPreconditionFailed))
+		},
+		Entry(fmt.Sprintf("should update single unchanged %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should update single unchanged %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should update single unchanged %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should update single unchanged %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Delete single entity should return Precondition Failed with stale If-Match",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Update(entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("DELETE", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+			request.Header.Set("If-Match", `"1"`)
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusPreconditionFailed))
+
+			err = server.Storage.FindByID(entityType.Entity, entityType.NewEntity.GetID())
+			Expect(err).ShouldNot(HaveOccurred())
+		},
+		Entry(fmt.Sprintf("should fail to delete changed single %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should fail to delete changed single %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should fail to delete changed single %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should fail to delete changed single %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Restore single entity should return OK with valid token",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			request, err := http.NewRequest("POST", fmt.Sprintf("/%s/%s/restore", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+			err = server.Storage.FindByID(entityType.Entity, entityType.NewEntity.GetID())
+			Expect(err).ShouldNot(HaveOccurred())
+		},
+		Entry(fmt.Sprintf("should successfully restore single %s", userEntityType.Name), userEntityType),
+		Entry(fmt.Sprintf("should successfully restore single %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should successfully restore single %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should successfully restore single %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should successfully restore single %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Restore single entity should return Status Not Found for missing entity",
+		func(entityType EntityType) {
+			token := CreateUserAndGetToken(&server)
+
+			request, err := http.NewRequest("POST", fmt.Sprintf("/%s/%s/restore", strings.ToLower(entityType.Name), GetID().String()), nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			request.Header.Set("Authorization", token)
+
+			requestRecorder := httptest.NewRecorder()
+			server.Router.ServeHTTP(requestRecorder, request)
+			Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNotFound))
+		},
+		Entry(fmt.Sprintf("should fail to restore missing %s", userEntityType.Name), userEntityType),
+		Entry(fmt.Sprintf("should fail to restore missing %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should fail to restore missing %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should fail to restore missing %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should fail to restore missing %s", commentEntityType.Name), commentEntityType),
+	)
+
 	DescribeTable("Delete single entity should return Status Unauthorized with wrong token",
 		func(entityType EntityType) {
 			token := CreateUserAndGetToken(&server)
 
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			request, err := http.NewRequest("DELETE", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
@@ -657,7 +1618,7 @@ var _ = Describe("Tests configuration", func() {
 
 	DescribeTable("Delete single entity should return Status Unauthorized when token is not provided",
 		func(entityType EntityType) {
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			request, err := http.NewRequest("DELETE", fmt.Sprintf("/%s/%s", strings.ToLower(entityType.Name), entityType.NewEntity.GetID().String()), nil)
@@ -0,0 +1,198 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dzahariev/e2e-rest/api/auth"
+)
+
+// Issuer is a mock OpenID Connect identity provider, that authenticates every user without asking
+type Issuer struct {
+	Server   *httptest.Server
+	ClientID string
+
+	// Claims are added to the ID tokens, they identify the authenticated user
+	Claims map[string]interface{}
+
+	// Audience of the ID tokens, the client ID is used when it is empty
+	Audience string
+
+	mutex    sync.Mutex
+	key      *auth.Key
+	codes    map[string]url.Values
+	requests map[string]int
+}
+
+// NewIssuer starts the identity provider for the client
+func NewIssuer(clientID string) (*Issuer, error) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	issuer := &Issuer{
+		ClientID: clientID,
+		Claims:   map[string]interface{}{},
+		key:      &auth.Key{ID: "mock", Algorithm: "RS256", Signer: private},
+		codes:    map[string]url.Values{},
+		requests: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	issuer.Server = httptest.NewServer(issuer.count(mux))
+	return issuer, nil
+}
+
+// count records the requests by path
+func (i *Issuer) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i.mutex.Lock()
+		i.requests[r.URL.Path]++
+		i.mutex.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Requests returns the count of the requests to the path
+func (i *Issuer) Requests(path string) int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.requests[path]
+}
+
+// RotateKey replaces the key that signs the ID tokens
+func (i *Issuer) RotateKey() error {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	id, err := auth.RandomString(8)
+	if err != nil {
+		return err
+	}
+	i.mutex.Lock()
+	i.key = &auth.Key{ID: id, Algorithm: "RS256", Signer: private}
+	i.mutex.Unlock()
+	return nil
+}
+
+// URL returns the issuer identifier
+func (i *Issuer) URL() string {
+	return i.Server.URL
+}
+
+// Close stops the identity provider
+func (i *Issuer) Close() {
+	i.Server.Close()
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 i.URL(),
+		"authorization_endpoint": i.URL() + "/authorize",
+		"token_endpoint":         i.URL() + "/token",
+		"jwks_uri":               i.URL() + "/jwks",
+	})
+}
+
+// authorize redirects back to the client with authorization code
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("client_id") != i.ClientID {
+		http.Error(w, "invalid client", http.StatusBadRequest)
+		return
+	}
+
+	values := url.Values{}
+	values.Set("state", query.Get("state"))
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		values.Set("error", "invalid_request")
+	} else {
+		code, _ := auth.RandomString(16)
+		i.mutex.Lock()
+		i.codes[code] = query
+		i.mutex.Unlock()
+		values.Set("code", code)
+	}
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token exchanges the authorization code for ID token, when the code verifier matches the code challenge
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	i.mutex.Lock()
+	request, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("client_id") != i.ClientID ||
+		r.PostForm.Get("redirect_uri") != request.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	audience := i.Audience
+	if audience == "" {
+		audience = i.ClientID
+	}
+	claims := jwt.MapClaims{
+		"iss":   i.URL(),
+		"aud":   audience,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": request.Get("nonce"),
+	}
+	for name, value := range i.Claims {
+		claims[name] = value
+	}
+	i.mutex.Lock()
+	key := i.key
+	i.mutex.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	idToken, err := token.SignedString(key.Signer)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": idToken,
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mutex.Lock()
+	key := i.key
+	i.mutex.Unlock()
+	writeJSON(w, http.StatusOK, auth.JWKS{Keys: []auth.JWK{key.JWK()}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
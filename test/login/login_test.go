@@ -2,15 +2,27 @@ package logintests
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dzahariev/e2e-rest/api/auth"
 	"github.com/dzahariev/e2e-rest/api/controller"
+	"github.com/dzahariev/e2e-rest/api/mail"
 	"github.com/dzahariev/e2e-rest/api/model"
 	. "github.com/dzahariev/e2e-rest/test"
 	. "github.com/onsi/ginkgo"
@@ -35,29 +47,33 @@ var _ = Describe("Tests configuration", func() {
 		err := LoadEnvironment()
 		Expect(err).ShouldNot(HaveOccurred())
 
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
 		dbUser := os.Getenv("TEST_POSTGRES_USER")
 		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
 		dbPort := os.Getenv("TEST_POSTGRES_PORT")
 		dbHost := os.Getenv("TEST_POSTGRES_HOST")
 
-		err = CreateDB(server.DB, dbUser, dbPassword, dbPort, dbHost, dbName)
+		err = CreateDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 		Expect(err).ShouldNot(HaveOccurred())
-		server.DBInitialize(dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.DBInitialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.MailerInitialize()
+		server.RoutesInitialize()
 	})
 
 	AfterSuite(func() {
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
 		dbUser := os.Getenv("TEST_POSTGRES_USER")
 		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
 		dbPort := os.Getenv("TEST_POSTGRES_PORT")
 		dbHost := os.Getenv("TEST_POSTGRES_HOST")
 
-		server.DB.Close()
-		err := DropDB(server.DB, dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.Storage.Close()
+		err := DropDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
 	BeforeEach(func() {
-		err := RecreateTables(server.DB)
+		err := RecreateTables(server.Storage)
 		Expect(err).ShouldNot(HaveOccurred())
 
 		// Init vars
@@ -73,10 +89,36 @@ var _ = Describe("Tests configuration", func() {
 
 	})
 
+	login := func() map[string]interface{} {
+		payload := fmt.Sprintf(`{"email":%q,"password":%q}`, user.Email, validPassword)
+		request, err := http.NewRequest("POST", "/login", bytes.NewBufferString(payload))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		requestRecorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(requestRecorder, request)
+		Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+		tokens := map[string]interface{}{}
+		err = json.Unmarshal(requestRecorder.Body.Bytes(), &tokens)
+		Expect(err).ShouldNot(HaveOccurred())
+		return tokens
+	}
+
+	post := func(path string, accessToken interface{}, refreshToken interface{}) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("POST", path, bytes.NewBufferString(fmt.Sprintf(`{"refresh_token":%q}`, refreshToken)))
+		Expect(err).ShouldNot(HaveOccurred())
+		if accessToken != nil {
+			request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		}
+
+		requestRecorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(requestRecorder, request)
+		return requestRecorder
+	}
+
 	var _ = Describe("Login test", func() {
 		Context("check the password hash ", func() {
 			It(fmt.Sprintf("should be the same as saved for user %s", user.Name), func() {
-				err := user.Save(server.DB)
+				err := server.Storage.Save(&user)
 				Expect(err).ShouldNot(HaveOccurred())
 
 				_, err = server.GetTokenForUser(user.Email, validPassword)
@@ -88,7 +130,7 @@ var _ = Describe("Tests configuration", func() {
 
 		Context("check the login API ", func() {
 			It(fmt.Sprintf("should login with valid user and password"), func() {
-				err := user.Save(server.DB)
+				err := server.Storage.Save(&user)
 				Expect(err).ShouldNot(HaveOccurred())
 				newUser := struct {
 					Email    string `json:"email"`
@@ -110,7 +152,7 @@ var _ = Describe("Tests configuration", func() {
 			})
 
 			It(fmt.Sprintf("should not login with invalid user name"), func() {
-				err := user.Save(server.DB)
+				err := server.Storage.Save(&user)
 				Expect(err).ShouldNot(HaveOccurred())
 				newUser := struct {
 					Email    string `json:"email"`
@@ -132,7 +174,7 @@ var _ = Describe("Tests configuration", func() {
 			})
 
 			It(fmt.Sprintf("should not login with invalid password"), func() {
-				err := user.Save(server.DB)
+				err := server.Storage.Save(&user)
 				Expect(err).ShouldNot(HaveOccurred())
 				newUser := struct {
 					Email    string `json:"email"`
@@ -155,5 +197,973 @@ var _ = Describe("Tests configuration", func() {
 
 		})
 
+		Context("check the refresh token API ", func() {
+			It("should return access token and refresh token on login", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				tokens := login()
+				Expect(tokens["access_token"]).ShouldNot(BeEmpty())
+				Expect(tokens["refresh_token"]).ShouldNot(BeEmpty())
+				Expect(tokens["token_type"]).Should(Equal("Bearer"))
+			})
+
+			It("should rotate the refresh token", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				tokens := login()
+
+				requestRecorder := post("/token/refresh", nil, tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				rotated := map[string]interface{}{}
+				err = json.Unmarshal(requestRecorder.Body.Bytes(), &rotated)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(rotated["refresh_token"]).ShouldNot(Equal(tokens["refresh_token"]))
+
+				requestRecorder = post("/token/refresh", nil, rotated["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should revoke the family when used refresh token is presented again", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				tokens := login()
+
+				requestRecorder := post("/token/refresh", nil, tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				rotated := map[string]interface{}{}
+				err = json.Unmarshal(requestRecorder.Body.Bytes(), &rotated)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				requestRecorder = post("/token/refresh", nil, tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+				requestRecorder = post("/token/refresh", nil, rotated["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should not refresh with unknown token", func() {
+				requestRecorder := post("/token/refresh", nil, "unknown")
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+		})
+
+		Context("check the logout API ", func() {
+			It("should revoke the access token and the refresh token", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				tokens := login()
+
+				requestRecorder := post("/logout", tokens["access_token"], tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+
+				requestRecorder = post("/logout", tokens["access_token"], tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+				requestRecorder = post("/token/refresh", nil, tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+		})
+
+		Context("check the asymmetric signing ", func() {
+			// useKeys makes the server sign and verify the tokens with the keys
+			useKeys := func(keys *auth.KeySet) {
+				server.Keys = keys
+				server.RoutesInitialize()
+			}
+
+			AfterEach(func() {
+				useKeys(nil)
+			})
+
+			getUser := func(accessToken interface{}) int {
+				request, err := http.NewRequest("GET", fmt.Sprintf("/user/%s", user.ID), nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				return requestRecorder.Code
+			}
+
+			getJWKS := func() auth.JWKS {
+				request, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				keys := auth.JWKS{}
+				err = json.Unmarshal(requestRecorder.Body.Bytes(), &keys)
+				Expect(err).ShouldNot(HaveOccurred())
+				return keys
+			}
+
+			// publicKey builds the public key from JWK as an independent service would do
+			publicKey := func(key auth.JWK) interface{} {
+				number := func(value string) *big.Int {
+					data, err := base64.RawURLEncoding.DecodeString(value)
+					Expect(err).ShouldNot(HaveOccurred())
+					return new(big.Int).SetBytes(data)
+				}
+				if key.KeyType == "RSA" {
+					return &rsa.PublicKey{N: number(key.N), E: int(number(key.E).Int64())}
+				}
+				Expect(key.Curve).Should(Equal("P-256"))
+				return &ecdsa.PublicKey{Curve: elliptic.P256(), X: number(key.X), Y: number(key.Y)}
+			}
+
+			verify := func(accessToken interface{}, keys auth.JWKS) error {
+				_, err := jwt.Parse(fmt.Sprintf("%s", accessToken), func(token *jwt.Token) (interface{}, error) {
+					for _, key := range keys.Keys {
+						if key.ID == token.Header["kid"] && key.Algorithm == token.Method.Alg() {
+							return publicKey(key), nil
+						}
+					}
+					return nil, fmt.Errorf("unknown key %v", token.Header["kid"])
+				})
+				return err
+			}
+
+			It("should return empty key set for HS256", func() {
+				Expect(getJWKS().Keys).Should(BeEmpty())
+			})
+
+			for _, algorithm := range []string{"RS256", "ES256"} {
+				algorithm := algorithm
+
+				It(fmt.Sprintf("should sign with %s and publish the key", algorithm), func() {
+					keys, err := auth.NewKeySet(algorithm, "", time.Hour, time.Hour)
+					Expect(err).ShouldNot(HaveOccurred())
+					useKeys(keys)
+					err = server.Storage.Save(&user)
+					Expect(err).ShouldNot(HaveOccurred())
+
+					tokens := login()
+					token, _, err := new(jwt.Parser).ParseUnverified(fmt.Sprintf("%s", tokens["access_token"]), jwt.MapClaims{})
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(token.Header["alg"]).Should(Equal(algorithm))
+					Expect(token.Header["kid"]).ShouldNot(BeEmpty())
+					Expect(getUser(tokens["access_token"])).Should(BeEquivalentTo(http.StatusOK))
+
+					jwks := getJWKS()
+					Expect(jwks.Keys).Should(HaveLen(1))
+					Expect(jwks.Keys[0].ID).Should(Equal(token.Header["kid"]))
+					Expect(verify(tokens["access_token"], jwks)).ShouldNot(HaveOccurred())
+				})
+
+				It(fmt.Sprintf("should publish the next %s key before it signs", algorithm), func() {
+					keys, err := auth.NewKeySet(algorithm, "", time.Hour, time.Hour)
+					Expect(err).ShouldNot(HaveOccurred())
+					useKeys(keys)
+					err = server.Storage.Save(&user)
+					Expect(err).ShouldNot(HaveOccurred())
+					before := login()
+
+					next, err := keys.Rotate()
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(next.ActiveAt).Should(BeTemporally("~", time.Now().Add(auth.JWKSMaxAge), time.Second))
+					jwks := getJWKS()
+					Expect(jwks.Keys).Should(HaveLen(2))
+					Expect(jwks.Keys[1].ID).Should(Equal(next.ID))
+
+					after := login()
+					token, _, err := new(jwt.Parser).ParseUnverified(fmt.Sprintf("%s", after["access_token"]), jwt.MapClaims{})
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(token.Header["kid"]).ShouldNot(Equal(next.ID))
+					Expect(getUser(before["access_token"])).Should(BeEquivalentTo(http.StatusOK))
+					Expect(getUser(after["access_token"])).Should(BeEquivalentTo(http.StatusOK))
+					Expect(verify(before["access_token"], jwks)).ShouldNot(HaveOccurred())
+					Expect(verify(after["access_token"], jwks)).ShouldNot(HaveOccurred())
+				})
+
+				It(fmt.Sprintf("should publish the next %s key before the rotation period passes", algorithm), func() {
+					keys, err := auth.NewKeySet(algorithm, "", auth.JWKSMaxAge, time.Hour)
+					Expect(err).ShouldNot(HaveOccurred())
+					useKeys(keys)
+
+					signing, err := keys.Signing()
+					Expect(err).ShouldNot(HaveOccurred())
+					jwks := getJWKS()
+					Expect(jwks.Keys).Should(HaveLen(2))
+					Expect(jwks.Keys[0].ID).Should(Equal(signing.ID))
+					current, err := keys.Signing()
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(current.ID).Should(Equal(signing.ID))
+				})
+			}
+
+			It("should not accept HS256 tokens when keys are configured", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				tokens := login()
+
+				keys, err := auth.NewKeySet("RS256", "", time.Hour, time.Hour)
+				Expect(err).ShouldNot(HaveOccurred())
+				useKeys(keys)
+				Expect(getUser(tokens["access_token"])).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should keep the keys in the directory", func() {
+				dir, err := ioutil.TempDir("", "keys")
+				Expect(err).ShouldNot(HaveOccurred())
+				defer os.RemoveAll(dir)
+
+				keys, err := auth.NewKeySet("ES256", dir, time.Hour, time.Hour)
+				Expect(err).ShouldNot(HaveOccurred())
+				useKeys(keys)
+				err = server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				tokens := login()
+
+				keys, err = auth.NewKeySet("ES256", dir, time.Hour, time.Hour)
+				Expect(err).ShouldNot(HaveOccurred())
+				useKeys(keys)
+				Expect(getUser(tokens["access_token"])).Should(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should not allow grace period shorter than the token lifetime", func() {
+				_, err := auth.NewKeySet("RS256", "", time.Hour, time.Minute)
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("check the OIDC login ", func() {
+			var issuer *Issuer
+
+			BeforeEach(func() {
+				var err error
+				issuer, err = NewIssuer("e2e-rest")
+				Expect(err).ShouldNot(HaveOccurred())
+				issuer.Claims = map[string]interface{}{
+					"sub":            "12345",
+					"email":          user.Email,
+					"email_verified": true,
+					"name":           user.Name,
+				}
+				os.Setenv("OIDC_ISSUER", issuer.URL())
+				os.Setenv("OIDC_CLIENT_ID", issuer.ClientID)
+				os.Setenv("OIDC_REDIRECT_URL", "http://127.0.0.1:8080/login/oidc/callback")
+			})
+
+			AfterEach(func() {
+				issuer.Close()
+				os.Unsetenv("OIDC_ISSUER")
+				os.Unsetenv("OIDC_CLIENT_ID")
+				os.Unsetenv("OIDC_REDIRECT_URL")
+			})
+
+			// authenticate follows the redirects of the flow and returns the response of the callback
+			authenticate := func(changeState bool) *httptest.ResponseRecorder {
+				request, err := http.NewRequest("GET", "/login/oidc", nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusFound))
+				cookies := requestRecorder.Result().Cookies()
+				Expect(cookies).Should(HaveLen(1))
+
+				client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				}}
+				response, err := client.Get(requestRecorder.Header().Get("Location"))
+				Expect(err).ShouldNot(HaveOccurred())
+				response.Body.Close()
+				Expect(response.StatusCode).Should(BeEquivalentTo(http.StatusFound))
+				callback, err := response.Location()
+				Expect(err).ShouldNot(HaveOccurred())
+				if changeState {
+					query := callback.Query()
+					query.Set("state", "other")
+					callback.RawQuery = query.Encode()
+				}
+
+				request, err = http.NewRequest("GET", callback.RequestURI(), nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				request.AddCookie(cookies[0])
+				requestRecorder = httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				return requestRecorder
+			}
+
+			// loggedUser returns the user of the access token
+			loggedUser := func(requestRecorder *httptest.ResponseRecorder) model.User {
+				tokens := map[string]interface{}{}
+				err := json.Unmarshal(requestRecorder.Body.Bytes(), &tokens)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(tokens["refresh_token"]).ShouldNot(BeEmpty())
+
+				token, _, err := new(jwt.Parser).ParseUnverified(fmt.Sprintf("%s", tokens["access_token"]), jwt.MapClaims{})
+				Expect(err).ShouldNot(HaveOccurred())
+				userID, err := auth.ExtractUserID(token)
+				Expect(err).ShouldNot(HaveOccurred())
+				logged := model.User{}
+				err = server.Storage.FindByID(&logged, userID)
+				Expect(err).ShouldNot(HaveOccurred())
+				return logged
+			}
+
+			It("should redirect with PKCE challenge", func() {
+				request, err := http.NewRequest("GET", "/login/oidc", nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusFound))
+
+				location, err := requestRecorder.Result().Location()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(location.Query().Get("code_challenge_method")).Should(Equal("S256"))
+				Expect(location.Query().Get("code_challenge")).ShouldNot(BeEmpty())
+				Expect(location.Query().Get("state")).ShouldNot(BeEmpty())
+				Expect(location.Query().Get("nonce")).ShouldNot(BeEmpty())
+			})
+
+			It("should create the user on first login", func() {
+				requestRecorder := authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				created := loggedUser(requestRecorder)
+				Expect(created.Email).Should(Equal(user.Email))
+				Expect(created.Name).Should(Equal(user.Name))
+				Expect(created.Roles).Should(Equal(model.Roles{model.RoleAttendee}))
+
+				requestRecorder = authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(loggedUser(requestRecorder).ID).Should(Equal(created.ID))
+			})
+
+			It("should link existing user with verified email", func() {
+				verified := user
+				verified.VerifiedEmail = user.Email
+				err := server.Storage.Save(&verified)
+				Expect(err).ShouldNot(HaveOccurred())
+				user.ID = verified.ID
+
+				requestRecorder := authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(loggedUser(requestRecorder).ID).Should(Equal(user.ID))
+
+				// The subject stays linked when the email changes at the identity provider
+				issuer.Claims["email"] = "joe@company.local"
+				requestRecorder = authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(loggedUser(requestRecorder).ID).Should(Equal(user.ID))
+			})
+
+			It("should not link existing user with not verified email", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				issuer.Claims["email_verified"] = false
+				requestRecorder := authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+			})
+
+			It("should not link existing user that has not verified the email", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				requestRecorder := authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+				count, err := server.Storage.Count(&model.Identity{}, model.Query{})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(count).Should(BeEquivalentTo(0))
+			})
+
+			It("should discover the provider and read its keys once", func() {
+				Expect(authenticate(false).Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(authenticate(false).Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(issuer.Requests("/.well-known/openid-configuration")).Should(BeEquivalentTo(1))
+				Expect(issuer.Requests("/jwks")).Should(BeEquivalentTo(1))
+
+				// The keys are read again when the provider rotates them
+				err := issuer.RotateKey()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(authenticate(false).Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(issuer.Requests("/jwks")).Should(BeEquivalentTo(2))
+			})
+
+			It("should reject changed state", func() {
+				requestRecorder := authenticate(true)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should reject ID token for other client", func() {
+				issuer.Audience = "other"
+				requestRecorder := authenticate(false)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should return Not Found when OIDC is not configured", func() {
+				os.Unsetenv("OIDC_ISSUER")
+				request, err := http.NewRequest("GET", "/login/oidc", nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNotFound))
+			})
+		})
+
+		Context("check the password reset and email verification ", func() {
+			var mailDir string
+
+			BeforeEach(func() {
+				var err error
+				mailDir, err = ioutil.TempDir("", "mail")
+				Expect(err).ShouldNot(HaveOccurred())
+				server.Mailer = &mail.File{Dir: mailDir, From: "e2e-rest@mymail.local"}
+			})
+
+			AfterEach(func() {
+				server.Mailer = mail.Log{}
+				os.RemoveAll(mailDir)
+				os.Unsetenv("PASSWORD_RESET_TTL")
+			})
+
+			// mailedToken returns the token from the last email sent to the address
+			mailedToken := func(to string) string {
+				files, err := ioutil.ReadDir(mailDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				for i := len(files) - 1; i >= 0; i-- {
+					data, err := ioutil.ReadFile(filepath.Join(mailDir, files[i].Name()))
+					Expect(err).ShouldNot(HaveOccurred())
+					if strings.Contains(string(data), "To: "+to+"\r\n") {
+						found := regexp.MustCompile(`token: (\S+)`).FindStringSubmatch(string(data))
+						Expect(found).Should(HaveLen(2))
+						return found[1]
+					}
+				}
+				return ""
+			}
+
+			postJSON := func(path string, payload string) *httptest.ResponseRecorder {
+				request, err := http.NewRequest("POST", path, bytes.NewBufferString(payload))
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				return requestRecorder
+			}
+
+			It("should verify the email of registered user", func() {
+				payload, err := json.Marshal(user)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := postJSON("/user", string(payload))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+				token := mailedToken(user.Email)
+				Expect(token).ShouldNot(BeEmpty())
+
+				requestRecorder = postJSON("/user/verify", fmt.Sprintf(`{"token":%q}`, token))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+				requestRecorder = postJSON("/user/verify", fmt.Sprintf(`{"token":%q}`, token))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+
+				verified := model.User{}
+				err = server.Storage.Find(&verified, model.Query{Filters: map[string]interface{}{"email": user.Email}})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(verified.EmailVerified()).Should(BeTrue())
+				err = model.VerifyPassword(verified.Password, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should reset the password and revoke the refresh tokens", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				tokens := login()
+
+				requestRecorder := postJSON("/password/forgot", fmt.Sprintf(`{"email":%q}`, user.Email))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusAccepted))
+				token := mailedToken(user.Email)
+				Expect(token).ShouldNot(BeEmpty())
+
+				requestRecorder = postJSON("/password/reset", fmt.Sprintf(`{"token":%q,"password":"secret008"}`, token))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+				requestRecorder = postJSON("/password/reset", fmt.Sprintf(`{"token":%q,"password":"secret009"}`, token))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+
+				requestRecorder = postJSON("/login", fmt.Sprintf(`{"email":%q,"password":"secret008"}`, user.Email))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				requestRecorder = post("/token/refresh", nil, tokens["refresh_token"])
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should reject invalid new password and keep the token", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := postJSON("/password/forgot", fmt.Sprintf(`{"email":%q}`, user.Email))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusAccepted))
+				token := mailedToken(user.Email)
+
+				requestRecorder = postJSON("/password/reset", fmt.Sprintf(`{"token":%q,"password":%q}`, token, strings.Repeat("s", 73)))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				requestRecorder = postJSON("/password/reset", fmt.Sprintf(`{"token":%q,"password":"secret008"}`, token))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+			})
+
+			It("should require the mailer to be configured", func() {
+				defer os.Setenv("MAILER", os.Getenv("MAILER"))
+				os.Unsetenv("MAILER")
+				_, err := mail.Open()
+				Expect(err).Should(HaveOccurred())
+
+				os.Setenv("MAILER", "log")
+				mailer, err := mail.Open()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(mailer).Should(Equal(mail.Log{}))
+			})
+
+			It("should accept unknown email without sending email", func() {
+				requestRecorder := postJSON("/password/forgot", `{"email":"nobody@mymail.local"}`)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusAccepted))
+				files, err := ioutil.ReadDir(mailDir)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(files).Should(BeEmpty())
+			})
+
+			It("should not reset the password with verification token", func() {
+				payload, err := json.Marshal(user)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder := postJSON("/user", string(payload))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+
+				requestRecorder = postJSON("/password/reset", fmt.Sprintf(`{"token":%q,"password":"secret008"}`, mailedToken(user.Email)))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should not reset the password with expired token", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				os.Setenv("PASSWORD_RESET_TTL", "1ms")
+
+				requestRecorder := postJSON("/password/forgot", fmt.Sprintf(`{"email":%q}`, user.Email))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusAccepted))
+				time.Sleep(10 * time.Millisecond)
+				requestRecorder = postJSON("/password/reset", fmt.Sprintf(`{"token":%q,"password":"secret008"}`, mailedToken(user.Email)))
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+		})
+
+		Context("check the brute-force protection ", func() {
+			BeforeEach(func() {
+				os.Setenv("LOGIN_MAX_FAILURES", "3")
+				os.Setenv("LOGIN_LOCKOUT", "200ms")
+				os.Setenv("LOGIN_IP_MAX_FAILURES", "5")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("LOGIN_MAX_FAILURES")
+				os.Unsetenv("LOGIN_LOCKOUT")
+				os.Unsetenv("LOGIN_IP_MAX_FAILURES")
+			})
+
+			loginFrom := func(ip string, email string, password string) *httptest.ResponseRecorder {
+				payload := fmt.Sprintf(`{"email":%q,"password":%q}`, email, password)
+				request, err := http.NewRequest("POST", "/login", bytes.NewBufferString(payload))
+				Expect(err).ShouldNot(HaveOccurred())
+				request.RemoteAddr = ip + ":40000"
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				return requestRecorder
+			}
+
+			It("should lock the account after failed logins", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				for i := 0; i < 3; i++ {
+					requestRecorder := loginFrom("192.0.2.1", user.Email, "wrong")
+					Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+				}
+				requestRecorder := loginFrom("192.0.2.2", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusLocked))
+				Expect(requestRecorder.Header().Get("Retry-After")).ShouldNot(BeEmpty())
+				_, err = server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).Should(HaveOccurred())
+			})
+
+			It("should keep the account locked while the logins are rejected", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				os.Setenv("LOGIN_LOCKOUT", "1m")
+
+				for i := 0; i < 3; i++ {
+					loginFrom("192.0.2.1", user.Email, "wrong")
+				}
+				for i := 0; i < 50; i++ {
+					requestRecorder := loginFrom(fmt.Sprintf("192.0.2.%d", i+2), user.Email, validPassword)
+					Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusLocked))
+				}
+			})
+
+			It("should double the lockout with each next failure", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				for i := 0; i < 3; i++ {
+					loginFrom("192.0.2.1", user.Email, "wrong")
+				}
+				time.Sleep(250 * time.Millisecond)
+				requestRecorder := loginFrom("192.0.2.1", user.Email, "wrong")
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+
+				// The lockout is 400ms now
+				time.Sleep(250 * time.Millisecond)
+				requestRecorder = loginFrom("192.0.2.1", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusLocked))
+				time.Sleep(250 * time.Millisecond)
+				requestRecorder = loginFrom("192.0.2.1", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+				// The success resets the failures
+				requestRecorder = loginFrom("192.0.2.2", user.Email, "wrong")
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+				requestRecorder = loginFrom("192.0.2.2", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should limit the failed logins from the same address", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				for i := 0; i < 5; i++ {
+					requestRecorder := loginFrom("192.0.2.1", fmt.Sprintf("user%d@mymail.local", i), "wrong")
+					Expect(requestRecorder.Code).ShouldNot(BeEquivalentTo(http.StatusTooManyRequests))
+				}
+				requestRecorder := loginFrom("192.0.2.1", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusTooManyRequests))
+				Expect(requestRecorder.Header().Get("Retry-After")).ShouldNot(BeEmpty())
+
+				requestRecorder = loginFrom("192.0.2.2", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should allow admin to unlock the account and read the login records", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				admin := model.User{
+					Name:     "Steve Vai",
+					Email:    "steve.vai@mymail.local",
+					Password: validPassword,
+					Roles:    model.Roles{model.RoleAdmin},
+				}
+				err = server.Storage.Save(&admin)
+				Expect(err).ShouldNot(HaveOccurred())
+				adminToken, err := server.GetTokenForUser(admin.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				for i := 0; i < 3; i++ {
+					loginFrom("192.0.2.1", user.Email, "wrong")
+				}
+				requestRecorder := loginFrom("192.0.2.1", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusLocked))
+
+				requestRecorder = post(fmt.Sprintf("/user/%s/unlock", user.ID), adminToken, "")
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+				requestRecorder = loginFrom("192.0.2.1", user.Email, validPassword)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+
+				request, err := http.NewRequest("GET", fmt.Sprintf("/user/%s/login-attempt", user.ID), nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+				requestRecorder = httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				list := struct {
+					Count int
+					Data  []model.LoginAttempt
+				}{}
+				err = json.Unmarshal(requestRecorder.Body.Bytes(), &list)
+				Expect(err).ShouldNot(HaveOccurred())
+				outcomes := []string{}
+				for _, attempt := range list.Data {
+					outcomes = append(outcomes, attempt.Outcome)
+				}
+				Expect(list.Count).Should(BeEquivalentTo(6))
+				Expect(outcomes).Should(ConsistOf(model.OutcomeFailure, model.OutcomeFailure, model.OutcomeFailure,
+					model.OutcomeLocked, model.OutcomeUnlocked, model.OutcomeSuccess))
+			})
+
+			It("should not allow other users to unlock the account", func() {
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+				token, err := server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				requestRecorder := post(fmt.Sprintf("/user/%s/unlock", user.ID), token, "")
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusForbidden))
+			})
+		})
+
+		Context("check the API keys ", func() {
+			send := func(method string, path string, header string, value string, payload interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+				body, err := json.Marshal(payload)
+				Expect(err).ShouldNot(HaveOccurred())
+				request, err := http.NewRequest(method, path, bytes.NewBuffer(body))
+				Expect(err).ShouldNot(HaveOccurred())
+				request.Header.Set(header, value)
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				result := map[string]interface{}{}
+				if requestRecorder.Body.Len() > 0 {
+					json.Unmarshal(requestRecorder.Body.Bytes(), &result)
+				}
+				return requestRecorder, result
+			}
+
+			bearer := func() string {
+				token, err := server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+				return fmt.Sprintf("Bearer %s", token)
+			}
+
+			BeforeEach(func() {
+				user.Roles = model.Roles{model.RoleOrganizer}
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should authenticate with the key limited to its scopes", func() {
+				path := fmt.Sprintf("/user/%s/api-key", user.ID)
+				requestRecorder, result := send("POST", path, "Authorization", bearer(), map[string]interface{}{"name": "CI", "scopes": []string{"content:read"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+				key := result["key"].(string)
+				Expect(key).Should(HavePrefix(result["prefix"].(string)))
+				Expect(result).ShouldNot(HaveKey("Hash"))
+				Expect(result["last_used_at"]).Should(BeNil())
+
+				requestRecorder, _ = send("GET", "/event", "X-API-Key", key, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				requestRecorder, _ = send("POST", "/event", "X-API-Key", key, map[string]interface{}{"name": "Rock Fest"})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusForbidden))
+				requestRecorder, _ = send("GET", "/event", "X-API-Key", key+"x", nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+
+				requestRecorder, result = send("GET", path, "Authorization", bearer(), nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(result["count"]).Should(BeEquivalentTo(1))
+				listed := result["data"].([]interface{})[0].(map[string]interface{})
+				Expect(listed["name"]).Should(BeEquivalentTo("CI"))
+				Expect(listed["last_used_at"]).ShouldNot(BeNil())
+				Expect(listed["version"]).Should(BeEquivalentTo(1))
+				Expect(listed).ShouldNot(HaveKey("key"))
+
+				requestRecorder, _ = send("DELETE", fmt.Sprintf("%s/%s", path, listed["id"]), "Authorization", bearer(), nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+				requestRecorder, _ = send("GET", "/event", "X-API-Key", key, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should reject expired keys", func() {
+				expiresAt := time.Now().Add(200 * time.Millisecond)
+				requestRecorder, result := send("POST", fmt.Sprintf("/user/%s/api-key", user.ID), "Authorization", bearer(),
+					map[string]interface{}{"name": "CI", "scopes": []string{"content:read"}, "expires_at": expiresAt})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+				key := result["key"].(string)
+
+				requestRecorder, _ = send("GET", "/event", "X-API-Key", key, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				time.Sleep(250 * time.Millisecond)
+				requestRecorder, _ = send("GET", "/event", "X-API-Key", key, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should not create keys with scopes the user does not have", func() {
+				path := fmt.Sprintf("/user/%s/api-key", user.ID)
+				requestRecorder, _ := send("POST", path, "Authorization", bearer(), map[string]interface{}{"name": "CI", "scopes": []string{"users:manage"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				requestRecorder, _ = send("POST", path, "Authorization", bearer(), map[string]interface{}{"name": "CI", "scopes": []string{"unknown"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				requestRecorder, _ = send("POST", path, "Authorization", bearer(), map[string]interface{}{"name": "CI"})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+
+				// The keys can not create keys with more scopes
+				requestRecorder, result := send("POST", path, "Authorization", bearer(), map[string]interface{}{"name": "CI", "scopes": []string{"api-keys:manage"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+				key := result["key"].(string)
+				requestRecorder, _ = send("POST", path, "X-API-Key", key, map[string]interface{}{"name": "CI", "scopes": []string{"content:read"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				requestRecorder, _ = send("POST", path, "X-API-Key", key, map[string]interface{}{"name": "CI", "scopes": []string{"api-keys:manage"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+			})
+
+			It("should not filter or sort the keys by hash and user", func() {
+				path := fmt.Sprintf("/user/%s/api-key", user.ID)
+				for _, query := range []string{"sort=hash", "hash=value", fmt.Sprintf("user_id=%s", user.ID)} {
+					requestRecorder, _ := send("GET", fmt.Sprintf("%s?%s", path, query), "Authorization", bearer(), nil)
+					Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusBadRequest))
+				}
+				requestRecorder, _ := send("GET", fmt.Sprintf("%s?sort=-name", path), "Authorization", bearer(), nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+			})
+
+			It("should not allow other users to manage the keys", func() {
+				other := model.User{
+					Name:     "Steve Vai",
+					Email:    "steve.vai@mymail.local",
+					Password: validPassword,
+				}
+				err := server.Storage.Save(&other)
+				Expect(err).ShouldNot(HaveOccurred())
+				token, err := server.GetTokenForUser(other.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				path := fmt.Sprintf("/user/%s/api-key", user.ID)
+				requestRecorder, _ := send("POST", path, "Authorization", fmt.Sprintf("Bearer %s", token), map[string]interface{}{"name": "CI", "scopes": []string{"content:read"}})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusForbidden))
+				requestRecorder, _ = send("GET", path, "Authorization", fmt.Sprintf("Bearer %s", token), nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusForbidden))
+			})
+		})
+
+		Context("check the two-factor authentication ", func() {
+			send := func(path string, token string, payload interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+				body, err := json.Marshal(payload)
+				Expect(err).ShouldNot(HaveOccurred())
+				request, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+				Expect(err).ShouldNot(HaveOccurred())
+				if token != "" {
+					request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				}
+
+				requestRecorder := httptest.NewRecorder()
+				server.Router.ServeHTTP(requestRecorder, request)
+				result := map[string]interface{}{}
+				if requestRecorder.Body.Len() > 0 {
+					json.Unmarshal(requestRecorder.Body.Bytes(), &result)
+				}
+				return requestRecorder, result
+			}
+
+			code := func(secret string, step int64) string {
+				result, err := auth.TOTPCode(secret, auth.TOTPCounter(time.Now())+step)
+				Expect(err).ShouldNot(HaveOccurred())
+				return result
+			}
+
+			// enable enrolls and confirms TOTP for the user and returns the secret and the recovery codes
+			enable := func() (string, []interface{}) {
+				token, err := server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder, result := send(fmt.Sprintf("/user/%s/totp", user.ID), token, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusCreated))
+				secret := result["secret"].(string)
+				Expect(result["uri"]).Should(HavePrefix("otpauth://totp/"))
+				Expect(result["uri"]).Should(ContainSubstring("secret=" + secret))
+
+				requestRecorder, _ = send(fmt.Sprintf("/user/%s/totp/confirm", user.ID), token, map[string]string{"code": "000000"})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				requestRecorder, result = send(fmt.Sprintf("/user/%s/totp/confirm", user.ID), token, map[string]string{"code": code(secret, 0)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(result["recovery_codes"]).Should(HaveLen(10))
+				return secret, result["recovery_codes"].([]interface{})
+			}
+
+			challenge := func() string {
+				requestRecorder, result := send("/login", "", map[string]string{"email": user.Email, "password": validPassword})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(result["token_type"]).Should(BeEquivalentTo("challenge"))
+				Expect(result).ShouldNot(HaveKey("access_token"))
+				return result["challenge_token"].(string)
+			}
+
+			BeforeEach(func() {
+				user.Roles = model.Roles{model.RoleOrganizer}
+				err := server.Storage.Save(&user)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should exchange the challenge with valid code for the tokens", func() {
+				secret, _ := enable()
+				_, err := server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).Should(HaveOccurred())
+
+				challengeToken := challenge()
+				requestRecorder, _ := send("/login/totp", "", map[string]string{"challenge_token": challengeToken, "code": "000000"})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+
+				valid := code(secret, 1)
+				requestRecorder, result := send("/login/totp", "", map[string]string{"challenge_token": challengeToken, "code": valid})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(result["access_token"]).ShouldNot(BeEmpty())
+				Expect(result["refresh_token"]).ShouldNot(BeEmpty())
+
+				// The challenge and the code are used once
+				requestRecorder, _ = send("/login/totp", "", map[string]string{"challenge_token": challengeToken, "code": valid})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+				requestRecorder, _ = send("/login/totp", "", map[string]string{"challenge_token": challenge(), "code": valid})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should accept each recovery code once", func() {
+				_, recoveryCodes := enable()
+
+				requestRecorder, result := send("/login/totp", "", map[string]string{"challenge_token": challenge(), "recovery_code": strings.ToUpper(recoveryCodes[0].(string))})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				Expect(result["access_token"]).ShouldNot(BeEmpty())
+
+				requestRecorder, _ = send("/login/totp", "", map[string]string{"challenge_token": challenge(), "recovery_code": recoveryCodes[0].(string)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should reject expired challenge", func() {
+				os.Setenv("TWO_FACTOR_CHALLENGE_TTL", "1ms")
+				defer os.Unsetenv("TWO_FACTOR_CHALLENGE_TTL")
+				secret, _ := enable()
+
+				challengeToken := challenge()
+				time.Sleep(10 * time.Millisecond)
+				requestRecorder, _ := send("/login/totp", "", map[string]string{"challenge_token": challengeToken, "code": code(secret, 1)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+			})
+
+			It("should disable the two-factor authentication with valid code", func() {
+				secret, recoveryCodes := enable()
+				requestRecorder, result := send("/login/totp", "", map[string]string{"challenge_token": challenge(), "code": code(secret, 1)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				token := result["access_token"].(string)
+
+				requestRecorder, _ = send(fmt.Sprintf("/user/%s/totp", user.ID), token, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusConflict))
+				requestRecorder, _ = send(fmt.Sprintf("/user/%s/totp/disable", user.ID), token, map[string]string{"code": "000000"})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnprocessableEntity))
+				requestRecorder, _ = send(fmt.Sprintf("/user/%s/totp/disable", user.ID), token, map[string]string{"recovery_code": recoveryCodes[1].(string)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+
+				_, err := server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should reject the challenge when the two-factor authentication was disabled after it", func() {
+				secret, recoveryCodes := enable()
+				pending := challenge()
+				requestRecorder, result := send("/login/totp", "", map[string]string{"challenge_token": challenge(), "code": code(secret, 1)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusOK))
+				token := result["access_token"].(string)
+				requestRecorder, _ = send(fmt.Sprintf("/user/%s/totp/disable", user.ID), token, map[string]string{"recovery_code": recoveryCodes[0].(string)})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusNoContent))
+
+				requestRecorder, result = send("/login/totp", "", map[string]string{"challenge_token": pending, "code": "000000"})
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusUnauthorized))
+				Expect(result).ShouldNot(HaveKey("access_token"))
+			})
+
+			It("should not allow enrollment for attendees and other users", func() {
+				attendee := model.User{
+					Name:     "Steve Vai",
+					Email:    "steve.vai@mymail.local",
+					Password: validPassword,
+				}
+				err := server.Storage.Save(&attendee)
+				Expect(err).ShouldNot(HaveOccurred())
+				attendeeToken, err := server.GetTokenForUser(attendee.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder, _ := send(fmt.Sprintf("/user/%s/totp", attendee.ID), attendeeToken, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusForbidden))
+
+				token, err := server.GetTokenForUser(user.Email, validPassword)
+				Expect(err).ShouldNot(HaveOccurred())
+				requestRecorder, _ = send(fmt.Sprintf("/user/%s/totp", attendee.ID), token, nil)
+				Expect(requestRecorder.Code).Should(BeEquivalentTo(http.StatusForbidden))
+			})
+		})
+
 	})
 })
@@ -0,0 +1,171 @@
+package migrationtests
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dzahariev/e2e-rest/api/migration"
+	"github.com/dzahariev/e2e-rest/api/storage"
+	. "github.com/dzahariev/e2e-rest/test"
+	"github.com/jinzhu/gorm"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMigration(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Migration Suite")
+}
+
+var _ = Describe("Tests configuration", func() {
+	var (
+		db       *gorm.DB
+		dbDriver string
+		dbName   = fmt.Sprintf("mig_%s", strings.ReplaceAll(GetID().String(), "-", ""))
+		tables   = []string{"users", "events", "sessions", "subscriptions", "comments"}
+	)
+
+	BeforeSuite(func() {
+		err := LoadEnvironment()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		// Memory storage has no schema, so the migrations are checked with SQLite instead
+		dbDriver = os.Getenv("TEST_DB_DRIVER")
+		if dbDriver == "memory" || dbDriver == "" {
+			dbDriver = "sqlite"
+		}
+		dbUser := os.Getenv("TEST_POSTGRES_USER")
+		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
+		dbPort := os.Getenv("TEST_POSTGRES_PORT")
+		dbHost := os.Getenv("TEST_POSTGRES_HOST")
+
+		err = CreateDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		Expect(err).ShouldNot(HaveOccurred())
+		db, err = storage.Connect(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterSuite(func() {
+		dbUser := os.Getenv("TEST_POSTGRES_USER")
+		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
+		dbPort := os.Getenv("TEST_POSTGRES_PORT")
+		dbHost := os.Getenv("TEST_POSTGRES_HOST")
+
+		db.Close()
+		err := DropDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	BeforeEach(func() {
+		_, err := migration.Down(db, len(migration.All()))
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	var _ = Describe("Migration test", func() {
+		It("should apply all pending migrations in order", func() {
+			applied, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(applied).To(HaveLen(len(migration.All())))
+			for i := range applied {
+				Expect(applied[i].Version).To(Equal(migration.All()[i].Version))
+			}
+			for _, table := range tables {
+				Expect(db.HasTable(table)).To(BeTrue())
+			}
+		})
+
+		It("should not apply the migrations twice", func() {
+			_, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			applied, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(applied).To(BeEmpty())
+		})
+
+		It("should revert the last applied migration", func() {
+			_, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			reverted, err := migration.Down(db, 1)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(reverted).To(HaveLen(1))
+			Expect(reverted[0].Version).To(Equal(migration.All()[len(migration.All())-1].Version))
+		})
+
+		It("should drop the tables when all migrations are reverted", func() {
+			_, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = migration.Down(db, len(migration.All()))
+			Expect(err).ShouldNot(HaveOccurred())
+			for _, table := range tables {
+				Expect(db.HasTable(table)).To(BeFalse())
+			}
+		})
+
+		It("should not delete the orphaned rows unless allowed", func() {
+			_, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = migration.Down(db, len(migration.All())-1)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = db.Exec("INSERT INTO sessions (id, name, user_id, event_id) VALUES (?, ?, ?, ?)", GetID(), "Orphan", GetID(), GetID()).Error
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, err = migration.Up(db)
+			Expect(err).Should(MatchError(ContainSubstring("1 in sessions.event_id, 1 in sessions.user_id")))
+			var count int
+			err = db.Table("sessions").Count(&count).Error
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+
+			os.Setenv("MIGRATE_DELETE_ORPHANS", "true")
+			defer os.Unsetenv("MIGRATE_DELETE_ORPHANS")
+			applied, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(applied).To(HaveLen(len(migration.All()) - 1))
+			err = db.Table("sessions").Count(&count).Error
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(0))
+		})
+
+		It("should keep the values of deleted rows unique only after they are purged", func() {
+			_, err := migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			deletedID := GetID()
+			err = db.Exec("INSERT INTO events (id, name, year, deleted_at) VALUES (?, ?, ?, ?)", deletedID, "Spring Summit", "2020", time.Now()).Error
+			Expect(err).ShouldNot(HaveOccurred())
+			err = db.Exec("INSERT INTO events (id, name, year) VALUES (?, ?, ?)", GetID(), "Spring Summit", "2021").Error
+			Expect(err).ShouldNot(HaveOccurred())
+			err = db.Exec("INSERT INTO events (id, name, year) VALUES (?, ?, ?)", GetID(), "Spring Summit", "2022").Error
+			Expect(err).Should(HaveOccurred())
+
+			_, err = migration.Down(db, 1)
+			Expect(err).Should(MatchError(ContainSubstring("2 in events.name")))
+
+			err = db.Exec("DELETE FROM events WHERE id = ?", deletedID).Error
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = migration.Down(db, 1)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should report status of applied and pending migrations", func() {
+			statuses, err := migration.List(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(statuses).To(HaveLen(len(migration.All())))
+			for _, status := range statuses {
+				Expect(status.AppliedAt).To(BeNil())
+			}
+
+			_, err = migration.Up(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			statuses, err = migration.List(db)
+			Expect(err).ShouldNot(HaveOccurred())
+			for _, status := range statuses {
+				Expect(status.AppliedAt).NotTo(BeNil())
+			}
+		})
+	})
+})
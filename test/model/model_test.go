@@ -9,7 +9,9 @@ import (
 
 	"github.com/dzahariev/e2e-rest/api/controller"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	. "github.com/dzahariev/e2e-rest/test"
+	"github.com/gofrs/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -299,39 +301,41 @@ var _ = Describe("Tests configuration", func() {
 		err := LoadEnvironment()
 		Expect(err).ShouldNot(HaveOccurred())
 
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
 		dbUser := os.Getenv("TEST_POSTGRES_USER")
 		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
 		dbPort := os.Getenv("TEST_POSTGRES_PORT")
 		dbHost := os.Getenv("TEST_POSTGRES_HOST")
 
-		err = CreateDB(server.DB, dbUser, dbPassword, dbPort, dbHost, dbName)
+		err = CreateDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 		Expect(err).ShouldNot(HaveOccurred())
-		server.DBInitialize(dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.DBInitialize(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 	})
 
 	AfterSuite(func() {
+		dbDriver := os.Getenv("TEST_DB_DRIVER")
 		dbUser := os.Getenv("TEST_POSTGRES_USER")
 		dbPassword := os.Getenv("TEST_POSTGRES_PASSWORD")
 		dbPort := os.Getenv("TEST_POSTGRES_PORT")
 		dbHost := os.Getenv("TEST_POSTGRES_HOST")
 
-		server.DB.Close()
-		err := DropDB(server.DB, dbUser, dbPassword, dbPort, dbHost, dbName)
+		server.Storage.Close()
+		err := DropDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName)
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
 	BeforeEach(func() {
-		err := RecreateTables(server.DB)
+		err := RecreateTables(server.Storage)
 		Expect(err).ShouldNot(HaveOccurred())
 	})
 
 	DescribeTable("New entity",
 		func(entityType EntityType) {
-			countStart, err := entityType.Entity.Count(server.DB)
+			countStart, err := server.Storage.Count(entityType.Entity, model.Query{})
 			Expect(err).ShouldNot(HaveOccurred())
-			err = entityType.NewEntity.Save(server.DB)
+			err = SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
-			countEnd, err := entityType.Entity.Count(server.DB)
+			countEnd, err := server.Storage.Count(entityType.Entity, model.Query{})
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(countEnd - countStart).To(BeEquivalentTo(1))
 		},
@@ -344,9 +348,9 @@ var _ = Describe("Tests configuration", func() {
 
 	DescribeTable("Fetch entity",
 		func(entityType EntityType) {
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
-			err = entityType.Entity.FindByID(server.DB, entityType.NewEntity.GetID())
+			err = server.Storage.FindByID(entityType.Entity, entityType.NewEntity.GetID())
 			Expect(err).ShouldNot(HaveOccurred())
 
 			Expect(entityType.NewEntity.GetID()).To(BeEquivalentTo(entityType.Entity.GetID()))
@@ -360,16 +364,16 @@ var _ = Describe("Tests configuration", func() {
 
 	DescribeTable("Fetch all entities",
 		func(entityType EntityType) {
-			entitiesStart, err := entityType.Entity.FindAll(server.DB)
+			entitiesStart, err := server.Storage.FindAll(entityType.Entity, model.Query{})
 			Expect(err).ShouldNot(HaveOccurred())
-			err = entityType.NewEntity.Save(server.DB)
+			err = SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
-			err = entityType.NewEntity1.Save(server.DB)
+			err = SaveWithParents(server.Storage, entityType.NewEntity1)
 			Expect(err).ShouldNot(HaveOccurred())
-			entities, err := entityType.Entity.FindAll(server.DB)
+			entities, err := server.Storage.FindAll(entityType.Entity, model.Query{})
 			Expect(err).ShouldNot(HaveOccurred())
 
-			Expect(len(*entities)).To(BeEquivalentTo(len(*entitiesStart) + 2))
+			Expect(len(entities)).To(BeEquivalentTo(len(entitiesStart) + 2))
 		},
 		Entry(fmt.Sprintf("should successfully fetch all %s", userEntityType.Name), userEntityType),
 		Entry(fmt.Sprintf("should successfully fetch all %s", eventEntityType.Name), eventEntityType),
@@ -378,13 +382,148 @@ var _ = Describe("Tests configuration", func() {
 		Entry(fmt.Sprintf("should successfully fetch all %s", commentEntityType.Name), commentEntityType),
 	)
 
+	DescribeTable("Fetch page of entities",
+		func(entityType EntityType) {
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveWithParents(server.Storage, entityType.NewEntity1)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			sort := []model.Order{{Field: "id"}}
+			first, err := server.Storage.FindAll(entityType.Entity, model.Query{Limit: 1, Sort: sort})
+			Expect(err).ShouldNot(HaveOccurred())
+			second, err := server.Storage.FindAll(entityType.Entity, model.Query{Limit: 1, Offset: 1, Sort: sort})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(len(first)).To(BeEquivalentTo(1))
+			Expect(len(second)).To(BeEquivalentTo(1))
+			Expect(first[0].GetID()).ShouldNot(BeEquivalentTo(second[0].GetID()))
+		},
+		Entry(fmt.Sprintf("should successfully fetch page of %s", userEntityType.Name), userEntityType),
+		Entry(fmt.Sprintf("should successfully fetch page of %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should successfully fetch page of %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should successfully fetch page of %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should successfully fetch page of %s", commentEntityType.Name), commentEntityType),
+	)
+
+	DescribeTable("Count filtered entities",
+		func(entityType EntityType) {
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveWithParents(server.Storage, entityType.NewEntity1)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			count, err := server.Storage.Count(entityType.Entity, model.Query{
+				Filters: map[string]interface{}{"id": entityType.NewEntity.GetID()},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(count).To(BeEquivalentTo(1))
+		},
+		Entry(fmt.Sprintf("should successfully count filtered %s", userEntityType.Name), userEntityType),
+		Entry(fmt.Sprintf("should successfully count filtered %s", eventEntityType.Name), eventEntityType),
+		Entry(fmt.Sprintf("should successfully count filtered %s", sessionEntityType.Name), sessionEntityType),
+		Entry(fmt.Sprintf("should successfully count filtered %s", subscriptionEntityType.Name), subscriptionEntityType),
+		Entry(fmt.Sprintf("should successfully count filtered %s", commentEntityType.Name), commentEntityType),
+	)
+
+	Context("unique fields", func() {
+		It("should fail to create two users with the same email", func() {
+			err := server.Storage.Save(&model.User{Name: "Steve Vai", Email: "steve.vai@mymail.local", Password: "secret007"})
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Save(&model.User{Name: "Steve Vai 2", Email: "steve.vai@mymail.local", Password: "secret007"})
+			Expect(err).Should(MatchError(storage.ErrUnique))
+			Expect(err).Should(Equal(&storage.UniqueError{Field: "email"}))
+		})
+
+		It("should fail to create two events with the same name", func() {
+			err := server.Storage.Save(&model.Event{Name: "Spring Summit", Year: "2020"})
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Save(&model.Event{Name: "Spring Summit", Year: "2021"})
+			Expect(err).Should(MatchError(storage.ErrUnique))
+			Expect(err).Should(Equal(&storage.UniqueError{Field: "name"}))
+		})
+
+		It("should reuse the values of deleted objects and not restore them while taken", func() {
+			deleted := model.User{Name: "Steve Vai", Email: "steve.vai@mymail.local", Password: "secret007"}
+			err := server.Storage.Save(&deleted)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&model.User{Base: model.Base{ID: deleted.ID}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Save(&model.User{Name: "Steve Vai", Email: "steve.vai@mymail.local", Password: "secret007"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Restore(&model.User{}, deleted.ID)
+			Expect(err).Should(MatchError(storage.ErrUnique))
+			err = server.Storage.FindByID(&model.User{}, deleted.ID)
+			Expect(err).To(Equal(storage.ErrNotFound))
+
+			// The unique constraints can not be restored while the deleted user is kept
+			_, err = server.Storage.Purge(time.Now().Add(time.Hour))
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("validation", func() {
+		It("should list all invalid fields", func() {
+			err := (&model.User{Email: "steve.vai", Roles: model.Roles{"owner"}}).Validate("")
+			Expect(err).Should(BeAssignableToTypeOf(&model.ValidationError{}))
+			fields := []string{}
+			codes := []string{}
+			for _, current := range err.(*model.ValidationError).Fields {
+				fields = append(fields, current.Field)
+				codes = append(codes, current.Code)
+			}
+			Expect(fields).To(Equal([]string{"name", "email", "password", "roles"}))
+			Expect(codes).To(Equal([]string{model.CodeRequired, model.CodeInvalid, model.CodeRequired, model.CodeUnknown}))
+		})
+
+		It("should keep the message of single invalid field", func() {
+			err := (&model.Event{}).Validate(model.ActionUpdate)
+			Expect(err).Should(MatchError("required Name"))
+		})
+
+		It("should check the rules of the action", func() {
+			user := &model.User{Email: "steve.vai@gmail.com"}
+			Expect(user.Validate(model.ActionLogin)).Should(MatchError("required Password"))
+			Expect(user.Validate(model.ActionUpdate)).Should(MatchError("required Name"))
+			Expect((&model.Event{Name: "Spring Summit"}).Validate(model.ActionCreate)).Should(MatchError("required Year"))
+			Expect((&model.Event{Name: "Spring Summit"}).Validate(model.ActionUpdate)).ShouldNot(HaveOccurred())
+		})
+
+		It("should check the length, the format and the enums", func() {
+			err := (&model.Event{Name: strings.Repeat("x", 256), Year: "21"}).Validate(model.ActionCreate)
+			Expect(err).Should(Equal(&model.ValidationError{Fields: []model.FieldError{
+				{Field: "name", Code: model.CodeTooLong, Message: "Name should have at most 255 characters"},
+				{Field: "year", Code: model.CodeInvalid, Message: "invalid Year"},
+			}}))
+			err = (&model.LoginAttempt{Email: "steve.vai@gmail.com", Outcome: "unknown"}).Validate(model.ActionCreate)
+			Expect(err).Should(MatchError("unknown outcome unknown"))
+		})
+
+		It("should check the dates and compare the fields", func() {
+			key := &model.APIKey{UserID: uuid.Must(uuid.NewV4()), Name: "CI", Prefix: "e2e_", Hash: "hash", Scopes: model.Scopes{"content:read"}}
+			key.CreatedAt = time.Now()
+			key.ExpiresAt = key.CreatedAt.Add(-time.Hour)
+			err := key.Validate(model.ActionUpdate)
+			Expect(err).Should(Equal(&model.ValidationError{Fields: []model.FieldError{
+				{Field: "expires_at", Code: model.CodeOutOfRange, Message: "ExpiresAt should be after CreatedAt"},
+			}}))
+			err = key.Validate(model.ActionCreate)
+			Expect(err).Should(MatchError("ExpiresAt should be after now"))
+			key.ExpiresAt = key.CreatedAt.Add(time.Hour)
+			Expect(key.Validate(model.ActionCreate)).ShouldNot(HaveOccurred())
+		})
+	})
+
 	DescribeTable("Update entity",
 		func(entityType EntityType) {
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 			now := time.Now()
 			entityType.NewEntity.SetCreatedAt(now)
-			err = entityType.NewEntity.Update(server.DB)
+			err = server.Storage.Update(entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
 
 			Expect(entityType.NewEntity.GetCreatedAt()).To(BeEquivalentTo(now))
@@ -398,11 +537,11 @@ var _ = Describe("Tests configuration", func() {
 
 	DescribeTable("Delete entity",
 		func(entityType EntityType) {
-			err := entityType.NewEntity.Save(server.DB)
+			err := SaveWithParents(server.Storage, entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
-			err = entityType.NewEntity.Delete(server.DB)
+			err = server.Storage.Delete(entityType.NewEntity)
 			Expect(err).ShouldNot(HaveOccurred())
-			countEnd, err := entityType.Entity.Count(server.DB)
+			countEnd, err := server.Storage.Count(entityType.Entity, model.Query{})
 			Expect(err).ShouldNot(HaveOccurred())
 
 			Expect(countEnd).To(BeEquivalentTo(0))
@@ -413,4 +552,242 @@ var _ = Describe("Tests configuration", func() {
 		Entry(fmt.Sprintf("should successfully delete the %s", subscriptionEntityType.Name), subscriptionEntityType),
 		Entry(fmt.Sprintf("should successfully delete the %s", commentEntityType.Name), commentEntityType),
 	)
+
+	Context("delete policies", func() {
+		It("should delete the sessions, subscriptions and comments of deleted event", func() {
+			err := SaveWithParents(server.Storage, commentEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveWithParents(server.Storage, subscriptionEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Delete(&model.Event{Base: model.Base{ID: event1ID}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for _, entity := range []model.Object{&model.Session{}, &model.Subscription{}, &model.Comment{}} {
+				count, err := server.Storage.Count(entity, model.Query{})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(count).To(BeEquivalentTo(0))
+			}
+			count, err := server.Storage.Count(&model.User{}, model.Query{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+		})
+
+		It("should not delete the author of sessions", func() {
+			err := SaveWithParents(server.Storage, sessionEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Delete(&model.User{Base: model.Base{ID: user1ID}})
+			Expect(err).To(Equal(storage.ErrReferenced))
+
+			count, err := server.Storage.Count(&model.User{}, model.Query{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+		})
+
+		It("should delete the subscriptions and comments of deleted user", func() {
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+			user := *userEntityType.NewEntity1.(*model.User)
+			err = SaveWithParents(server.Storage, &model.Comment{Message: "Great!", User: user, Session: *session})
+			Expect(err).ShouldNot(HaveOccurred())
+			err = SaveWithParents(server.Storage, &model.Subscription{User: user, Session: *session})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Delete(&user)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for _, entity := range []model.Object{&model.Subscription{}, &model.Comment{}} {
+				count, err := server.Storage.Count(entity, model.Query{})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(count).To(BeEquivalentTo(0))
+			}
+			count, err := server.Storage.Count(&model.Session{}, model.Query{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+		})
+
+		It("should not save objects referring to missing or deleted objects", func() {
+			user := model.User{Name: "Jane Doe", Email: "jane.doe@mymail.local", Password: "secret007"}
+			err := server.Storage.Save(&user)
+			Expect(err).ShouldNot(HaveOccurred())
+			deleted := model.User{Name: "John Doe", Email: "john.doe@mymail.local", Password: "secret007"}
+			err = server.Storage.Save(&deleted)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&model.User{Base: model.Base{ID: deleted.ID}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			code := model.RecoveryCode{UserID: user.ID, Hash: strings.Repeat("a", 64)}
+			err = server.Storage.Save(&code)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Save(&model.RecoveryCode{UserID: GetID(), Hash: strings.Repeat("b", 64)})
+			Expect(err).To(Equal(storage.ErrMissingParent))
+			err = server.Storage.Save(&model.RecoveryCode{UserID: deleted.ID, Hash: strings.Repeat("c", 64)})
+			Expect(err).To(Equal(storage.ErrMissingParent))
+			err = server.Storage.Update(&model.RecoveryCode{Base: model.Base{ID: code.ID}, UserID: GetID(), Hash: code.Hash})
+			Expect(err).To(Equal(storage.ErrMissingParent))
+			err = server.Storage.Update(&model.RecoveryCode{Base: model.Base{ID: code.ID}, UserID: deleted.ID, Hash: code.Hash})
+			Expect(err).To(Equal(storage.ErrMissingParent))
+
+			count, err := server.Storage.Count(&model.RecoveryCode{}, model.Query{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+			err = server.Storage.FindByID(&code, code.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(code.UserID).To(Equal(user.ID))
+		})
+	})
+
+	Context("versions", func() {
+		It("should increase the version on update", func() {
+			event := model.Event{Name: "Autumn Summit", Year: "2020"}
+			err := server.Storage.Save(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(event.Version).To(BeEquivalentTo(1))
+
+			err = server.Storage.Update(&model.Event{Base: model.Base{ID: event.ID, Version: 1}, Name: "Winter Summit"})
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Update(&model.Event{Base: model.Base{ID: event.ID}, Name: "Winter Summit", Year: "2021"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			stored := model.Event{}
+			err = server.Storage.FindByID(&stored, event.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Version).To(BeEquivalentTo(3))
+			Expect(stored.Name).To(Equal("Winter Summit"))
+			Expect(stored.Year).To(Equal("2021"))
+		})
+
+		It("should update single column without changing the version", func() {
+			event := model.Event{Name: "Autumn Summit", Year: "2020"}
+			err := server.Storage.Save(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.UpdateColumn(&model.Event{}, event.ID, "year", "2021")
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.UpdateColumn(&model.Event{}, GetID(), "year", "2021")
+			Expect(err).To(Equal(storage.ErrNotFound))
+
+			stored := model.Event{}
+			err = server.Storage.FindByID(&stored, event.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Version).To(BeEquivalentTo(1))
+			Expect(stored.Name).To(Equal("Autumn Summit"))
+			Expect(stored.Year).To(Equal("2021"))
+		})
+
+		It("should not write the related objects loaded before", func() {
+			session := sessionEntityType.NewEntity.(*model.Session)
+			err := SaveWithParents(server.Storage, session)
+			Expect(err).ShouldNot(HaveOccurred())
+			author := model.User{}
+			err = server.Storage.FindByID(&author, session.UserID)
+			Expect(err).ShouldNot(HaveOccurred())
+			changed := author
+			changed.Name = "Steve Vai"
+			err = server.Storage.Update(&changed)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			comment := model.Comment{Message: "Great!", User: author, Session: *session}
+			err = server.Storage.Save(&comment)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(comment.UserID).To(Equal(author.ID))
+			comment.Message = "Even better!"
+			err = server.Storage.Update(&comment)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			stored := model.User{}
+			err = server.Storage.FindByID(&stored, author.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Name).To(Equal("Steve Vai"))
+			Expect(stored.Version).To(BeEquivalentTo(2))
+		})
+
+		It("should not update or delete with stale version", func() {
+			event := model.Event{Name: "Autumn Summit", Year: "2020"}
+			err := server.Storage.Save(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Update(&model.Event{Base: model.Base{ID: event.ID, Version: 1}, Name: "Winter Summit"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Update(&model.Event{Base: model.Base{ID: event.ID, Version: 1}, Name: "Spring Summit"})
+			Expect(err).To(Equal(storage.ErrVersionMismatch))
+			err = server.Storage.Delete(&model.Event{Base: model.Base{ID: event.ID, Version: 1}})
+			Expect(err).To(Equal(storage.ErrVersionMismatch))
+
+			stored := model.Event{}
+			err = server.Storage.FindByID(&stored, event.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(stored.Name).To(Equal("Winter Summit"))
+		})
+	})
+
+	Context("soft delete", func() {
+		It("should hide the deleted event and restore it with its sessions and comments", func() {
+			err := SaveWithParents(server.Storage, commentEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&model.Event{Base: model.Base{ID: event1ID}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.FindByID(&model.Event{}, event1ID)
+			Expect(err).To(Equal(storage.ErrNotFound))
+
+			event := model.Event{}
+			err = server.Storage.Restore(&event, event1ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(event.ID).To(Equal(event1ID))
+			Expect(event.DeletedAt).To(BeNil())
+			for _, entity := range []model.Object{&model.Event{}, &model.Session{}, &model.Comment{}} {
+				count, err := server.Storage.Count(entity, model.Query{})
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(count).To(BeEquivalentTo(1))
+			}
+		})
+
+		It("should not restore the comment of deleted session", func() {
+			comment := commentEntityType.NewEntity.(*model.Comment)
+			err := SaveWithParents(server.Storage, comment)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&model.Session{Base: model.Base{ID: comment.SessionID}})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Restore(&model.Comment{}, comment.ID)
+			Expect(err).To(Equal(storage.ErrDeletedParent))
+		})
+
+		It("should keep the author of deleted sessions until they are purged", func() {
+			err := SaveWithParents(server.Storage, sessionEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(sessionEntityType.NewEntity)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = server.Storage.Delete(&model.User{Base: model.Base{ID: user1ID}})
+			Expect(err).To(Equal(storage.ErrReferenced))
+
+			_, err = server.Storage.Purge(time.Now().Add(time.Hour))
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&model.User{Base: model.Base{ID: user1ID}})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should purge only the objects deleted before given time", func() {
+			event := model.Event{Name: "Autumn Summit", Year: "2020"}
+			err := server.Storage.Save(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = server.Storage.Delete(&event)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			count, err := server.Storage.Purge(time.Now().Add(-time.Hour))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(0))
+			count, err = server.Storage.Purge(time.Now().Add(time.Hour))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeEquivalentTo(1))
+
+			err = server.Storage.Restore(&model.Event{}, event.ID)
+			Expect(err).To(Equal(storage.ErrNotFound))
+		})
+	})
 })
@@ -1,11 +1,15 @@
 package test
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 
+	"github.com/dzahariev/e2e-rest/api/migration"
 	"github.com/dzahariev/e2e-rest/api/model"
+	"github.com/dzahariev/e2e-rest/api/storage"
 	"github.com/gofrs/uuid"
 	"github.com/jinzhu/gorm"
 	"github.com/joho/godotenv"
@@ -17,10 +21,27 @@ type EntityType struct {
 	Entity     model.Object
 	NewEntity  model.Object
 	NewEntity1 model.Object
+	// Parents are referenced by the new entities, they should exist before the entities are posted
+	Parents []model.Object
+	// Payload returns the payload that creates the new entity, when it differs from the entity
+	Payload func() interface{}
+}
+
+// CreatePayload returns the JSON payload that creates the new entity
+func (e EntityType) CreatePayload() ([]byte, error) {
+	if e.Payload != nil {
+		return json.Marshal(e.Payload())
+	}
+	return json.Marshal(e.NewEntity)
 }
 
 // CreateDB creates the database
-func CreateDB(DB *gorm.DB, dbUser, dbPassword, dbPort, dbHost, dbName string) error {
+func CreateDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) error {
+	if dbDriver != "postgres" {
+		// memory storage needs no database and sqlite creates the file on connect
+		return nil
+	}
+
 	DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", dbHost, dbPort, dbUser, "postgres", dbPassword)
 	DB, err := gorm.Open("postgres", DBURL)
 	defer DB.Close()
@@ -38,7 +59,14 @@ func CreateDB(DB *gorm.DB, dbUser, dbPassword, dbPort, dbHost, dbName string) er
 }
 
 // DropDB drops the database
-func DropDB(DB *gorm.DB, dbUser, dbPassword, dbPort, dbHost, dbName string) error {
+func DropDB(dbDriver, dbUser, dbPassword, dbPort, dbHost, dbName string) error {
+	switch dbDriver {
+	case "memory":
+		return nil
+	case "sqlite":
+		return os.Remove(dbName)
+	}
+
 	DBURL := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", dbHost, dbPort, dbUser, "postgres", dbPassword)
 	DB, err := gorm.Open("postgres", DBURL)
 	defer DB.Close()
@@ -56,45 +84,23 @@ func DropDB(DB *gorm.DB, dbUser, dbPassword, dbPort, dbHost, dbName string) erro
 }
 
 // RecreateTables recreates the tables in database
-func RecreateTables(DB *gorm.DB) error {
-	err := DB.DropTableIfExists(&model.User{}).Error
-	if err != nil {
-		return err
-	}
-	err = DB.DropTableIfExists(&model.Event{}).Error
-	if err != nil {
-		return err
-	}
-	err = DB.DropTableIfExists(&model.Session{}).Error
-	if err != nil {
-		return err
-	}
-	err = DB.DropTableIfExists(&model.Subscription{}).Error
-	if err != nil {
-		return err
-	}
-	err = DB.DropTableIfExists(&model.Comment{}).Error
-	if err != nil {
-		return err
+func RecreateTables(s storage.Storage) error {
+	if memoryStorage, ok := s.(*storage.Memory); ok {
+		memoryStorage.Reset()
+		return nil
 	}
 
-	err = DB.AutoMigrate(&model.User{}).Error
-	if err != nil {
-		return err
-	}
-	err = DB.AutoMigrate(&model.Event{}).Error
-	if err != nil {
-		return err
+	gormStorage, ok := s.(*storage.GORM)
+	if !ok {
+		return fmt.Errorf("unsupported storage %T", s)
 	}
-	err = DB.AutoMigrate(&model.Session{}).Error
-	if err != nil {
-		return err
-	}
-	err = DB.AutoMigrate(&model.Subscription{}).Error
+	DB := gormStorage.DB
+
+	_, err := migration.Down(DB, len(migration.All()))
 	if err != nil {
 		return err
 	}
-	err = DB.AutoMigrate(&model.Comment{}).Error
+	_, err = migration.Up(DB)
 	if err != nil {
 		return err
 	}
@@ -115,3 +121,43 @@ func GetID() uuid.UUID {
 	ID, _ := uuid.NewV4()
 	return ID
 }
+
+// SaveParents saves the parents of the entity type that are not saved yet
+func SaveParents(s storage.Storage, entityType EntityType) error {
+	for _, parent := range entityType.Parents {
+		err := saveMissing(s, parent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveWithParents saves the object after the parents it holds that are not saved yet,
+// as the storage saves only the object and sets the foreign keys of the parents
+func SaveWithParents(s storage.Storage, object model.Object) error {
+	value := reflect.ValueOf(object).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).Anonymous || value.Field(i).Kind() != reflect.Struct {
+			continue
+		}
+		parent, ok := value.Field(i).Addr().Interface().(model.Object)
+		if !ok || parent.GetID() == uuid.Nil {
+			continue
+		}
+		err := saveMissing(s, parent)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Save(object)
+}
+
+// saveMissing saves the object with its parents when it is not saved yet
+func saveMissing(s storage.Storage, object model.Object) error {
+	stored := reflect.New(reflect.TypeOf(object).Elem()).Interface().(model.Object)
+	if s.FindByID(stored, object.GetID()) == nil {
+		return nil
+	}
+	return SaveWithParents(s, object)
+}